@@ -1,8 +1,11 @@
 package adapters
 
 import (
+	"context"
 	"github.com/marcsello/webploy-server/deployment"
 	"github.com/marcsello/webploy-server/deployment/info"
+	"github.com/marcsello/webploy-server/hooks"
+	"github.com/marcsello/webploy-server/notify"
 	"github.com/marcsello/webploy-server/site"
 	"go.uber.org/zap"
 	"sort"
@@ -97,12 +100,26 @@ func DeleteOldDeployments(s site.Site, logger *zap.Logger) (int, error) {
 	logger.Debug("Gathered old deployments for deletion", zap.Strings("deploymentsToDelete", deploymentsToDelete.AsIDs()))
 
 	for i, di := range deploymentsToDelete {
+		l := logger.With(zap.String("deploymentID", di.id))
+		// read before the deployment is gone
+		eventData := deletedEventData(s, di.id, l)
+		postDeleteHookVars, runPostDelete := postDeleteHookVars(s, di.id, l)
+
 		logger.Info("Deleting old deployment", zap.String("deploymentID", di.id), zap.Int("i", i), zap.Time("createdAt", di.ts))
 		err = s.DeleteDeployment(di.id)
 		if err != nil {
 			logger.Error("Error while deleting old deployment", zap.Error(err))
 			return i, err
 		}
+
+		if runPostDelete {
+			l.Debug("Queueing PostDelete hooks...")
+			err = hooks.EnqueueHook(s, hooks.HookPostDelete, postDeleteHookVars)
+			if err != nil {
+				l.Error("Failed to queue hooks", zap.String("hook", string(hooks.HookPostDelete)), zap.Error(err))
+			}
+		}
+		notify.Send(s, notify.EventDeleted, eventData)
 	}
 
 	return len(deploymentsToDelete), nil
@@ -166,13 +183,92 @@ func DeleteStaleDeployments(s site.Site, referenceNow time.Time, logger *zap.Log
 	logger.Debug("Gathered stale deployments for deletion", zap.Strings("deploymentsToDelete", deploymentsToDelete))
 
 	for i, id := range deploymentsToDelete {
+		if hooks.HasHooks(s.GetConfig().Hooks, hooks.HookOnStaleCleanup) {
+			runStaleCleanupHook(s, id, logger.With(zap.String("deploymentID", id)))
+		}
+
+		eventData := deletedEventData(s, id, logger.With(zap.String("deploymentID", id))) // read before the deployment is gone
+
 		logger.Info("Deleting stale deployment", zap.String("deploymentID", id), zap.Int("i", i))
 		err = s.DeleteDeployment(id)
 		if err != nil {
 			logger.Error("Error while deleting stale deployment", zap.Error(err))
 			return i, err
 		}
+
+		notify.Send(s, notify.EventStaleReaped, eventData)
 	}
 
 	return len(deploymentsToDelete), nil
 }
+
+// runStaleCleanupHook runs the on_stale_cleanup hooks for the deployment before it is deleted. The hooks can not prevent the deletion.
+func runStaleCleanupHook(s site.Site, id string, logger *zap.Logger) {
+	d, err := s.GetDeployment(id)
+	if err != nil {
+		logger.Error("Could not load deployment for running hooks", zap.Error(err))
+		return
+	}
+
+	hookVars := hooks.HookVars{
+		DeploymentID: id,
+	}
+	err = hookVars.ReadFromSiteAndDeployment(s, d)
+	if err != nil {
+		logger.Error("Failed to read hook vars from site or deployment", zap.Error(err))
+		return
+	}
+
+	logger.Debug("Executing OnStaleCleanup hooks...")
+	_, err = hooks.RunHook(context.Background(), s.GetConfig().Hooks, hooks.HookOnStaleCleanup, hookVars)
+	if err != nil {
+		logger.Error("Failed to run hook", zap.Error(err))
+	}
+	// stuff are logged by the hook runner as well
+}
+
+// postDeleteHookVars reads the vars of the post_delete hooks before the deployment is deleted, returns false if there are no hooks to run or the vars can not be read
+func postDeleteHookVars(s site.Site, id string, logger *zap.Logger) (hooks.HookVars, bool) {
+	if !hooks.HasHooks(s.GetConfig().Hooks, hooks.HookPostDelete) {
+		return hooks.HookVars{}, false
+	}
+
+	d, err := s.GetDeployment(id)
+	if err != nil {
+		logger.Error("Could not load deployment for queueing hooks", zap.Error(err))
+		return hooks.HookVars{}, false
+	}
+
+	hookVars := hooks.HookVars{
+		DeploymentID: id,
+	}
+	err = hookVars.ReadFromSiteAndDeployment(s, d)
+	if err != nil {
+		logger.Error("Failed to read hook vars from site or deployment", zap.Error(err))
+		return hooks.HookVars{}, false
+	}
+	return hookVars, true
+}
+
+// deletedEventData collects the data of the notification sent when the cleanup deletes a deployment, if the info can not be read, only the ID is sent
+func deletedEventData(s site.Site, id string, logger *zap.Logger) notify.EventData {
+	eventData := notify.EventData{DeploymentID: id}
+	if len(s.GetConfig().Notifications) == 0 {
+		return eventData
+	}
+
+	d, err := s.GetDeployment(id)
+	if err != nil {
+		logger.Warn("Could not load deployment for notification", zap.Error(err))
+		return eventData
+	}
+	var i info.DeploymentInfo
+	i, err = d.GetFullInfo()
+	if err != nil {
+		logger.Warn("Could not read info from deployment for notification", zap.Error(err))
+		return eventData
+	}
+	eventData.Creator = i.Creator
+	eventData.Meta = i.Meta
+	return eventData
+}
@@ -1,8 +1,20 @@
 package adapters
 
 import (
+	"encoding/json"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/deployment"
+	"github.com/marcsello/webploy-server/deployment/info"
+	"github.com/marcsello/webploy-server/hooks"
+	"github.com/marcsello/webploy-server/notify"
+	"github.com/marcsello/webploy-server/site"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 )
@@ -197,3 +209,82 @@ func TestGetDeletableDeployments(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteOldDeployments_HooksAndNotifications(t *testing.T) {
+	var mu sync.Mutex
+	var received []notify.CloudEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ce notify.CloudEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&ce))
+		mu.Lock()
+		received = append(received, ce)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	deployments := map[string]*deployment.MockDeployment{}
+	for id, i := range map[string]info.DeploymentInfo{
+		"old":  {Creator: "alice", Meta: "old meta", CreatedAt: now.Add(-2 * time.Hour), State: info.DeploymentStateFinished},
+		"new":  {Creator: "bob", CreatedAt: now.Add(-time.Hour), State: info.DeploymentStateFinished},
+		"live": {Creator: "bob", CreatedAt: now.Add(-3 * time.Hour), State: info.DeploymentStateFinished},
+	} {
+		d := new(deployment.MockDeployment)
+		d.On("GetFullInfo").Return(i, nil)
+		d.On("ListFiles").Return([]string{"index.html"}, nil)
+		d.On("GetPath").Return("/var/www/my_site/" + id)
+		deployments[id] = d
+	}
+
+	s := new(site.MockSite)
+	s.On("GetName").Return("my_site")
+	s.On("GetPath").Return("/var/www/my_site")
+	s.On("GetLiveDeploymentID").Return("live", nil)
+	s.On("GetConfig").Return(config.SiteConfig{
+		Name:          "my_site",
+		MaxHistory:    1,
+		Hooks:         config.HooksConfig{PostDelete: config.HookList{{Path: "/bin/true", OnFailure: config.HookOnFailureAbort}}},
+		Notifications: []config.NotificationConfig{{URL: srv.URL}},
+	})
+	s.On("IterDeployments", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		iter := args.Get(0).(site.DeploymentIterator)
+		for _, id := range []string{"live", "old", "new"} {
+			if cont, err := iter(id, deployments[id], id == "live"); !cont || err != nil {
+				return
+			}
+		}
+	})
+	s.On("GetDeployment", "old").Return(deployments["old"], nil)
+	s.On("DeleteDeployment", "old").Return(nil)
+
+	q, err := hooks.InitHookQueue(config.HookQueueConfig{}, t.TempDir(), new(site.MockProvider), zaptest.NewLogger(t)) // not started, the events stay pending
+	assert.NoError(t, err)
+
+	n := notify.InitNotifier(zaptest.NewLogger(t))
+	assert.NoError(t, n.Start())
+
+	var deleted int
+	deleted, err = DeleteOldDeployments(s, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.NoError(t, n.Destroy()) // waits for the delivery
+
+	s.AssertExpectations(t)
+
+	pending := q.Pending()
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, hooks.HookPostDelete, pending[0].Hook)
+		assert.Equal(t, "old", pending[0].Vars.DeploymentID)
+		assert.Equal(t, "alice", pending[0].Vars.DeploymentCreator)
+		assert.Equal(t, "/var/www/my_site/old", pending[0].Vars.DeploymentPath)
+		assert.Equal(t, "my_site", pending[0].Vars.SiteName)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, "io.webploy.deployment.deleted", received[0].Type)
+		assert.Equal(t, notify.EventData{Site: "my_site", DeploymentID: "old", Creator: "alice", Meta: "old meta"}, received[0].Data)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/marcsello/webploy-server/authentication"
 	"github.com/marcsello/webploy-server/authorization"
 	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/hooks"
+	"github.com/marcsello/webploy-server/logging"
 	"github.com/marcsello/webploy-server/site"
 	"github.com/marcsello/webploy-server/utils"
 	"go.uber.org/zap"
@@ -28,30 +30,84 @@ type apiDaemon struct {
 	tls     bool
 }
 
-func InitApi(cfg config.ListenConfig, authNProvider authentication.Provider, authZProvider authorization.Provider, siteProvider site.Provider, lgr *zap.Logger) (utils.Daemon, error) {
+func InitApi(cfg config.ListenConfig, authNProvider authentication.Provider, authZProvider authorization.Provider, siteProvider site.Provider, presigner *authentication.Presigner, logs *logging.Logging, hookQueue *hooks.HookQueue, lgr *zap.Logger) (utils.Daemon, error) {
 
 	r := gin.New()
-	r.Use(goodLoggerMiddleware(lgr))     // <- This must be the first, other middlewares may use it... and funnily enough this maybe uses other middlewares as well
+	err := r.SetTrustedProxies(cfg.TrustedProxies) // the client IP is used for brute-force protection, so it must not be spoofable
+	if err != nil {
+		return nil, err
+	}
+
+	r.Use(requestIDMiddleware)           // <- This must be the first, so the request ID is available for logging
+	r.Use(goodLoggerMiddleware(lgr))     // <- This must be the next, other middlewares may use it... and funnily enough this maybe uses other middlewares as well
 	r.Use(authNProvider.NewMiddleware()) // this also saves the username in the context (the username may be logged)
 	r.Use(injectUsernameToLogger)        // This should be included after AuthN and logger middlewares, it simply loads the username from the context and adds it to the logger.
 
+	r.GET("me", readMe(siteProvider, authZProvider)) // authentication only, everyone is allowed to know about themselves
+
 	siteGroup := r.Group("sites/:siteName")
 	siteGroup.Use(validSiteMiddleware(siteProvider)) // this also saves the siteGroup in the context
 
 	currentDeploymentGroup := siteGroup.Group("live")
 	currentDeploymentGroup.GET("", authZProvider.NewMiddleware(authorization.ActReadLive), readLiveDeployment)
-	currentDeploymentGroup.PUT("", limits.RequestSizeLimiter(DefaultRequestBodySize), authZProvider.NewMiddleware(authorization.ActUpdateLive), updateLiveDeployment)
+	currentDeploymentGroup.PUT("", limits.RequestSizeLimiter(DefaultRequestBodySize), authZProvider.NewDeploymentMiddleware(authorization.ActUpdateLive), updateLiveDeployment)
 
 	siteDeploymentsGroup := siteGroup.Group("deployments")
 	siteDeploymentsGroup.GET("", authZProvider.NewMiddleware(authorization.ActListDeployments), listDeployments)
 	siteDeploymentsGroup.POST("", limits.RequestSizeLimiter(DefaultRequestBodySize), authZProvider.NewMiddleware(authorization.ActCreateDeployment), createDeployment)
 
-	siteDeploymentsGroup.GET(":deploymentID", authZProvider.NewMiddleware(authorization.ActReadDeployment), validDeploymentMiddleware(), readDeployment)
+	siteDeploymentsGroup.GET(":deploymentID", authZProvider.NewDeploymentMiddleware(authorization.ActReadDeployment), validDeploymentMiddleware(), readDeployment)
 	siteDeploymentsGroup.DELETE(":deploymentID", authZProvider.NewMiddleware(), validDeploymentMiddleware(), deleteDeployment)
+	siteDeploymentsGroup.GET(":deploymentID/build-log", authZProvider.NewDeploymentMiddleware(authorization.ActReadDeployment), validDeploymentMiddleware(), readBuildLog)
 
 	siteDeploymentsGroup.POST(":deploymentID/upload", authZProvider.NewMiddleware(), validDeploymentMiddleware(), uploadFileToDeployment)
 	siteDeploymentsGroup.POST(":deploymentID/uploadTar", authZProvider.NewMiddleware(), validDeploymentMiddleware(), uploadTarToDeployment)
 	siteDeploymentsGroup.POST(":deploymentID/finish", limits.RequestSizeLimiter(DefaultRequestBodySize), authZProvider.NewMiddleware(), validDeploymentMiddleware(), finishDeployment)
+	if presigner != nil {
+		siteDeploymentsGroup.POST(":deploymentID/presign", limits.RequestSizeLimiter(DefaultRequestBodySize), authZProvider.NewMiddleware(), validDeploymentMiddleware(), presignDeployment(presigner))
+	}
+
+	sitesGroup := r.Group("sites")
+	sitesGroup.Use(authZProvider.NewGlobalMiddleware(authorization.ActManageSites))
+
+	sitesGroup.GET("", listSites(siteProvider))
+	sitesGroup.POST("", limits.RequestSizeLimiter(SiteConfigRequestBodySize), createSite(siteProvider))
+	sitesGroup.GET(":siteName", readSite(siteProvider))
+	sitesGroup.PUT(":siteName", limits.RequestSizeLimiter(SiteConfigRequestBodySize), updateSite(siteProvider))
+	sitesGroup.DELETE(":siteName", removeSite(siteProvider))
+
+	authzGroup := r.Group("authz")
+	authzGroup.Use(authZProvider.NewGlobalMiddleware(authorization.ActManagePolicy))
+
+	authzGroup.GET("policies", listPolicies(authZProvider))
+	authzGroup.POST("policies", limits.RequestSizeLimiter(DefaultRequestBodySize), addPolicy(authZProvider))
+	authzGroup.DELETE("policies", limits.RequestSizeLimiter(DefaultRequestBodySize), removePolicy(authZProvider))
+
+	authzGroup.GET("groupings", listGroupings(authZProvider))
+	authzGroup.POST("groupings", limits.RequestSizeLimiter(DefaultRequestBodySize), addGrouping(authZProvider))
+	authzGroup.DELETE("groupings", limits.RequestSizeLimiter(DefaultRequestBodySize), removeGrouping(authZProvider))
+
+	authzGroup.GET("site-groupings", listSiteGroupings(authZProvider))
+	authzGroup.POST("site-groupings", limits.RequestSizeLimiter(DefaultRequestBodySize), addSiteGrouping(authZProvider))
+	authzGroup.DELETE("site-groupings", limits.RequestSizeLimiter(DefaultRequestBodySize), removeSiteGrouping(authZProvider))
+
+	authzGroup.GET("check", checkPolicy(siteProvider, authZProvider))
+
+	adminGroup := r.Group("admin")
+	adminGroup.Use(authZProvider.NewGlobalMiddleware(authorization.ActManageLogging))
+
+	adminGroup.GET("log-level", logLevel(logs))
+	adminGroup.PUT("log-level", limits.RequestSizeLimiter(DefaultRequestBodySize), logLevel(logs))
+	adminGroup.GET("log-level/:subsystem", logLevel(logs))
+	adminGroup.PUT("log-level/:subsystem", limits.RequestSizeLimiter(DefaultRequestBodySize), logLevel(logs))
+
+	hookQueueGroup := r.Group("admin/hook-queue")
+	hookQueueGroup.Use(authZProvider.NewGlobalMiddleware(authorization.ActManageHookQueue))
+
+	hookQueueGroup.GET("", listQueuedEvents(hookQueue))
+	hookQueueGroup.GET("dead", listDeadLetters(hookQueue))
+	hookQueueGroup.POST("dead/:eventID/retry", retryDeadLetter(hookQueue))
+	hookQueueGroup.DELETE("dead/:eventID", deleteDeadLetter(hookQueue))
 
 	srv := &http.Server{
 		Addr:              cfg.BindAddr,
@@ -63,7 +119,6 @@ func InitApi(cfg config.ListenConfig, authNProvider authentication.Provider, aut
 	// setup cert hot reload
 	var cm *certman.CertMan
 	if cfg.EnableTLS {
-		var err error
 		cm, err = certman.New(cfg.TLSCert, cfg.TLSKey)
 		if err != nil {
 			return nil, err
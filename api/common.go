@@ -3,10 +3,16 @@ package api
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/marcsello/webploy-server/authorization"
+	"github.com/marcsello/webploy-server/deployment"
+	"github.com/marcsello/webploy-server/deployment/info"
+	"github.com/marcsello/webploy-server/hooks"
+	"github.com/marcsello/webploy-server/notify"
+	"github.com/marcsello/webploy-server/site"
 	"go.uber.org/zap"
+	"net/http"
 )
 
-func ternaryEnforce(ctx *gin.Context, isSelf bool, actSelf, actAny string) (bool, error) {
+func ternaryEnforce(ctx *gin.Context, isSelf bool, actSelf, actAny string, dep authorization.DeploymentAttributes) (bool, error) {
 	l := GetLoggerFromContext(ctx).With(zap.Bool("isSelf", isSelf), zap.String("actSelf", actSelf), zap.String("actAny", actAny))
 
 	var allowed bool
@@ -14,7 +20,7 @@ func ternaryEnforce(ctx *gin.Context, isSelf bool, actSelf, actAny string) (bool
 
 	// If this deployment is created by us, we first check if we allowed to finish our own deployment
 	if isSelf {
-		allowed, err = authorization.EnforceAuthZ(ctx, actSelf)
+		allowed, err = authorization.EnforceAuthZ(ctx, actSelf, dep)
 		if err != nil {
 			l.Error("Failed to check for self act", zap.Error(err))
 			return false, err
@@ -23,7 +29,7 @@ func ternaryEnforce(ctx *gin.Context, isSelf bool, actSelf, actAny string) (bool
 
 	// if it was either not created by us, or we weren't allowed to finish our own, then check if we allowed to finish any
 	if !allowed {
-		allowed, err = authorization.EnforceAuthZ(ctx, actAny)
+		allowed, err = authorization.EnforceAuthZ(ctx, actAny, dep)
 		if err != nil {
 			l.Error("Failed to check for any act", zap.Error(err))
 			return false, err
@@ -33,3 +39,132 @@ func ternaryEnforce(ctx *gin.Context, isSelf bool, actSelf, actAny string) (bool
 	l.Debug("Ternary access check completed", zap.Bool("allowed", allowed))
 	return allowed, nil
 }
+
+// respondHookPrevented sends the response when an action is prevented by a hook.
+// The results of the hooks are only included if the site allows exposing them, as they may contain sensitive output.
+func respondHookPrevented(ctx *gin.Context, s site.Site, result hooks.RunResult, errStr string) {
+	l := GetLoggerFromContext(ctx)
+
+	failed := result.Failed()
+	if failed != nil {
+		l = l.With(zap.Int("hookIndex", failed.Index), zap.String("hookPath", failed.Path), zap.Int("exitCode", failed.ExitCode), zap.Bool("timedOut", failed.TimedOut))
+	}
+	l.Warn("Action is prevented by hook", zap.String("hook", string(result.Hook)))
+
+	if !s.GetConfig().Hooks.ExposeOutput {
+		ctx.JSON(http.StatusFailedDependency, ErrorResp{ErrStr: errStr})
+		return
+	}
+
+	resp := HookPreventedResp{
+		Err:     errStr,
+		Hook:    string(result.Hook),
+		Results: make([]HookResultResp, len(result.Results)),
+	}
+	for i, r := range result.Results {
+		resp.Results[i] = HookResultResp{
+			Index:      r.Index,
+			ExitCode:   r.ExitCode,
+			TimedOut:   r.TimedOut,
+			Ignored:    r.Ignored,
+			Stdout:     hooks.TruncateOutput(r.Stdout),
+			Stderr:     hooks.TruncateOutput(r.Stderr),
+			DurationMs: r.Duration.Milliseconds(),
+		}
+		if r.Err != nil {
+			resp.Results[i].Err = r.Err.Error()
+		}
+	}
+	ctx.JSON(http.StatusFailedDependency, resp)
+}
+
+// runPreUploadHook runs the pre_upload hooks, and returns the vars to be used for the post_upload hooks as well.
+// As uploads are frequent, the vars are only collected if there are upload hooks configured.
+// If the upload is prevented (or something went wrong), the response is sent, and true is returned.
+func runPreUploadHook(ctx *gin.Context, s site.Site, user, dID string, d deployment.Deployment, uploadedFiles []string) (hooks.HookVars, bool) {
+	l := GetLoggerFromContext(ctx)
+
+	hooksConfig := s.GetConfig().Hooks
+	if !hooks.HasHooks(hooksConfig, hooks.HookPreUpload) && !hooks.HasHooks(hooksConfig, hooks.HookPostUpload) {
+		return hooks.HookVars{}, false
+	}
+
+	l.Debug("Executing PreUpload hooks (if any)...")
+	hookVars := hooks.HookVars{
+		User:          user,
+		DeploymentID:  dID,
+		RequestID:     GetRequestIDFromContext(ctx),
+		UploadedFiles: uploadedFiles,
+	}
+	err := hookVars.ReadFromSiteAndDeployment(s, d)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to read hook vars from site or deployment", zap.Error(err))
+		return hookVars, true
+	}
+
+	var hookResult hooks.RunResult
+	hookResult, err = hooks.RunHook(ctx, hooksConfig, hooks.HookPreUpload, hookVars)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to run hook", zap.Error(err))
+		return hookVars, true
+	}
+	if !hookResult.Ok {
+		respondHookPrevented(ctx, s, hookResult, "upload prevented by hook")
+		return hookVars, true
+	}
+	l.Debug("Hooks executed successfully")
+
+	return hookVars, false
+}
+
+// enqueuePostUploadHook queues the post_upload hooks with the vars returned by runPreUploadHook
+func enqueuePostUploadHook(l *zap.Logger, s site.Site, d deployment.Deployment, preUploadHookVars hooks.HookVars, uploadedFiles []string) {
+	if !hooks.HasHooks(s.GetConfig().Hooks, hooks.HookPostUpload) {
+		return
+	}
+
+	l.Debug("Queueing PostUpload hooks (if any)...")
+	postUploadHookVars := preUploadHookVars.Copy()
+	postUploadHookVars.UploadedFiles = uploadedFiles
+	var err error
+	postUploadHookVars.Files, err = d.ListFiles() // the upload changed them
+	if err != nil {
+		l.Error("Failed to list the files of the deployment", zap.Error(err))
+		return
+	}
+	enqueueHook(l, s, hooks.HookPostUpload, postUploadHookVars)
+}
+
+// enqueueHook queues the hooks of a post_* event, the action already happened, so failures are only logged
+func enqueueHook(l *zap.Logger, s site.Site, hook hooks.HookID, vars hooks.HookVars) {
+	err := hooks.EnqueueHook(s, hook, vars)
+	if err != nil {
+		l.Error("Failed to queue hooks", zap.String("hook", string(hook)), zap.Error(err))
+	}
+}
+
+// notifyEvent sends the notifications of the event, the data is taken from the hook vars of the action
+func notifyEvent(s site.Site, event notify.Event, vars hooks.HookVars) {
+	notify.Send(s, event, notify.EventData{
+		DeploymentID:   vars.DeploymentID,
+		User:           vars.User,
+		RequestID:      vars.RequestID,
+		Creator:        vars.DeploymentCreator,
+		Meta:           vars.DeploymentMeta,
+		PreviousLiveID: vars.PreviousLiveID,
+	})
+}
+
+// notifyUpload adds the uploaded files to the uploaded notification of the deployment, it is sent once the uploads settle
+func notifyUpload(ctx *gin.Context, s site.Site, user, dID string, i info.DeploymentInfo, uploadedFiles []string) {
+	notify.SendUpload(s, notify.EventData{
+		DeploymentID: dID,
+		User:         user,
+		RequestID:    GetRequestIDFromContext(ctx),
+		Creator:      i.Creator,
+		Meta:         i.Meta,
+		Files:        uploadedFiles,
+	})
+}
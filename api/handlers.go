@@ -1,7 +1,6 @@
 package api
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -11,11 +10,14 @@ import (
 	"github.com/marcsello/webploy-server/deployment"
 	"github.com/marcsello/webploy-server/deployment/info"
 	"github.com/marcsello/webploy-server/hooks"
+	"github.com/marcsello/webploy-server/notify"
 	"github.com/marcsello/webploy-server/site"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
+	"path"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -85,6 +87,7 @@ func createDeployment(ctx *gin.Context) {
 		User:              user,
 		DeploymentCreator: user,
 		DeploymentMeta:    req.Meta,
+		RequestID:         GetRequestIDFromContext(ctx),
 	}
 	err = hookVars.ReadFromSite(s)
 	if err != nil {
@@ -92,15 +95,15 @@ func createDeployment(ctx *gin.Context) {
 		l.Error("Failed to load hook vars from site", zap.Error(err))
 		return
 	}
-	ok, err = hooks.RunHook(ctx, s.GetConfig().Hooks, hooks.HookPreCreate, hookVars)
+	var hookResult hooks.RunResult
+	hookResult, err = hooks.RunHook(ctx, s.GetConfig().Hooks, hooks.HookPreCreate, hookVars)
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		l.Error("Failed to run hook", zap.Error(err))
 		return
 	}
-	if !ok {
-		ctx.JSON(http.StatusFailedDependency, ErrorResp{ErrStr: "prevented by hook"})
-		l.Warn("Action is prevented by hook (non-zero exit code)") // since the hook logs are not connected to the handler logs in any way... this will be hard to debug...
+	if !hookResult.Ok {
+		respondHookPrevented(ctx, s, hookResult, "prevented by hook")
 		return
 	}
 	l.Debug("Hooks executed successfully")
@@ -116,6 +119,18 @@ func createDeployment(ctx *gin.Context) {
 
 	l.Info("New deployment created!", zap.String("deploymentID", id))
 
+	l.Debug("Queueing PostCreate hooks (if any)...")
+	postCreateHookVars := hookVars.Copy()
+	postCreateHookVars.DeploymentID = id
+	err = postCreateHookVars.ReadFromDeployment(d)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to read hook vars from deployment", zap.Error(err))
+		return
+	}
+	enqueueHook(l, s, hooks.HookPostCreate, postCreateHookVars)
+	notifyEvent(s, notify.EventCreated, postCreateHookVars)
+
 	var i info.DeploymentInfo
 	i, err = d.GetFullInfo()
 	if err != nil {
@@ -158,11 +173,13 @@ func deleteDeployment(ctx *gin.Context) {
 		return
 	}
 
+	dep := authorization.NewDeploymentAttributes(deploymentID, i, time.Now())
+
 	var allowed bool
 	if !i.IsFinished() {
 		l.Debug("DELETE operation on an un-finished deployment. Considering abort permission first")
 
-		allowed, err = ternaryEnforce(ctx, i.Creator == user, authorization.ActAbortSelf, authorization.ActAbortAny)
+		allowed, err = ternaryEnforce(ctx, i.Creator == user, authorization.ActAbortSelf, authorization.ActAbortAny, dep)
 		if err != nil {
 			ctx.Status(http.StatusInternalServerError)
 			l.Error("Failed to check for permission", zap.Error(err))
@@ -172,7 +189,7 @@ func deleteDeployment(ctx *gin.Context) {
 	}
 	if !allowed {
 		l.Debug("Considering delete permission...", zap.Bool("isFinished", i.IsFinished()))
-		allowed, err = ternaryEnforce(ctx, i.Creator == user, authorization.ActDeleteSelf, authorization.ActDeleteAny)
+		allowed, err = ternaryEnforce(ctx, i.Creator == user, authorization.ActDeleteSelf, authorization.ActDeleteAny, dep)
 		if err != nil {
 			ctx.Status(http.StatusInternalServerError)
 			l.Error("Failed to check for permission", zap.Error(err))
@@ -186,6 +203,32 @@ func deleteDeployment(ctx *gin.Context) {
 		return
 	}
 
+	l.Debug("Executing PreDelete hooks (if any)...")
+	preDeleteHookVars := hooks.HookVars{
+		User:         user,
+		DeploymentID: deploymentID,
+		RequestID:    GetRequestIDFromContext(ctx),
+	}
+	err = preDeleteHookVars.ReadFromSiteAndDeployment(s, d)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to read hook vars from site or deployment", zap.Error(err))
+		return
+	}
+
+	var hookResult hooks.RunResult
+	hookResult, err = hooks.RunHook(ctx, s.GetConfig().Hooks, hooks.HookPreDelete, preDeleteHookVars)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to run hook", zap.Error(err))
+		return
+	}
+	if !hookResult.Ok {
+		respondHookPrevented(ctx, s, hookResult, "deletion prevented by hook")
+		return
+	}
+	l.Debug("Hooks executed successfully")
+
 	l.Debug("Deleting deployment...")
 	err = s.DeleteDeployment(deploymentID)
 	if err != nil {
@@ -200,6 +243,11 @@ func deleteDeployment(ctx *gin.Context) {
 	}
 
 	l.Info("Deleted deployment!") // deploymentID is already assigned by the validDeployment middleware
+
+	l.Debug("Queueing PostDelete hooks (if any)...")
+	postDeleteHookVars := preDeleteHookVars.Copy() // the deployment is gone, so this can not be re-read
+	enqueueHook(l, s, hooks.HookPostDelete, postDeleteHookVars)
+	notifyEvent(s, notify.EventDeleted, postDeleteHookVars)
 	ctx.Status(http.StatusNoContent)
 }
 
@@ -213,7 +261,7 @@ func uploadFileToDeployment(ctx *gin.Context) {
 		return
 	}
 
-	_, d := GetDeploymentFromContext(ctx)
+	dID, d := GetDeploymentFromContext(ctx)
 
 	i, err := d.GetFullInfo()
 	if err != nil {
@@ -222,8 +270,10 @@ func uploadFileToDeployment(ctx *gin.Context) {
 		return
 	}
 
+	dep := authorization.NewDeploymentAttributes(dID, i, time.Now())
+
 	var allowed bool
-	allowed, err = ternaryEnforce(ctx, i.Creator == user, authorization.ActUploadSelf, authorization.ActUploadAny)
+	allowed, err = ternaryEnforce(ctx, i.Creator == user, authorization.ActUploadSelf, authorization.ActUploadAny, dep)
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		l.Error("Failed to check for permission", zap.Error(err))
@@ -246,6 +296,12 @@ func uploadFileToDeployment(ctx *gin.Context) {
 	l = l.With(zap.String("filename", filename))
 	l.Debug("Target filename decoded")
 
+	s := GetSiteFromContext(ctx)
+	uploadHookVars, prevented := runPreUploadHook(ctx, s, user, dID, d, []string{filename})
+	if prevented {
+		return // response already sent
+	}
+
 	err = d.AddFile(ctx, filename, ctx.Request.Body) // <- Concurrent upload limiting handled here
 	if err != nil {
 		if errors.Is(err, deployment.ErrDeploymentFinished) {
@@ -263,6 +319,11 @@ func uploadFileToDeployment(ctx *gin.Context) {
 			l.Warn("Too many pending uploads for deployment", zap.Error(err))
 			return
 		}
+		if errors.Is(err, deployment.ErrBuildRunning) {
+			ctx.JSON(http.StatusConflict, ErrorResp{Err: err})
+			l.Warn("Trying to upload while the deployment is being built", zap.Error(err))
+			return
+		}
 		if errors.Is(err, os.ErrExist) {
 			ctx.JSON(http.StatusConflict, ErrorResp{Err: err})
 			l.Warn("Trying to upload a file that already exists", zap.Error(err))
@@ -275,6 +336,8 @@ func uploadFileToDeployment(ctx *gin.Context) {
 	}
 
 	l.Info("New file uploaded!", zap.String("filename", filename))
+	enqueuePostUploadHook(l, s, d, uploadHookVars, []string{filename})
+	notifyUpload(ctx, s, user, dID, i, []string{filename})
 	ctx.Status(http.StatusCreated)
 }
 
@@ -288,7 +351,7 @@ func uploadTarToDeployment(ctx *gin.Context) {
 		return
 	}
 
-	_, d := GetDeploymentFromContext(ctx)
+	dID, d := GetDeploymentFromContext(ctx)
 
 	i, err := d.GetFullInfo()
 	if err != nil {
@@ -297,8 +360,10 @@ func uploadTarToDeployment(ctx *gin.Context) {
 		return
 	}
 
+	dep := authorization.NewDeploymentAttributes(dID, i, time.Now())
+
 	var allowed bool
-	allowed, err = ternaryEnforce(ctx, i.Creator == user, authorization.ActUploadSelf, authorization.ActUploadAny)
+	allowed, err = ternaryEnforce(ctx, i.Creator == user, authorization.ActUploadSelf, authorization.ActUploadAny, dep)
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		l.Error("Failed to check for permission", zap.Error(err))
@@ -310,6 +375,12 @@ func uploadTarToDeployment(ctx *gin.Context) {
 		return
 	}
 
+	s := GetSiteFromContext(ctx)
+	uploadHookVars, prevented := runPreUploadHook(ctx, s, user, dID, d, nil) // the file names are not known before extracting
+	if prevented {
+		return // response already sent
+	}
+
 	var filenames []string
 	filenames, err = adapters.ExtractTarAdapter(ctx, l, d, ctx.Request.Body)
 	if err != nil {
@@ -328,6 +399,11 @@ func uploadTarToDeployment(ctx *gin.Context) {
 			l.Warn("Too many pending uploads for deployment", zap.Error(err))
 			return
 		}
+		if errors.Is(err, deployment.ErrBuildRunning) {
+			ctx.JSON(http.StatusConflict, ErrorResp{Err: err})
+			l.Warn("Trying to upload while the deployment is being built", zap.Error(err))
+			return
+		}
 		if errors.Is(err, os.ErrExist) {
 			ctx.JSON(http.StatusConflict, ErrorResp{Err: err})
 			l.Warn("Trying to upload a file that already exists", zap.Error(err))
@@ -340,6 +416,8 @@ func uploadTarToDeployment(ctx *gin.Context) {
 	}
 
 	l.Info("Files uploaded from tar archive!", zap.Strings("filenames", filenames))
+	enqueuePostUploadHook(l, s, d, uploadHookVars, filenames)
+	notifyUpload(ctx, s, user, dID, i, filenames)
 	ctx.Status(http.StatusCreated)
 }
 
@@ -363,8 +441,10 @@ func finishDeployment(ctx *gin.Context) {
 		return
 	}
 
+	dep := authorization.NewDeploymentAttributes(dID, i, time.Now())
+
 	var allowed bool
-	allowed, err = ternaryEnforce(ctx, i.Creator == user, authorization.ActFinishSelf, authorization.ActFinishAny)
+	allowed, err = ternaryEnforce(ctx, i.Creator == user, authorization.ActFinishSelf, authorization.ActFinishAny, dep)
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		l.Error("Failed to check for permission", zap.Error(err))
@@ -380,6 +460,7 @@ func finishDeployment(ctx *gin.Context) {
 	preFinishHookVars := hooks.HookVars{
 		User:         user,
 		DeploymentID: dID,
+		RequestID:    GetRequestIDFromContext(ctx),
 	}
 	err = preFinishHookVars.ReadFromSiteAndDeployment(s, d)
 	if err != nil {
@@ -388,19 +469,59 @@ func finishDeployment(ctx *gin.Context) {
 		return
 	}
 
-	ok, err = hooks.RunHook(ctx, s.GetConfig().Hooks, hooks.HookPreFinish, preFinishHookVars)
+	var hookResult hooks.RunResult
+	hookResult, err = hooks.RunHook(ctx, s.GetConfig().Hooks, hooks.HookPreFinish, preFinishHookVars)
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		l.Error("Failed to run hook", zap.Error(err))
 		return
 	}
-	if !ok {
-		ctx.JSON(http.StatusFailedDependency, ErrorResp{ErrStr: "finishing prevented by hook"})
-		l.Warn("Action is prevented by hook (non-zero exit code)") // since the hook logs are not connected to the handler logs in any way... this will be hard to debug...
+	if !hookResult.Ok {
+		respondHookPrevented(ctx, s, hookResult, "finishing prevented by hook")
 		return
 	}
 	l.Debug("Hooks executed successfully")
 
+	if hooks.HasHooks(s.GetConfig().Hooks, hooks.HookBuild) {
+		var buildDone func()
+		buildDone, err = d.StartBuild()
+		if err != nil {
+			if errors.Is(err, deployment.ErrDeploymentFinished) || errors.Is(err, deployment.ErrUploadPending) || errors.Is(err, deployment.ErrBuildRunning) {
+				ctx.JSON(http.StatusConflict, ErrorResp{Err: err})
+				l.Warn("Could not start the build of the deployment", zap.Error(err))
+				return
+			}
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to start the build of the deployment", zap.Error(err))
+			return
+		}
+		defer buildDone() // uploads are kept out until the deployment is finished
+
+		l.Debug("Executing Build hooks...")
+		hookResult, err = hooks.RunHook(ctx, s.GetConfig().Hooks, hooks.HookBuild, preFinishHookVars)
+		buildLogPath := path.Join(d.GetPath(), deployment.BuildLogFileName)
+		if e := hooks.SaveBuildLog(buildLogPath, hookResult); e != nil {
+			l.Error("Failed to save build log", zap.Error(e), zap.String("buildLogPath", buildLogPath)) // the build result is more important
+		}
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to run hook", zap.Error(err))
+			return
+		}
+		if !hookResult.Ok {
+			respondHookPrevented(ctx, s, hookResult, "build failed")
+			return
+		}
+		l.Debug("Build hooks executed successfully")
+
+		preFinishHookVars.Files, err = d.ListFiles() // the build may have changed them
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to list the files of the deployment", zap.Error(err))
+			return
+		}
+	}
+
 	err = d.Finish()
 	if err != nil {
 		if errors.Is(err, deployment.ErrDeploymentFinished) {
@@ -422,37 +543,34 @@ func finishDeployment(ctx *gin.Context) {
 
 	l.Info("Finished deployment!", zap.Bool("GoLiveOnFinish", s.GetConfig().GoLiveOnFinish))
 
-	l.Debug("Executing PostFinish hooks in the background (if any)...")
-	postFinishHookVars := preFinishHookVars.Copy()
-	go func() {
-		_, err = hooks.RunHook(context.Background(), s.GetConfig().Hooks, hooks.HookPostFinish, postFinishHookVars)
-		if err != nil {
-			l.Error("Failed to run hook", zap.Error(err))
-		}
-		// stuff are logged by the hook runner as well
-	}()
-
 	i, err = d.GetFullInfo()
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		l.Error("Failed to read info for deployment (after finishing it)", zap.Error(err))
 		return
 	}
+	finishedHookVars := preFinishHookVars.Copy()
+	finishedHookVars.ReadFromDeploymentInfo(i) // the state of the deployment is changed by finishing it
+
+	l.Debug("Queueing PostFinish hooks (if any)...")
+	enqueueHook(l, s, hooks.HookPostFinish, finishedHookVars)
+	notifyEvent(s, notify.EventFinished, finishedHookVars)
 
 	// set live on finish
 	var setAsLive bool
 	if s.GetConfig().GoLiveOnFinish {
 
 		l.Debug("Executing PreLive hooks (if any)...")
-		preLiveHookVars := preFinishHookVars.Copy()
-		ok, err = hooks.RunHook(ctx, s.GetConfig().Hooks, hooks.HookPreLive, preLiveHookVars)
+		preLiveHookVars := finishedHookVars.Copy()
+		hookResult, err = hooks.RunHook(ctx, s.GetConfig().Hooks, hooks.HookPreLive, preLiveHookVars)
 		if err != nil {
 			ctx.Status(http.StatusInternalServerError)
 			l.Error("Failed to run hook", zap.Error(err))
 			return
 		}
-		if !ok {
-			l.Warn("Setting as live is prevented by hook (non-zero exit code)") // since the hook logs are not connected to the handler logs in any way... this will be hard to debug...
+		if !hookResult.Ok {
+			failed := hookResult.Failed()
+			l.Warn("Setting as live is prevented by hook", zap.Int("hookIndex", failed.Index), zap.String("hookPath", failed.Path), zap.Int("exitCode", failed.ExitCode), zap.Bool("timedOut", failed.TimedOut))
 		} else { // set as live only if the hook was successful
 			err = s.SetLiveDeploymentID(dID)
 			if err != nil {
@@ -466,16 +584,12 @@ func finishDeployment(ctx *gin.Context) {
 	}
 
 	if setAsLive {
-		l.Debug("Executing PostLive hooks in the background (if any)...")
-		postLiveHookVars := preFinishHookVars.Copy()
-		postLiveHookVars.SiteCurrentLive = dID // this is the only field that should change
-		go func() {
-			_, err = hooks.RunHook(context.Background(), s.GetConfig().Hooks, hooks.HookPostLive, postLiveHookVars)
-			if err != nil {
-				l.Error("Failed to run hook", zap.Error(err))
-			}
-			// stuff are logged by the hook runner as well
-		}()
+		l.Debug("Queueing PostLive hooks (if any)...")
+		postLiveHookVars := finishedHookVars.Copy()
+		postLiveHookVars.PreviousLiveID = finishedHookVars.SiteCurrentLive
+		postLiveHookVars.SiteCurrentLive = dID // these are the only fields that should change
+		enqueueHook(l, s, hooks.HookPostLive, postLiveHookVars)
+		notifyEvent(s, notify.EventLiveChanged, postLiveHookVars)
 	}
 
 	// Start cleanup in the background
@@ -530,6 +644,20 @@ func readDeployment(ctx *gin.Context) {
 		return
 	}
 
+	// the middleware only did the coarse check, this one considers the attributes of the deployment
+	var allowed bool
+	allowed, err = authorization.EnforceAuthZ(ctx, authorization.ActReadDeployment, authorization.NewDeploymentAttributes(dID, i, time.Now()))
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to check for permission", zap.Error(err))
+		return
+	}
+	if !allowed {
+		ctx.JSON(http.StatusForbidden, ErrorResp{ErrStr: "no permission to read this"})
+		l.Warn("Prevented reading the deployment, the user have no permission to read this deployment", zap.String("deploymentCreator", i.Creator))
+		return
+	}
+
 	var liveDID string
 	liveDID, err = s.GetLiveDeploymentID()
 	if err != nil {
@@ -629,16 +757,50 @@ func updateLiveDeployment(ctx *gin.Context) {
 	var d deployment.Deployment
 	d, err = s.GetDeployment(req.ID)
 	if err != nil {
+		if errors.Is(err, site.ErrDeploymentNotExists) {
+			ctx.JSON(http.StatusNotFound, ErrorResp{Err: err})
+			l.Warn("Tried to set a missing deployment as live", zap.Error(err))
+			return
+		}
+		if errors.Is(err, site.ErrInvalidID) {
+			ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+			l.Warn("Tried to use an invalid deployment ID", zap.Error(err))
+			return
+		}
+
 		ctx.Status(http.StatusInternalServerError)
 		l.Error("Failed to load deployment", zap.Error(err))
 		return
 	}
 
+	var i info.DeploymentInfo
+	i, err = d.GetFullInfo()
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to read info for deployment", zap.Error(err))
+		return
+	}
+
+	// the middleware only did the coarse check, this one considers the attributes of the deployment
+	var allowed bool
+	allowed, err = authorization.EnforceAuthZ(ctx, authorization.ActUpdateLive, authorization.NewDeploymentAttributes(req.ID, i, time.Now()))
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to check for permission", zap.Error(err))
+		return
+	}
+	if !allowed {
+		ctx.JSON(http.StatusForbidden, ErrorResp{ErrStr: "no permission to set this live"})
+		l.Warn("Prevented setting the deployment live, the user have no permission to do this", zap.String("deploymentCreator", i.Creator))
+		return
+	}
+
 	// exec hooks
 	l.Debug("Executing PreLive hooks (if any)...")
 	preLiveHookVars := hooks.HookVars{
 		User:         user,
 		DeploymentID: req.ID,
+		RequestID:    GetRequestIDFromContext(ctx),
 	}
 	err = preLiveHookVars.ReadFromSiteAndDeployment(s, d)
 	if err != nil {
@@ -647,15 +809,15 @@ func updateLiveDeployment(ctx *gin.Context) {
 		return
 	}
 
-	ok, err = hooks.RunHook(ctx, s.GetConfig().Hooks, hooks.HookPreFinish, preLiveHookVars)
+	var hookResult hooks.RunResult
+	hookResult, err = hooks.RunHook(ctx, s.GetConfig().Hooks, hooks.HookPreLive, preLiveHookVars)
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		l.Error("Failed to run hook", zap.Error(err))
 		return
 	}
-	if !ok {
-		ctx.JSON(http.StatusFailedDependency, ErrorResp{ErrStr: "prevented by hook"})
-		l.Warn("Action is prevented by hook (non-zero exit code)") // since the hook logs are not connected to the handler logs in any way... this will be hard to debug...
+	if !hookResult.Ok {
+		respondHookPrevented(ctx, s, hookResult, "prevented by hook")
 		return
 	}
 	l.Debug("Hooks executed successfully")
@@ -692,7 +854,6 @@ func updateLiveDeployment(ctx *gin.Context) {
 		return
 	}
 
-	var i info.DeploymentInfo
 	i, err = d.GetFullInfo()
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
@@ -702,16 +863,12 @@ func updateLiveDeployment(ctx *gin.Context) {
 
 	l.Info("Live deployment updated")
 
-	l.Debug("Executing PostLive hooks in the background (if any)...")
+	l.Debug("Queueing PostLive hooks (if any)...")
 	postLiveHookVars := preLiveHookVars.Copy()
+	postLiveHookVars.PreviousLiveID = preLiveHookVars.SiteCurrentLive
 	postLiveHookVars.SiteCurrentLive = req.ID
-	go func() {
-		_, err = hooks.RunHook(context.Background(), s.GetConfig().Hooks, hooks.HookPostLive, postLiveHookVars)
-		if err != nil {
-			l.Error("Failed to run hook", zap.Error(err))
-		}
-		// stuff are logged by the hook runner as well
-	}()
+	enqueueHook(l, s, hooks.HookPostLive, postLiveHookVars)
+	notifyEvent(s, notify.EventLiveChanged, postLiveHookVars)
 
 	resp := DeploymentInfoResp{
 		Site:       s.GetName(),
@@ -726,3 +883,45 @@ func updateLiveDeployment(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, resp)
 }
+
+func readBuildLog(ctx *gin.Context) {
+	l := GetLoggerFromContext(ctx)
+	dID, d := GetDeploymentFromContext(ctx)
+
+	i, err := d.GetFullInfo()
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to read info for deployment", zap.Error(err))
+		return
+	}
+
+	// the middleware only did the coarse check, this one considers the attributes of the deployment
+	var allowed bool
+	allowed, err = authorization.EnforceAuthZ(ctx, authorization.ActReadDeployment, authorization.NewDeploymentAttributes(dID, i, time.Now()))
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to check for permission", zap.Error(err))
+		return
+	}
+	if !allowed {
+		ctx.JSON(http.StatusForbidden, ErrorResp{ErrStr: "no permission to read this"})
+		l.Warn("Prevented reading the build log, the user have no permission to read this deployment", zap.String("deploymentCreator", i.Creator))
+		return
+	}
+
+	buildLogPath := path.Join(d.GetPath(), deployment.BuildLogFileName)
+	_, err = os.Stat(buildLogPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			ctx.JSON(http.StatusNotFound, ErrorResp{ErrStr: "no build log for this deployment"})
+			l.Debug("Build log requested, but there was no build for this deployment")
+			return
+		}
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to stat build log", zap.Error(err))
+		return
+	}
+
+	ctx.Header("Content-Type", "text/plain; charset=utf-8")
+	ctx.File(buildLogPath)
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/marcsello/webploy-server/hooks"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+func newQueuedEventResp(ev hooks.QueuedEvent) QueuedEventResp {
+	var failedHooks []string
+	for _, fh := range ev.FailedHooks {
+		failedHooks = append(failedHooks, fh.Path)
+	}
+	return QueuedEventResp{
+		ID:           ev.ID,
+		Hook:         string(ev.Hook),
+		Site:         ev.Vars.SiteName,
+		DeploymentID: ev.Vars.DeploymentID,
+		RequestID:    ev.Vars.RequestID,
+		CreatedAt:    ev.CreatedAt,
+		Attempts:     ev.Attempts,
+		NextAttempt:  ev.NextAttempt,
+		LastError:    ev.LastError,
+		FailedHooks:  failedHooks,
+	}
+}
+
+func newQueuedEventsResp(events []hooks.QueuedEvent) []QueuedEventResp {
+	resp := make([]QueuedEventResp, len(events))
+	for i, ev := range events {
+		resp[i] = newQueuedEventResp(ev)
+	}
+	return resp
+}
+
+// respondDeadLetterError maps the errors of the hook queue to responses
+func respondDeadLetterError(ctx *gin.Context, l *zap.Logger, err error) {
+	if errors.Is(err, hooks.ErrQueuedEventNotFound) {
+		ctx.JSON(http.StatusNotFound, ErrorResp{Err: err})
+		l.Warn("Dead letter does not exist", zap.Error(err))
+		return
+	}
+	ctx.Status(http.StatusInternalServerError)
+	l.Error("Failed to change dead letter", zap.Error(err))
+}
+
+func listQueuedEvents(hookQueue *hooks.HookQueue) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, newQueuedEventsResp(hookQueue.Pending()))
+	}
+}
+
+func listDeadLetters(hookQueue *hooks.HookQueue) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+
+		events, err := hookQueue.DeadLetters()
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to read dead letters", zap.Error(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, newQueuedEventsResp(events))
+	}
+}
+
+func retryDeadLetter(hookQueue *hooks.HookQueue) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+		eventID := ctx.Param("eventID")
+		l = l.With(zap.String("eventID", eventID))
+
+		err := hookQueue.RetryDeadLetter(eventID)
+		if err != nil {
+			respondDeadLetterError(ctx, l, err)
+			return
+		}
+
+		l.Info("Dead letter re-queued!")
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+func deleteDeadLetter(hookQueue *hooks.HookQueue) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+		eventID := ctx.Param("eventID")
+		l = l.With(zap.String("eventID", eventID))
+
+		err := hookQueue.DeleteDeadLetter(eventID)
+		if err != nil {
+			respondDeadLetterError(ctx, l, err)
+			return
+		}
+
+		l.Info("Dead letter removed!")
+		ctx.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/marcsello/webploy-server/logging"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// logLevel reads or changes the level of the root logger, or the logger of a subsystem, the request and the response are handled by zap's AtomicLevel
+func logLevel(logs *logging.Logging) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+		subsystem := ctx.Param("subsystem")
+
+		level, err := logs.Level(subsystem)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, ErrorResp{Err: err})
+			l.Warn("Unknown logging subsystem", zap.String("subsystem", subsystem))
+			return
+		}
+
+		oldLevel := level.Level()
+		level.ServeHTTP(ctx.Writer, ctx.Request)
+
+		if newLevel := level.Level(); newLevel != oldLevel {
+			l.Info("Log level changed", zap.String("subsystem", subsystem), zap.Stringer("oldLevel", oldLevel), zap.Stringer("newLevel", newLevel))
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/marcsello/webploy-server/authentication"
+	"github.com/marcsello/webploy-server/authorization"
+	"github.com/marcsello/webploy-server/site"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// allowedActs returns the subset of acts that the user is allowed to do on obj
+// Deployment-scoped acts are checked without deployment attributes, rules depending on them may give a different answer for a specific deployment.
+func allowedActs(pm authorization.PolicyManager, user, obj string, acts []string) ([]string, error) {
+	allowed := make([]string, 0, len(acts))
+	for _, act := range acts {
+		ok, err := pm.Check(user, obj, act, authorization.DeploymentAttributes{})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			allowed = append(allowed, act)
+		}
+	}
+	return allowed, nil
+}
+
+// readMe returns the authenticated user, and the acts they are allowed to do per site
+func readMe(siteProvider site.Provider, pm authorization.PolicyManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+		user, ok := authentication.GetAuthenticatedUser(ctx)
+		if !ok {
+			// should not happen
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Could not load user from context")
+			return
+		}
+
+		var providerName string
+		providerName, ok = authentication.GetAuthenticationProviderName(ctx)
+		if !ok {
+			// should not happen
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Could not load authentication provider name from context")
+			return
+		}
+
+		resp := MeResp{
+			Username: user,
+			Provider: providerName,
+			Sites:    map[string][]string{},
+		}
+
+		for _, siteName := range siteProvider.GetAllSiteNames() {
+			acts, err := allowedActs(pm, user, siteName, authorization.SiteActs)
+			if err != nil {
+				ctx.Status(http.StatusInternalServerError)
+				l.Error("Failed to check policy for site", zap.String("siteName", siteName), zap.Error(err))
+				return
+			}
+			if len(acts) > 0 {
+				resp.Sites[siteName] = acts
+			}
+		}
+
+		var err error
+		resp.GlobalActs, err = allowedActs(pm, user, authorization.GlobalObject, authorization.GlobalActs)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to check policy for global acts", zap.Error(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
@@ -3,12 +3,14 @@ package api
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/marcsello/webploy-server/authentication"
 	"github.com/marcsello/webploy-server/deployment"
 	"github.com/marcsello/webploy-server/site"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -16,6 +18,40 @@ const validSiteKey = "site"
 const validDeploymentKey = "deployment"
 const validDeploymentIDKey = "deployment_id"
 const loggerKey = "lgr"
+const requestIDKey = "request_id"
+
+// RequestIDHeader is used to pass the request ID, it is taken from the request if it is valid, and always set in the response
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// requestIDMiddleware uses the request ID provided by the client (or a proxy), or generates a new one
+func requestIDMiddleware(ctx *gin.Context) {
+	requestID := ctx.GetHeader(RequestIDHeader)
+	if !isRequestIDValid(requestID) {
+		requestID = uuid.NewString()
+	}
+	ctx.Set(requestIDKey, requestID)
+	ctx.Header(RequestIDHeader, requestID)
+	ctx.Next()
+}
+
+// isRequestIDValid checks that the request ID is not too long, and only contains printable ASCII characters, so it is safe to log and pass to hooks
+func isRequestIDValid(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func GetRequestIDFromContext(ctx *gin.Context) string {
+	return ctx.GetString(requestIDKey)
+}
 
 func goodLoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
@@ -26,9 +62,10 @@ func goodLoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
 		subLogger := logger.With(
 			zap.String("method", ctx.Request.Method),
 			zap.String("path", path),
-			zap.String("query", ctx.Request.URL.RawQuery),
+			zap.String("query", redactedQuery(ctx.Request.URL)),
 			zap.String("ip", ctx.ClientIP()),
 			zap.String("user-agent", ctx.Request.UserAgent()),
+			zap.String("requestID", GetRequestIDFromContext(ctx)),
 		)
 
 		ctx.Set(loggerKey, subLogger)
@@ -55,6 +92,16 @@ func goodLoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
 	}
 }
 
+// redactedQuery returns the raw query of the URL with the presigned token redacted, so it does not end up in the logs
+func redactedQuery(u *url.URL) string {
+	q := u.Query()
+	if !q.Has(authentication.PresignedTokenQueryParam) {
+		return u.RawQuery
+	}
+	q.Set(authentication.PresignedTokenQueryParam, "REDACTED")
+	return q.Encode()
+}
+
 func GetLoggerFromContext(ctx *gin.Context) *zap.Logger { // This one panics
 	var logger *zap.Logger
 	l, ok := ctx.Get(loggerKey)
@@ -27,6 +27,40 @@ type LiveReq struct {
 	ID string `json:"id"`
 }
 
+// PresignReq is sent by the user to request a presigned token for a deployment
+type PresignReq struct {
+	Capabilities []string `json:"capabilities"`
+	TTL          string   `json:"ttl,omitempty"` // Go duration string (e.g. "15m"), the configured default is used if empty
+}
+
+// PresignResp contains the presigned token, it should be passed in the token query parameter
+type PresignResp struct {
+	Token        string    `json:"token"`
+	Capabilities []string  `json:"capabilities"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// SiteResp describes a site, the config uses the same keys as the config file
+type SiteResp struct {
+	Name    string         `json:"name"`
+	Managed bool           `json:"managed"` // only managed sites can be changed through the API
+	Config  map[string]any `json:"config"`
+}
+
+// QueuedEventResp describes an event in the hook queue, or a dead letter
+type QueuedEventResp struct {
+	ID           string    `json:"id"`
+	Hook         string    `json:"hook"`
+	Site         string    `json:"site"`
+	DeploymentID string    `json:"deployment_id,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"` // of the request that triggered the event
+	CreatedAt    time.Time `json:"created_at"`
+	Attempts     uint      `json:"attempts"` // failed attempts so far
+	NextAttempt  time.Time `json:"next_attempt"`
+	LastError    string    `json:"last_error,omitempty"`
+	FailedHooks  []string  `json:"failed_hooks,omitempty"` // paths of the hooks to be retried
+}
+
 // ErrorResp sent on any error happened
 type ErrorResp struct {
 	Err    error
@@ -50,3 +84,59 @@ func (r ErrorResp) MarshalJSON() ([]byte, error) {
 		Error: errorMsg,
 	})
 }
+
+// HookResultResp is the outcome of a single hook, included in HookPreventedResp
+type HookResultResp struct {
+	Index      int    `json:"index"`
+	ExitCode   int    `json:"exit_code"` // the status code of the response for webhooks
+	TimedOut   bool   `json:"timed_out"`
+	Ignored    bool   `json:"ignored"`
+	Err        string `json:"err,omitempty"` // the hook could not be run at all
+	Stdout     string `json:"stdout"`        // the response body for webhooks
+	Stderr     string `json:"stderr"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// HookPreventedResp is sent instead of ErrorResp when an action is prevented by a hook, if expose_output is enabled for the site
+type HookPreventedResp struct {
+	Err     string           `json:"err"`
+	Hook    string           `json:"hook"`
+	Results []HookResultResp `json:"results"`
+}
+
+// PolicyRule is a single "p" rule of the authorization policy, used both in requests and responses
+type PolicyRule struct {
+	Sub string `json:"sub"`
+	Obj string `json:"obj"`
+	Act string `json:"act"`
+	Eft string `json:"eft,omitempty"` // defaults to allow in requests
+}
+
+// GroupingRule is a single "g" rule of the authorization policy, used both in requests and responses
+type GroupingRule struct {
+	Sub   string `json:"sub"`
+	Group string `json:"group"`
+}
+
+// SiteGroupingRule is a single "g2" rule of the authorization policy, used both in requests and responses
+type SiteGroupingRule struct {
+	Site  string `json:"site"`
+	Group string `json:"group"`
+}
+
+// PolicyCheckResp is the result of a dry-run policy check
+type PolicyCheckResp struct {
+	User       string `json:"user"`
+	Obj        string `json:"obj"`
+	Act        string `json:"act"`
+	Deployment string `json:"deployment,omitempty"`
+	Allowed    bool   `json:"allowed"`
+}
+
+// MeResp tells the user who they are, and what they are allowed to do
+type MeResp struct {
+	Username   string              `json:"username"`
+	Provider   string              `json:"provider"`
+	Sites      map[string][]string `json:"sites"`       // site name -> allowed acts, sites without any allowed acts are left out
+	GlobalActs []string            `json:"global_acts"` // acts allowed on the global object
+}
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/marcsello/webploy-server/authorization"
+	"github.com/marcsello/webploy-server/deployment/info"
+	"github.com/marcsello/webploy-server/site"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+func listPolicies(pm authorization.PolicyManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		policies := pm.GetPolicies()
+		resp := make([]PolicyRule, len(policies))
+		for i, p := range policies {
+			resp[i] = PolicyRule{Sub: p.Sub, Obj: p.Obj, Act: p.Act, Eft: p.Eft}
+		}
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
+
+func bindPolicyRule(ctx *gin.Context) (authorization.PolicyRule, bool) {
+	l := GetLoggerFromContext(ctx)
+
+	var req PolicyRule
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+		l.Warn("Could not un-marshal request body", zap.Error(err))
+		return authorization.PolicyRule{}, false
+	}
+
+	if req.Eft == "" {
+		req.Eft = authorization.EffectAllow
+	}
+
+	return authorization.PolicyRule{Sub: req.Sub, Obj: req.Obj, Act: req.Act, Eft: req.Eft}, true
+}
+
+func addPolicy(pm authorization.PolicyManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+
+		rule, ok := bindPolicyRule(ctx)
+		if !ok {
+			return
+		}
+
+		err := rule.Validate()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+			l.Warn("Invalid policy rule", zap.Error(err))
+			return
+		}
+
+		var added bool
+		added, err = pm.AddPolicy(rule)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to add policy rule", zap.Error(err))
+			return
+		}
+		if !added {
+			ctx.JSON(http.StatusConflict, ErrorResp{ErrStr: "rule already exists"})
+			l.Debug("Policy rule already exists")
+			return
+		}
+
+		ctx.Status(http.StatusCreated)
+	}
+}
+
+func removePolicy(pm authorization.PolicyManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+
+		rule, ok := bindPolicyRule(ctx)
+		if !ok {
+			return
+		}
+
+		removed, err := pm.RemovePolicy(rule)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to remove policy rule", zap.Error(err))
+			return
+		}
+		if !removed {
+			ctx.JSON(http.StatusNotFound, ErrorResp{ErrStr: "rule does not exist"})
+			l.Debug("Policy rule does not exist")
+			return
+		}
+
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+func listGroupings(pm authorization.PolicyManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		groupings := pm.GetGroupings()
+		resp := make([]GroupingRule, len(groupings))
+		for i, g := range groupings {
+			resp[i] = GroupingRule{Sub: g.Sub, Group: g.Group}
+		}
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
+
+func bindGroupingRule(ctx *gin.Context) (authorization.GroupingRule, bool) {
+	l := GetLoggerFromContext(ctx)
+
+	var req GroupingRule
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+		l.Warn("Could not un-marshal request body", zap.Error(err))
+		return authorization.GroupingRule{}, false
+	}
+
+	return authorization.GroupingRule{Sub: req.Sub, Group: req.Group}, true
+}
+
+func addGrouping(pm authorization.PolicyManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+
+		rule, ok := bindGroupingRule(ctx)
+		if !ok {
+			return
+		}
+
+		err := rule.Validate()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+			l.Warn("Invalid grouping rule", zap.Error(err))
+			return
+		}
+
+		var added bool
+		added, err = pm.AddGrouping(rule)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to add grouping rule", zap.Error(err))
+			return
+		}
+		if !added {
+			ctx.JSON(http.StatusConflict, ErrorResp{ErrStr: "rule already exists"})
+			l.Debug("Grouping rule already exists")
+			return
+		}
+
+		ctx.Status(http.StatusCreated)
+	}
+}
+
+func removeGrouping(pm authorization.PolicyManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+
+		rule, ok := bindGroupingRule(ctx)
+		if !ok {
+			return
+		}
+
+		removed, err := pm.RemoveGrouping(rule)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to remove grouping rule", zap.Error(err))
+			return
+		}
+		if !removed {
+			ctx.JSON(http.StatusNotFound, ErrorResp{ErrStr: "rule does not exist"})
+			l.Debug("Grouping rule does not exist")
+			return
+		}
+
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+func listSiteGroupings(pm authorization.PolicyManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		groupings := pm.GetSiteGroupings()
+		resp := make([]SiteGroupingRule, len(groupings))
+		for i, g := range groupings {
+			resp[i] = SiteGroupingRule{Site: g.Site, Group: g.Group}
+		}
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
+
+func bindSiteGroupingRule(ctx *gin.Context) (authorization.SiteGroupingRule, bool) {
+	l := GetLoggerFromContext(ctx)
+
+	var req SiteGroupingRule
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+		l.Warn("Could not un-marshal request body", zap.Error(err))
+		return authorization.SiteGroupingRule{}, false
+	}
+
+	return authorization.SiteGroupingRule{Site: req.Site, Group: req.Group}, true
+}
+
+func addSiteGrouping(pm authorization.PolicyManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+
+		rule, ok := bindSiteGroupingRule(ctx)
+		if !ok {
+			return
+		}
+
+		err := rule.Validate()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+			l.Warn("Invalid site grouping rule", zap.Error(err))
+			return
+		}
+
+		var added bool
+		added, err = pm.AddSiteGrouping(rule)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to add site grouping rule", zap.Error(err))
+			return
+		}
+		if !added {
+			ctx.JSON(http.StatusConflict, ErrorResp{ErrStr: "rule already exists"})
+			l.Debug("Site grouping rule already exists")
+			return
+		}
+
+		ctx.Status(http.StatusCreated)
+	}
+}
+
+func removeSiteGrouping(pm authorization.PolicyManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+
+		rule, ok := bindSiteGroupingRule(ctx)
+		if !ok {
+			return
+		}
+
+		removed, err := pm.RemoveSiteGrouping(rule)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to remove site grouping rule", zap.Error(err))
+			return
+		}
+		if !removed {
+			ctx.JSON(http.StatusNotFound, ErrorResp{ErrStr: "rule does not exist"})
+			l.Debug("Site grouping rule does not exist")
+			return
+		}
+
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// checkPolicy is a dry-run check, to help debugging denied requests: would user be allowed to do act on site?
+// If the deployment query parameter is set, the attributes of that deployment are considered as well.
+func checkPolicy(siteProvider site.Provider, pm authorization.PolicyManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+
+		user := ctx.Query("user")
+		obj := ctx.Query("site")
+		act := ctx.Query("act")
+		if user == "" || obj == "" || act == "" {
+			ctx.JSON(http.StatusBadRequest, ErrorResp{ErrStr: "user, site and act query parameters are required"})
+			l.Warn("Missing query parameters for policy check")
+			return
+		}
+
+		var dep authorization.DeploymentAttributes
+		deploymentID := ctx.Query("deployment")
+		if deploymentID != "" {
+			s, ok := siteProvider.GetSite(obj)
+			if !ok {
+				ctx.JSON(http.StatusNotFound, ErrorResp{ErrStr: "site does not exist"})
+				l.Warn("Site for the deployment attributes does not exist", zap.String("checkObj", obj))
+				return
+			}
+
+			d, err := s.GetDeployment(deploymentID)
+			if err != nil {
+				if errors.Is(err, site.ErrInvalidID) {
+					ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+					l.Warn("Tried to use an invalid deployment ID", zap.Error(err))
+					return
+				}
+				if errors.Is(err, site.ErrDeploymentNotExists) {
+					ctx.JSON(http.StatusNotFound, ErrorResp{Err: err})
+					l.Warn("Deployment for the attributes does not exist", zap.Error(err))
+					return
+				}
+				ctx.Status(http.StatusInternalServerError)
+				l.Error("Failed to load deployment", zap.Error(err))
+				return
+			}
+
+			var i info.DeploymentInfo
+			i, err = d.GetFullInfo()
+			if err != nil {
+				ctx.Status(http.StatusInternalServerError)
+				l.Error("Failed to read info for deployment", zap.Error(err))
+				return
+			}
+			dep = authorization.NewDeploymentAttributes(deploymentID, i, time.Now())
+		}
+
+		allowed, err := pm.Check(user, obj, act, dep)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to check policy", zap.Error(err))
+			return
+		}
+
+		l.Debug("Dry-run policy check completed", zap.String("checkUser", user), zap.String("checkObj", obj), zap.String("checkAct", act), zap.Bool("allowed", allowed))
+		ctx.JSON(http.StatusOK, PolicyCheckResp{
+			User:       user,
+			Obj:        obj,
+			Act:        act,
+			Deployment: deploymentID,
+			Allowed:    allowed,
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/marcsello/webploy-server/authentication"
+	"github.com/marcsello/webploy-server/authorization"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// presignDeployment issues a presigned token for the deployment, that can be handed to someone without an account
+func presignDeployment(presigner *authentication.Presigner) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+		user, ok := authentication.GetAuthenticatedUser(ctx)
+		if !ok {
+			// should not happen
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Could not load user from context")
+			return
+		}
+
+		s := GetSiteFromContext(ctx)
+		dID, d := GetDeploymentFromContext(ctx)
+
+		var req PresignReq
+		err := ctx.BindJSON(&req)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+			l.Warn("Could not un-marshal request body", zap.Error(err))
+			return
+		}
+
+		var ttl time.Duration
+		if req.TTL != "" {
+			ttl, err = time.ParseDuration(req.TTL)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+				l.Warn("Could not parse ttl", zap.Error(err))
+				return
+			}
+		}
+
+		i, err := d.GetFullInfo()
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to read info for deployment", zap.Error(err))
+			return
+		}
+
+		dep := authorization.NewDeploymentAttributes(dID, i, time.Now())
+
+		var allowed bool
+		allowed, err = authorization.EnforceAuthZ(ctx, authorization.ActPresignDeployment, dep)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to check for permission", zap.Error(err))
+			return
+		}
+		if !allowed {
+			ctx.JSON(http.StatusForbidden, ErrorResp{ErrStr: "no permission to presign this"})
+			l.Warn("Prevented presigning the deployment, the user have no permission to do this", zap.String("deploymentCreator", i.Creator))
+			return
+		}
+
+		// the user can not grant more than what they are allowed to do
+		for _, capability := range req.Capabilities {
+			acts, known := authorization.PresignCapabilityActs[capability]
+			if !known {
+				ctx.JSON(http.StatusBadRequest, ErrorResp{Err: authentication.ErrPresignUnknownCapability, ErrStr: capability})
+				l.Warn("Unknown capability requested", zap.String("capability", capability))
+				return
+			}
+
+			allowed, err = ternaryEnforce(ctx, i.Creator == user, acts[0], acts[1], dep)
+			if err != nil {
+				ctx.Status(http.StatusInternalServerError)
+				l.Error("Failed to check for permission", zap.Error(err))
+				return
+			}
+			if !allowed {
+				ctx.JSON(http.StatusForbidden, ErrorResp{ErrStr: "no permission to grant " + capability})
+				l.Warn("Prevented presigning the deployment, the user is not allowed to do what they want to grant", zap.String("capability", capability), zap.String("deploymentCreator", i.Creator))
+				return
+			}
+		}
+
+		if i.IsFinished() {
+			ctx.JSON(http.StatusConflict, ErrorResp{ErrStr: "deployment is already finished"})
+			l.Warn("Tried to presign an already finished deployment")
+			return
+		}
+
+		var token string
+		var claims authentication.PresignedClaims
+		token, claims, err = presigner.Sign(s.GetName(), dID, req.Capabilities, ttl)
+		if err != nil {
+			if errors.Is(err, authentication.ErrPresignTTLTooLong) || errors.Is(err, authentication.ErrPresignUnknownCapability) {
+				ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+				l.Warn("Invalid presign request", zap.Error(err))
+				return
+			}
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to sign token", zap.Error(err))
+			return
+		}
+
+		l.Info("Presigned token issued", zap.Strings("capabilities", claims.Capabilities), zap.Time("expiresAt", claims.ExpiresAt))
+		ctx.JSON(http.StatusCreated, PresignResp{
+			Token:        token,
+			Capabilities: claims.Capabilities,
+			ExpiresAt:    claims.ExpiresAt,
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/default_deployment"
+	"github.com/marcsello/webploy-server/site"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"net/http"
+)
+
+// SiteConfigRequestBodySize is larger than the default, as site configs may contain a bunch of hooks
+const SiteConfigRequestBodySize = 16 * 1024
+
+// bindSiteConfig decodes the site config from the request body. The body is decoded the same way as a site in the config file (JSON is valid YAML),
+// so the same keys, the site defaults and the templates apply.
+func bindSiteConfig(ctx *gin.Context, siteProvider site.Provider) (config.SiteConfig, error) {
+	var layer config.SiteConfigLayer
+	decoder := yaml.NewDecoder(ctx.Request.Body)
+	decoder.KnownFields(true)
+	err := decoder.Decode(&layer)
+	if err != nil {
+		return config.SiteConfig{}, err
+	}
+	return siteProvider.ResolveSite(&layer)
+}
+
+// newSiteResp converts the site config to the same representation as it appears in the config file, secrets are redacted
+func newSiteResp(cfg config.SiteConfig, managed bool) (SiteResp, error) {
+	raw, err := yaml.Marshal(config.Redact(cfg))
+	if err != nil {
+		return SiteResp{}, err
+	}
+	var cfgMap map[string]any
+	err = yaml.Unmarshal(raw, &cfgMap)
+	if err != nil {
+		return SiteResp{}, err
+	}
+	return SiteResp{
+		Name:    cfg.Name,
+		Managed: managed,
+		Config:  cfgMap,
+	}, nil
+}
+
+// respondSiteManagementError maps the errors of the site provider to responses
+func respondSiteManagementError(ctx *gin.Context, l *zap.Logger, err error) {
+	switch {
+	case errors.Is(err, site.ErrSiteNotExists):
+		ctx.JSON(http.StatusNotFound, ErrorResp{Err: err})
+		l.Warn("Site does not exist", zap.Error(err))
+	case errors.Is(err, site.ErrSiteExists), errors.Is(err, site.ErrSiteNotManaged), errors.Is(err, site.ErrManagedSitesDisabled), errors.Is(err, site.ErrPathConflict):
+		ctx.JSON(http.StatusConflict, ErrorResp{Err: err})
+		l.Warn("Site can not be changed", zap.Error(err))
+	case errors.Is(err, site.ErrSiteNameInvalid), errors.Is(err, site.ErrSiteNameImmutable), errors.Is(err, site.ErrLinkNameImmutable), errors.Is(err, site.ErrRestrictedSiteField),
+		errors.Is(err, site.ErrPathImmutable), errors.Is(err, site.ErrLinkDirFilesystem):
+		ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+		l.Warn("Invalid site config", zap.Error(err))
+	default:
+		ctx.Status(http.StatusInternalServerError)
+		l.Error("Failed to change site", zap.Error(err))
+	}
+}
+
+func listSites(siteProvider site.Provider) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+
+		names := siteProvider.GetAllSiteNames()
+		resp := make([]SiteResp, 0, len(names))
+		for _, name := range names {
+			s, ok := siteProvider.GetSite(name)
+			if !ok {
+				continue // removed in the meantime
+			}
+			sr, err := newSiteResp(s.GetConfig(), siteProvider.IsManaged(name))
+			if err != nil {
+				ctx.Status(http.StatusInternalServerError)
+				l.Error("Failed to convert site config", zap.String("siteName", name), zap.Error(err))
+				return
+			}
+			resp = append(resp, sr)
+		}
+
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
+
+func readSite(siteProvider site.Provider) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+		name := ctx.Param("siteName")
+
+		s, ok := siteProvider.GetSite(name)
+		if !ok {
+			ctx.JSON(http.StatusNotFound, ErrorResp{Err: site.ErrSiteNotExists})
+			l.Warn("Trying to access a non-existing site")
+			return
+		}
+
+		resp, err := newSiteResp(s.GetConfig(), siteProvider.IsManaged(name))
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to convert site config", zap.Error(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
+
+func createSite(siteProvider site.Provider) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+
+		cfg, err := bindSiteConfig(ctx, siteProvider)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+			l.Warn("Could not un-marshal request body", zap.Error(err))
+			return
+		}
+		l = l.With(zap.String("siteName", cfg.Name))
+
+		var s site.Site
+		var first bool
+		s, first, err = siteProvider.AddSite(cfg)
+		if err != nil {
+			respondSiteManagementError(ctx, l, err)
+			return
+		}
+		l.Info("New site created!")
+
+		if first {
+			err = default_deployment.CreateDefaultDeployment(s, l)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, ErrorResp{ErrStr: "site is created, but creating the default deployment failed"})
+				l.Error("Failed to create the default deployment for the new site", zap.Error(err))
+				return
+			}
+		}
+
+		var resp SiteResp
+		resp, err = newSiteResp(s.GetConfig(), true)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to convert site config", zap.Error(err))
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, resp)
+	}
+}
+
+func updateSite(siteProvider site.Provider) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+		name := ctx.Param("siteName")
+		l = l.With(zap.String("siteName", name))
+
+		cfg, err := bindSiteConfig(ctx, siteProvider)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+			l.Warn("Could not un-marshal request body", zap.Error(err))
+			return
+		}
+		if cfg.Name == "" {
+			cfg.Name = name // the name may be omitted from the body
+		}
+		if cfg.Name != name {
+			err = fmt.Errorf("%w: %s", site.ErrSiteNameImmutable, cfg.Name)
+			ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+			l.Warn("Tried to rename a site", zap.Error(err))
+			return
+		}
+
+		// the secrets are redacted when reading the site, keep the current ones if they are sent back that way
+		if s, ok := siteProvider.GetSite(name); ok {
+			err = config.RestoreRedacted(&cfg, s.GetConfig())
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, ErrorResp{Err: err})
+				l.Warn("Redacted secret can not be restored", zap.Error(err))
+				return
+			}
+		}
+
+		err = siteProvider.UpdateSite(cfg)
+		if err != nil {
+			respondSiteManagementError(ctx, l, err)
+			return
+		}
+		l.Info("Site updated!")
+
+		var resp SiteResp
+		resp, err = newSiteResp(cfg, true)
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			l.Error("Failed to convert site config", zap.Error(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
+
+func removeSite(siteProvider site.Provider) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l := GetLoggerFromContext(ctx)
+		name := ctx.Param("siteName")
+		l = l.With(zap.String("siteName", name))
+
+		err := siteProvider.RemoveSite(name)
+		if err != nil {
+			respondSiteManagementError(ctx, l, err)
+			return
+		}
+
+		l.Info("Site removed!")
+		ctx.Status(http.StatusNoContent)
+	}
+}
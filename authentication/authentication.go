@@ -4,20 +4,32 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/marcsello/webploy-server/config"
+	"go.uber.org/zap"
 )
 
-func InitAuthenticator(cfg config.AuthenticationProviderConfig) (Provider, error) {
+// InitAuthenticator creates the authentication provider, if presigner is not nil, requests with presigned tokens are authenticated by it
+func InitAuthenticator(cfg config.AuthenticationProviderConfig, presigner *Presigner, logger *zap.Logger) (Provider, error) {
 
 	// For now we support ONLY ONE auth provider to be configured
 	// Otherwise we would have to deal with realms
 
+	var provider Provider
 	if cfg.BasicAuth != nil {
 		// load basic auth module
-		return NewBasicAuthProvider(cfg.BasicAuth.HTPasswdFile)
+		var err error
+		provider, err = NewBasicAuthProvider(cfg.BasicAuth.HTPasswdFile, cfg.BasicAuth.Lockout, logger)
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		return nil, fmt.Errorf("authentcation method not defined")
 	}
 
+	if presigner != nil {
+		provider = NewPresignedAuthProvider(presigner, provider, logger)
+	}
+
+	return provider, nil
 }
 
 func GetAuthenticatedUser(ctx *gin.Context) (string, bool) {
@@ -32,3 +44,31 @@ func GetAuthenticatedUser(ctx *gin.Context) (string, bool) {
 	}
 	return username, true
 }
+
+// GetAuthenticationProviderName returns the name of the provider that authenticated the user of the current request
+func GetAuthenticationProviderName(ctx *gin.Context) (string, bool) {
+	p, ok := ctx.Get(ContextAuthenticationProviderKey)
+	if !ok {
+		return "", false
+	}
+	var providerName string
+	providerName, ok = p.(string)
+	if !ok {
+		return "", false
+	}
+	return providerName, true
+}
+
+// GetPresignedClaims returns the claims of the presigned token, if the current request was authenticated by one
+func GetPresignedClaims(ctx *gin.Context) (PresignedClaims, bool) {
+	val, ok := ctx.Get(ContextPresignedClaimsKey)
+	if !ok {
+		return PresignedClaims{}, false
+	}
+	var claims PresignedClaims
+	claims, ok = val.(PresignedClaims)
+	if !ok {
+		return PresignedClaims{}, false
+	}
+	return claims, true
+}
@@ -5,26 +5,62 @@ import (
 	"fmt"
 	httpAuth "github.com/abbot/go-http-auth"
 	"github.com/gin-gonic/gin"
+	"github.com/marcsello/webploy-server/config"
+	"go.uber.org/zap"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 type BasicAuthProvider struct {
-	creds                 map[string]string
+	htpasswdFilePath      string
+	creds                 atomic.Pointer[map[string]string] // swapped as a whole on reload, so requests always see a consistent set of credentials
 	wwwAuthenticateHeader string
+	ipLockout             *lockoutTracker
+	userLockout           *lockoutTracker
+	logger                *zap.Logger
 }
 
-func NewBasicAuthProvider(htpasswdFilePath string) (*BasicAuthProvider, error) {
+func NewBasicAuthProvider(htpasswdFilePath string, lockoutCfg config.BasicAuthLockoutConfig, logger *zap.Logger) (*BasicAuthProvider, error) {
 	creds, err := loadBasicAuthCredentials(htpasswdFilePath)
 	if err != nil {
 		return nil, err
 	}
 
-	return &BasicAuthProvider{
-		creds:                 creds,
+	ba := &BasicAuthProvider{
+		htpasswdFilePath:      htpasswdFilePath,
 		wwwAuthenticateHeader: `Basic realm="webploy", charset="UTF-8"`,
-	}, nil
+		ipLockout:             newLockoutTracker(lockoutCfg.IPThreshold, lockoutCfg.BaseDuration, lockoutCfg.MaxDuration, lockoutCfg.ForgetAfter),
+		userLockout:           newLockoutTracker(lockoutCfg.UserThreshold, lockoutCfg.BaseDuration, lockoutCfg.MaxDuration, lockoutCfg.ForgetAfter),
+		logger:                logger,
+	}
+	ba.creds.Store(&creds)
+	return ba, nil
+
+}
+
+// Reload re-reads the htpasswd file, and replaces the credentials in use. If the new file is invalid, the old credentials are kept.
+func (ba *BasicAuthProvider) Reload() error {
+	l := ba.logger.With(zap.String("htpasswdFilePath", ba.htpasswdFilePath))
+
+	creds, err := loadBasicAuthCredentials(ba.htpasswdFilePath)
+	if err != nil {
+		l.Error("Failed to reload htpasswd file, keeping the previously loaded credentials", zap.Error(err))
+		return err
+	}
 
+	ba.creds.Store(&creds)
+	l.Info("Credentials reloaded from htpasswd file", zap.Int("usersCount", len(creds)))
+	return nil
+}
+
+// CheckHtpasswdFile parses the htpasswd file the same way the provider does, and returns the number of users in it
+func CheckHtpasswdFile(htpasswdFilePath string) (int, error) {
+	creds, err := loadBasicAuthCredentials(htpasswdFilePath)
+	return len(creds), err
 }
 
 func loadBasicAuthCredentials(htpasswdFilePath string) (map[string]string, error) {
@@ -79,20 +115,66 @@ func validateUserPass(users map[string]string, username, password string) bool {
 	return true
 }
 
+// abortLockedOut responds with 429, telling the client when to retry
+func abortLockedOut(ctx *gin.Context, retryAfter time.Duration) {
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	ctx.AbortWithStatus(http.StatusTooManyRequests)
+}
+
+// recordFailure registers the failed attempt for both the IP and the username, returns the longest lockout it triggered (if any)
+func (ba *BasicAuthProvider) recordFailure(ip, username string) time.Duration {
+	l := ba.logger.With(zap.String("ip", ip), zap.String("username", username))
+
+	ipFailures, ipLockoutDuration := ba.ipLockout.recordFailure(ip)
+	if ipLockoutDuration > 0 {
+		l.Warn("Too many failed authentication attempts from IP address, locking it out", zap.Uint("failures", ipFailures), zap.Duration("lockoutDuration", ipLockoutDuration))
+	}
+
+	userFailures, userLockoutDuration := ba.userLockout.recordFailure(username)
+	if userLockoutDuration > 0 {
+		l.Warn("Too many failed authentication attempts for username, locking it out", zap.Uint("failures", userFailures), zap.Duration("lockoutDuration", userLockoutDuration))
+	}
+
+	return max(ipLockoutDuration, userLockoutDuration)
+}
+
 func (ba *BasicAuthProvider) NewMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		username, password, ok := ctx.Request.BasicAuth()
+		if !ok {
+			// no credentials provided, this is not counted as a failed attempt, as clients usually try without credentials first
+			ctx.Header("WWW-Authenticate", ba.wwwAuthenticateHeader)
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		// lockouts are checked before the credentials, so that locked out clients can not make us spend time on hashing
+		ip := ctx.ClientIP()
+		retryAfter := max(ba.ipLockout.lockedFor(ip), ba.userLockout.lockedFor(username))
+		if retryAfter > 0 {
+			ba.logger.Debug("Rejected authentication attempt while locked out", zap.String("ip", ip), zap.String("username", username), zap.Duration("retryAfter", retryAfter))
+			abortLockedOut(ctx, retryAfter)
+			return
+		}
 
 		// we only validate usernames coming from "outside", the software may still use "invalid" usernames internally (e.g.: system user has prefix)
-		if !ok || ValidateUsername(username) != nil || !validateUserPass(ba.creds, username, password) {
-			// no credentials provided, or the provided credentials are bad
+		if ValidateUsername(username) != nil || !validateUserPass(*ba.creds.Load(), username, password) {
+			// the provided credentials are bad
+			lockoutDuration := ba.recordFailure(ip, username)
+			if lockoutDuration > 0 {
+				abortLockedOut(ctx, lockoutDuration)
+				return
+			}
 			ctx.Header("WWW-Authenticate", ba.wwwAuthenticateHeader)
 			ctx.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
 		// Auth successful
+		ba.ipLockout.recordSuccess(ip)
+		ba.userLockout.recordSuccess(username)
 
 		ctx.Set(ContextAuthenticatedUserKey, username)
+		ctx.Set(ContextAuthenticationProviderKey, BasicAuthProviderName)
 	}
 }
@@ -0,0 +1,183 @@
+package authentication
+
+import (
+	"crypto/sha1" // #nosec G505 only used to produce test fixtures
+	"encoding/base64"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func shaHtpasswdLine(username, password string) string {
+	sum := sha1.Sum([]byte(password)) // #nosec G401
+	return fmt.Sprintf("%s:{SHA}%s\n", username, base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+func TestBasicAuthProvider_Reload(t *testing.T) {
+	testCases := []struct {
+		name               string
+		newContent         string
+		expectedErr        error
+		expectedValidUsers map[string]string
+	}{
+		{
+			name:        "happy__user_added",
+			newContent:  shaHtpasswdLine("test1", "pass1") + shaHtpasswdLine("test2", "pass2"),
+			expectedErr: nil,
+			expectedValidUsers: map[string]string{
+				"test1": "pass1",
+				"test2": "pass2",
+			},
+		},
+		{
+			name:        "happy__password_changed",
+			newContent:  shaHtpasswdLine("test1", "newpass"),
+			expectedErr: nil,
+			expectedValidUsers: map[string]string{
+				"test1": "newpass",
+			},
+		},
+		{
+			name:        "error__invalid_username_keeps_old",
+			newContent:  shaHtpasswdLine("_system", "pass1"),
+			expectedErr: fmt.Errorf("has invalid prefix"),
+			expectedValidUsers: map[string]string{
+				"test1": "pass1",
+			},
+		},
+		{
+			name:        "error__empty_password_keeps_old",
+			newContent:  "test1:\n",
+			expectedErr: fmt.Errorf("empty password field"),
+			expectedValidUsers: map[string]string{
+				"test1": "pass1",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			htpasswdFile := path.Join(t.TempDir(), ".htpasswd")
+			assert.NoError(t, os.WriteFile(htpasswdFile, []byte(shaHtpasswdLine("test1", "pass1")), 0o600))
+
+			ba, err := NewBasicAuthProvider(htpasswdFile, config.BasicAuthLockoutConfig{}, zaptest.NewLogger(t))
+			assert.NoError(t, err)
+			assert.True(t, validateUserPass(*ba.creds.Load(), "test1", "pass1"))
+
+			assert.NoError(t, os.WriteFile(htpasswdFile, []byte(tc.newContent), 0o600))
+			err = ba.Reload()
+
+			if tc.expectedErr != nil {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+
+			creds := *ba.creds.Load()
+			assert.Len(t, creds, len(tc.expectedValidUsers))
+			for username, password := range tc.expectedValidUsers {
+				assert.True(t, validateUserPass(creds, username, password))
+			}
+		})
+	}
+}
+
+func TestBasicAuthProvider_Lockout(t *testing.T) {
+	type attempt struct {
+		ip             string
+		username       string
+		password       string
+		expectedStatus int
+	}
+
+	testCases := []struct {
+		name     string
+		attempts []attempt
+	}{
+		{
+			name: "ip__locked_out_after_threshold",
+			attempts: []attempt{
+				{ip: "10.0.0.1", username: "a", password: "bad", expectedStatus: http.StatusUnauthorized},
+				{ip: "10.0.0.1", username: "b", password: "bad", expectedStatus: http.StatusUnauthorized},
+				{ip: "10.0.0.1", username: "c", password: "bad", expectedStatus: http.StatusTooManyRequests},
+				{ip: "10.0.0.1", username: "test1", password: "pass1", expectedStatus: http.StatusTooManyRequests}, // valid credentials are rejected as well
+				{ip: "10.0.0.2", username: "test1", password: "pass1", expectedStatus: http.StatusOK},
+			},
+		},
+		{
+			name: "user__locked_out_after_threshold",
+			attempts: []attempt{
+				{ip: "10.0.0.1", username: "test1", password: "bad", expectedStatus: http.StatusUnauthorized},
+				{ip: "10.0.0.2", username: "test1", password: "bad", expectedStatus: http.StatusTooManyRequests},
+				{ip: "10.0.0.3", username: "test1", password: "pass1", expectedStatus: http.StatusTooManyRequests},
+				{ip: "10.0.0.3", username: "test2", password: "pass2", expectedStatus: http.StatusOK},
+			},
+		},
+		{
+			name: "success__resets_failures",
+			attempts: []attempt{
+				{ip: "10.0.0.1", username: "test1", password: "bad", expectedStatus: http.StatusUnauthorized},
+				{ip: "10.0.0.1", username: "test1", password: "pass1", expectedStatus: http.StatusOK},
+				{ip: "10.0.0.1", username: "test1", password: "bad", expectedStatus: http.StatusUnauthorized},
+				{ip: "10.0.0.1", username: "test1", password: "pass1", expectedStatus: http.StatusOK},
+			},
+		},
+		{
+			name: "missing_credentials__not_counted",
+			attempts: []attempt{
+				{ip: "10.0.0.1", expectedStatus: http.StatusUnauthorized},
+				{ip: "10.0.0.1", expectedStatus: http.StatusUnauthorized},
+				{ip: "10.0.0.1", expectedStatus: http.StatusUnauthorized},
+				{ip: "10.0.0.1", username: "test1", password: "pass1", expectedStatus: http.StatusOK},
+			},
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			htpasswdFile := path.Join(t.TempDir(), ".htpasswd")
+			assert.NoError(t, os.WriteFile(htpasswdFile, []byte(shaHtpasswdLine("test1", "pass1")+shaHtpasswdLine("test2", "pass2")), 0o600))
+
+			ba, err := NewBasicAuthProvider(htpasswdFile, config.BasicAuthLockoutConfig{
+				IPThreshold:   3,
+				UserThreshold: 2,
+				BaseDuration:  time.Minute,
+				MaxDuration:   time.Hour,
+				ForgetAfter:   time.Hour,
+			}, zaptest.NewLogger(t))
+			assert.NoError(t, err)
+
+			r := gin.New()
+			r.Use(ba.NewMiddleware())
+			r.GET("/", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			for i, a := range tc.attempts {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = a.ip + ":1234"
+				if a.username != "" {
+					req.SetBasicAuth(a.username, a.password)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				assert.Equal(t, a.expectedStatus, w.Code, "attempt %d", i)
+				if a.expectedStatus == http.StatusTooManyRequests {
+					assert.Equal(t, "60", w.Header().Get("Retry-After"), "attempt %d", i)
+				}
+			}
+		})
+	}
+}
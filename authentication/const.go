@@ -1,5 +1,19 @@
 package authentication
 
 const ContextAuthenticatedUserKey = "AuthenticatedUser"
+const ContextAuthenticationProviderKey = "AuthenticationProvider"
+const ContextPresignedClaimsKey = "PresignedClaims"
+
+// BasicAuthProviderName is the name of the basic auth provider, same as its key in the config
+const BasicAuthProviderName = "basic_auth"
+
+// PresignedProviderName is the name of the provider authenticating requests with presigned tokens
+const PresignedProviderName = "presigned"
+
+// PresignedTokenQueryParam is the query parameter carrying the presigned token
+const PresignedTokenQueryParam = "token"
 
 const SystemPrefix = "_" // may be used when defining groups in the policy too
+
+// PresignedUser is the synthetic user of requests authenticated by a presigned token
+const PresignedUser = SystemPrefix + "presigned"
@@ -0,0 +1,139 @@
+package authentication
+
+import (
+	"sync"
+	"time"
+)
+
+// lockoutTracker counts failed authentication attempts per key (e.g. IP address or username), and locks out keys that reached the threshold.
+// Each consecutive lockout of the same key doubles its duration, up to maxDuration.
+type lockoutTracker struct {
+	threshold    uint // 0 disables tracking
+	baseDuration time.Duration
+	maxDuration  time.Duration
+	forgetAfter  time.Duration // entries are dropped after this much time without a failure (and not being locked out)
+
+	mu        sync.Mutex
+	entries   map[string]*lockoutEntry
+	lastSweep time.Time
+	now       func() time.Time // replaceable for testing
+}
+
+type lockoutEntry struct {
+	failures    uint // failures since the last lockout
+	lockouts    uint // number of lockouts so far, used as the exponent of the lockout duration
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func newLockoutTracker(threshold uint, baseDuration, maxDuration, forgetAfter time.Duration) *lockoutTracker {
+	return &lockoutTracker{
+		threshold:    threshold,
+		baseDuration: baseDuration,
+		maxDuration:  maxDuration,
+		forgetAfter:  forgetAfter,
+		entries:      make(map[string]*lockoutEntry),
+		now:          time.Now,
+	}
+}
+
+func (lt *lockoutTracker) enabled() bool {
+	return lt.threshold > 0
+}
+
+// lockedFor returns how long the key is still locked out, 0 if it is not locked out
+func (lt *lockoutTracker) lockedFor(key string) time.Duration {
+	if !lt.enabled() {
+		return 0
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	e, ok := lt.entries[key]
+	if !ok {
+		return 0
+	}
+
+	remaining := e.lockedUntil.Sub(lt.now())
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// recordFailure registers a failed attempt for the key. Returns the number of failures since the last lockout, and the duration of the lockout if this failure triggered one (0 otherwise).
+func (lt *lockoutTracker) recordFailure(key string) (uint, time.Duration) {
+	if !lt.enabled() {
+		return 0, 0
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	now := lt.now()
+	lt.sweep(now)
+
+	e, ok := lt.entries[key]
+	if !ok || lt.expired(e, now) {
+		e = &lockoutEntry{}
+		lt.entries[key] = e
+	}
+
+	e.failures++
+	e.lastFailure = now
+
+	if e.failures < lt.threshold {
+		return e.failures, 0
+	}
+
+	failures := e.failures
+	duration := lt.lockoutDuration(e.lockouts)
+	e.lockedUntil = now.Add(duration)
+	e.lockouts++
+	e.failures = 0
+	return failures, duration
+}
+
+// recordSuccess forgets all previous failures of the key
+func (lt *lockoutTracker) recordSuccess(key string) {
+	if !lt.enabled() {
+		return
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	delete(lt.entries, key)
+}
+
+func (lt *lockoutTracker) lockoutDuration(previousLockouts uint) time.Duration {
+	duration := lt.baseDuration
+	for i := uint(0); i < previousLockouts; i++ {
+		duration *= 2
+		if duration >= lt.maxDuration {
+			return lt.maxDuration
+		}
+	}
+	if duration > lt.maxDuration {
+		return lt.maxDuration
+	}
+	return duration
+}
+
+// sweep drops the entries that are no longer relevant, so the map does not grow indefinitely. Must be called with the mutex held.
+func (lt *lockoutTracker) sweep(now time.Time) {
+	if now.Sub(lt.lastSweep) < lt.forgetAfter {
+		return
+	}
+	lt.lastSweep = now
+
+	for key, e := range lt.entries {
+		if lt.expired(e, now) {
+			delete(lt.entries, key)
+		}
+	}
+}
+
+func (lt *lockoutTracker) expired(e *lockoutEntry, now time.Time) bool {
+	return now.After(e.lockedUntil) && now.Sub(e.lastFailure) > lt.forgetAfter
+}
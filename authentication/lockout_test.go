@@ -0,0 +1,76 @@
+package authentication
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLockoutTracker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	lt := newLockoutTracker(2, time.Minute, 3*time.Minute, time.Hour)
+	lt.now = func() time.Time { return now }
+
+	// first lockout
+	failures, d := lt.recordFailure("key")
+	assert.Equal(t, uint(1), failures)
+	assert.Zero(t, d)
+	assert.Zero(t, lt.lockedFor("key"))
+
+	failures, d = lt.recordFailure("key")
+	assert.Equal(t, uint(2), failures)
+	assert.Equal(t, time.Minute, d)
+	assert.Equal(t, time.Minute, lt.lockedFor("key"))
+	assert.Zero(t, lt.lockedFor("other"))
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, 30*time.Second, lt.lockedFor("key"))
+
+	// consecutive lockouts are doubled, until the max
+	now = now.Add(time.Minute)
+	assert.Zero(t, lt.lockedFor("key"))
+	lt.recordFailure("key")
+	_, d = lt.recordFailure("key")
+	assert.Equal(t, 2*time.Minute, d)
+
+	now = now.Add(5 * time.Minute)
+	lt.recordFailure("key")
+	_, d = lt.recordFailure("key")
+	assert.Equal(t, 3*time.Minute, d)
+
+	// forgotten after a while
+	now = now.Add(2 * time.Hour)
+	failures, d = lt.recordFailure("key")
+	assert.Equal(t, uint(1), failures)
+	assert.Zero(t, d)
+
+	// success resets
+	lt.recordSuccess("key")
+	failures, _ = lt.recordFailure("key")
+	assert.Equal(t, uint(1), failures)
+}
+
+func TestLockoutTracker_Disabled(t *testing.T) {
+	lt := newLockoutTracker(0, time.Minute, time.Hour, time.Hour)
+	for i := 0; i < 100; i++ {
+		failures, d := lt.recordFailure("key")
+		assert.Zero(t, failures)
+		assert.Zero(t, d)
+	}
+	assert.Zero(t, lt.lockedFor("key"))
+	assert.Empty(t, lt.entries)
+}
+
+func TestLockoutTracker_Sweep(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	lt := newLockoutTracker(5, time.Minute, time.Hour, time.Hour)
+	lt.now = func() time.Time { return now }
+
+	lt.recordFailure("a")
+	lt.recordFailure("b")
+	assert.Len(t, lt.entries, 2)
+
+	now = now.Add(2 * time.Hour)
+	lt.recordFailure("c")
+	assert.Len(t, lt.entries, 1)
+}
@@ -0,0 +1,51 @@
+package authentication
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// PresignedAuthProvider authenticates requests carrying a presigned token, and passes every other request to the fallback provider
+type PresignedAuthProvider struct {
+	presigner *Presigner
+	fallback  Provider
+	logger    *zap.Logger
+}
+
+func NewPresignedAuthProvider(presigner *Presigner, fallback Provider, logger *zap.Logger) *PresignedAuthProvider {
+	return &PresignedAuthProvider{
+		presigner: presigner,
+		fallback:  fallback,
+		logger:    logger,
+	}
+}
+
+func (pp *PresignedAuthProvider) NewMiddleware() gin.HandlerFunc {
+	fallbackMiddleware := pp.fallback.NewMiddleware()
+
+	return func(ctx *gin.Context) {
+		token := ctx.Query(PresignedTokenQueryParam)
+		if token == "" {
+			fallbackMiddleware(ctx)
+			return
+		}
+
+		// once a token is provided, we do not fall back to other methods, even if it is invalid
+		claims, err := pp.presigner.Verify(token)
+		if err != nil {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			pp.logger.Warn("Rejected presigned token", zap.String("ip", ctx.ClientIP()), zap.Error(err))
+			return
+		}
+
+		ctx.Set(ContextAuthenticatedUserKey, PresignedUser)
+		ctx.Set(ContextAuthenticationProviderKey, PresignedProviderName)
+		ctx.Set(ContextPresignedClaimsKey, claims)
+	}
+}
+
+// Reload reloads the fallback provider, the presigner has nothing to reload
+func (pp *PresignedAuthProvider) Reload() error {
+	return pp.fallback.Reload()
+}
@@ -0,0 +1,70 @@
+package authentication
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fallbackProviderMock struct{}
+
+func (fallbackProviderMock) NewMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(ContextAuthenticatedUserKey, "fallback_user")
+	}
+}
+
+func (fallbackProviderMock) Reload() error {
+	return nil
+}
+
+func TestPresignedAuthProvider_NewMiddleware(t *testing.T) {
+	presigner, err := NewPresigner(testPresignSecret, 15*time.Minute, time.Hour)
+	assert.NoError(t, err)
+	validToken, _, err := presigner.Sign("my_site", "deployment1", []string{PresignCapabilityUpload}, 0)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedUser   string
+	}{
+		{name: "happy__no_token_falls_back", query: "", expectedStatus: http.StatusOK, expectedUser: "fallback_user"},
+		{name: "happy__valid_token", query: "?token=" + validToken, expectedStatus: http.StatusOK, expectedUser: PresignedUser},
+		{name: "error__invalid_token_does_not_fall_back", query: "?token=garbage", expectedStatus: http.StatusUnauthorized},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pp := NewPresignedAuthProvider(presigner, fallbackProviderMock{}, zaptest.NewLogger(t))
+
+			var user string
+			var claims PresignedClaims
+			var presigned bool
+			r := gin.New()
+			r.Use(pp.NewMiddleware())
+			r.GET("/", func(ctx *gin.Context) {
+				user, _ = GetAuthenticatedUser(ctx)
+				claims, presigned = GetPresignedClaims(ctx)
+				ctx.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tc.query, nil))
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Equal(t, tc.expectedUser, user)
+			assert.Equal(t, tc.expectedUser == PresignedUser, presigned)
+			if presigned {
+				assert.Equal(t, "deployment1", claims.DeploymentID)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package authentication
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/marcsello/webploy-server/config"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// PresignCapabilityUpload allows uploading files into the deployment
+	PresignCapabilityUpload = "upload"
+
+	// PresignCapabilityFinish allows finishing the deployment
+	PresignCapabilityFinish = "finish"
+)
+
+// PresignCapabilities are all the capabilities a presigned token can grant
+var PresignCapabilities = []string{PresignCapabilityUpload, PresignCapabilityFinish}
+
+// PresignMinSecretLength is the minimum length of the secret used for signing, in bytes
+const PresignMinSecretLength = 32
+
+var ErrPresignedTokenInvalid = errors.New("invalid presigned token")
+var ErrPresignedTokenExpired = errors.New("presigned token expired")
+var ErrPresignTTLTooLong = errors.New("requested ttl exceeds the maximum allowed")
+var ErrPresignUnknownCapability = errors.New("unknown capability")
+
+// PresignedClaims are the contents of a presigned token, they are signed, so they can not be altered by the holder of the token
+type PresignedClaims struct {
+	Site         string    `json:"site"`
+	DeploymentID string    `json:"deployment_id"`
+	Capabilities []string  `json:"capabilities"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Presigner issues and verifies HMAC signed tokens granting a limited set of capabilities on a single deployment
+type Presigner struct {
+	secret     []byte
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+	now        func() time.Time // replaceable for testing
+}
+
+func NewPresigner(secret []byte, defaultTTL, maxTTL time.Duration) (*Presigner, error) {
+	if len(secret) < PresignMinSecretLength {
+		return nil, fmt.Errorf("presign secret must be at least %d bytes long", PresignMinSecretLength)
+	}
+	if defaultTTL <= 0 || maxTTL <= 0 || defaultTTL > maxTTL {
+		return nil, fmt.Errorf("invalid presign ttl configuration: default ttl must be positive and not larger than the max ttl")
+	}
+	return &Presigner{
+		secret:     secret,
+		defaultTTL: defaultTTL,
+		maxTTL:     maxTTL,
+		now:        time.Now,
+	}, nil
+}
+
+// InitPresigner creates a Presigner from the config, returns nil if presigned tokens are not configured
+func InitPresigner(cfg *config.PresignedConfig) (*Presigner, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	if cfg.Secret != "" && cfg.SecretFile != "" {
+		return nil, fmt.Errorf("only one of secret and secret_file can be set for presigned tokens")
+	}
+	secret, err := config.ReadSecret(cfg.Secret, cfg.SecretFile)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("either secret or secret_file must be set for presigned tokens")
+	}
+
+	return NewPresigner(secret, cfg.DefaultTTL, cfg.MaxTTL)
+}
+
+func (p *Presigner) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Sign issues a new token for the deployment, granting the capabilities until ttl elapses. Zero ttl means the default ttl.
+func (p *Presigner) Sign(site, deploymentID string, capabilities []string, ttl time.Duration) (string, PresignedClaims, error) {
+	if ttl == 0 {
+		ttl = p.defaultTTL
+	}
+	if ttl < 0 || ttl > p.maxTTL {
+		return "", PresignedClaims{}, ErrPresignTTLTooLong
+	}
+	if len(capabilities) == 0 {
+		return "", PresignedClaims{}, fmt.Errorf("%w: no capabilities requested", ErrPresignUnknownCapability)
+	}
+	for _, c := range capabilities {
+		if !slices.Contains(PresignCapabilities, c) {
+			return "", PresignedClaims{}, fmt.Errorf("%w: %s", ErrPresignUnknownCapability, c)
+		}
+	}
+
+	claims := PresignedClaims{
+		Site:         site,
+		DeploymentID: deploymentID,
+		Capabilities: capabilities,
+		ExpiresAt:    p.now().Add(ttl).UTC().Truncate(time.Second),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", PresignedClaims{}, err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(p.sign(payload))
+	return token, claims, nil
+}
+
+// Verify checks the signature and the expiry of the token, and returns the claims in it
+func (p *Presigner) Verify(token string) (PresignedClaims, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return PresignedClaims{}, ErrPresignedTokenInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return PresignedClaims{}, ErrPresignedTokenInvalid
+	}
+	var signature []byte
+	signature, err = base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return PresignedClaims{}, ErrPresignedTokenInvalid
+	}
+
+	if !hmac.Equal(signature, p.sign(payload)) {
+		return PresignedClaims{}, ErrPresignedTokenInvalid
+	}
+
+	// the payload is trusted from this point on
+	var claims PresignedClaims
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return PresignedClaims{}, ErrPresignedTokenInvalid
+	}
+
+	if !p.now().Before(claims.ExpiresAt) {
+		return PresignedClaims{}, ErrPresignedTokenExpired
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,132 @@
+package authentication
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPresignSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestPresigner_SignVerify(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name         string
+		capabilities []string
+		ttl          time.Duration
+		tamper       func(token string) string
+		verifyAt     time.Time
+		signErr      error
+		verifyErr    error
+	}{
+		{
+			name:         "happy__default_ttl",
+			capabilities: []string{PresignCapabilityUpload},
+			verifyAt:     now.Add(14 * time.Minute),
+		},
+		{
+			name:         "happy__custom_ttl",
+			capabilities: []string{PresignCapabilityUpload, PresignCapabilityFinish},
+			ttl:          time.Hour,
+			verifyAt:     now.Add(59 * time.Minute),
+		},
+		{
+			name:         "error__expired",
+			capabilities: []string{PresignCapabilityUpload},
+			verifyAt:     now.Add(15 * time.Minute),
+			verifyErr:    ErrPresignedTokenExpired,
+		},
+		{
+			name:         "error__ttl_too_long",
+			capabilities: []string{PresignCapabilityUpload},
+			ttl:          2 * time.Hour,
+			signErr:      ErrPresignTTLTooLong,
+		},
+		{
+			name:         "error__unknown_capability",
+			capabilities: []string{"delete"},
+			signErr:      ErrPresignUnknownCapability,
+		},
+		{
+			name:    "error__no_capabilities",
+			signErr: ErrPresignUnknownCapability,
+		},
+		{
+			name:         "error__tampered_payload",
+			capabilities: []string{PresignCapabilityUpload},
+			tamper: func(token string) string {
+				_, sig, _ := strings.Cut(token, ".")
+				p, _ := NewPresigner(testPresignSecret, 15*time.Minute, time.Hour)
+				other, _, _ := p.Sign("other_site", "other_deployment", []string{PresignCapabilityUpload}, 0)
+				payload, _, _ := strings.Cut(other, ".")
+				return payload + "." + sig
+			},
+			verifyAt:  now,
+			verifyErr: ErrPresignedTokenInvalid,
+		},
+		{
+			name:         "error__garbage",
+			capabilities: []string{PresignCapabilityUpload},
+			tamper: func(token string) string {
+				return "garbage"
+			},
+			verifyAt:  now,
+			verifyErr: ErrPresignedTokenInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := NewPresigner(testPresignSecret, 15*time.Minute, time.Hour)
+			assert.NoError(t, err)
+			p.now = func() time.Time { return now }
+
+			token, claims, err := p.Sign("my_site", "deployment1", tc.capabilities, tc.ttl)
+			if tc.signErr != nil {
+				assert.ErrorIs(t, err, tc.signErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			if tc.tamper != nil {
+				token = tc.tamper(token)
+			}
+
+			p.now = func() time.Time { return tc.verifyAt }
+			var verifiedClaims PresignedClaims
+			verifiedClaims, err = p.Verify(token)
+			if tc.verifyErr != nil {
+				assert.ErrorIs(t, err, tc.verifyErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, claims, verifiedClaims)
+				assert.Equal(t, "my_site", verifiedClaims.Site)
+				assert.Equal(t, "deployment1", verifiedClaims.DeploymentID)
+				assert.Equal(t, tc.capabilities, verifiedClaims.Capabilities)
+			}
+		})
+	}
+}
+
+func TestPresigner_DifferentSecret(t *testing.T) {
+	p1, err := NewPresigner(testPresignSecret, 15*time.Minute, time.Hour)
+	assert.NoError(t, err)
+	p2, err := NewPresigner([]byte("fedcba9876543210fedcba9876543210"), 15*time.Minute, time.Hour)
+	assert.NoError(t, err)
+
+	token, _, err := p1.Sign("my_site", "deployment1", []string{PresignCapabilityUpload}, 0)
+	assert.NoError(t, err)
+
+	_, err = p2.Verify(token)
+	assert.ErrorIs(t, err, ErrPresignedTokenInvalid)
+}
+
+func TestNewPresigner(t *testing.T) {
+	_, err := NewPresigner([]byte("short"), 15*time.Minute, time.Hour)
+	assert.Error(t, err)
+
+	_, err = NewPresigner(testPresignSecret, 2*time.Hour, time.Hour)
+	assert.Error(t, err)
+}
@@ -5,4 +5,7 @@ import "github.com/gin-gonic/gin"
 // Provider is a simple authentication provider interface to integrate with Gin
 type Provider interface {
 	NewMiddleware() gin.HandlerFunc
+
+	// Reload re-reads the credentials of the provider from their source, the previous ones are kept on failure
+	Reload() error
 }
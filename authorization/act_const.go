@@ -39,4 +39,49 @@ const (
 
 	// ActReadDeployment ability to read information of any deployment
 	ActReadDeployment = "read-deployment"
+
+	// ActPresignDeployment ability to issue presigned tokens for a deployment, the issuer must also be allowed to do what the token grants
+	ActPresignDeployment = "presign-deployment"
+
+	// ActManagePolicy ability to list, add and remove policy rules through the API (global act, see GlobalObject)
+	ActManagePolicy = "manage-policy"
+
+	// ActManageSites ability to list, create, update and remove sites through the API (global act, see GlobalObject)
+	ActManageSites = "manage-sites"
+
+	// ActManageLogging ability to read and change the log levels at runtime through the API (global act, see GlobalObject)
+	ActManageLogging = "manage-logging"
+
+	// ActManageHookQueue ability to list the queued hook events and the dead letters, and to retry or remove dead letters through the API (global act, see GlobalObject)
+	ActManageHookQueue = "manage-hook-queue"
 )
+
+// GlobalObject is the object used in the policy for acts that are not related to any site.
+// Site names can not start with a dot, so this never collides with a site name.
+const GlobalObject = ".global"
+
+// SiteActs are the acts that can be granted on sites
+var SiteActs = []string{
+	ActCreateDeployment,
+	ActUploadSelf,
+	ActUploadAny,
+	ActFinishSelf,
+	ActFinishAny,
+	ActAbortSelf,
+	ActAbortAny,
+	ActDeleteSelf,
+	ActDeleteAny,
+	ActReadLive,
+	ActUpdateLive,
+	ActListDeployments,
+	ActReadDeployment,
+	ActPresignDeployment,
+}
+
+// GlobalActs are the acts that can be granted on the GlobalObject only
+var GlobalActs = []string{
+	ActManagePolicy,
+	ActManageSites,
+	ActManageLogging,
+	ActManageHookQueue,
+}
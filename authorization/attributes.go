@@ -0,0 +1,71 @@
+package authorization
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/marcsello/webploy-server/deployment/info"
+	"time"
+)
+
+// DeploymentAttributes are passed to the enforcer as the 4th element of the request (r.dep) for deployment-scoped acts.
+// For acts that are not related to a specific deployment, the zero value is passed (ID is empty).
+//
+// These can be used in the matchers of a custom model, e.g.: r.dep.Creator, r.dep.State, r.dep.Age or metaField(r.dep, "branch")
+type DeploymentAttributes struct {
+	ID      string
+	Creator string
+	State   string
+	Age     float64 // seconds elapsed since the deployment was created
+	Meta    string  // the raw meta, as provided by the creator
+
+	metaFields map[string]string // populated if the meta is a JSON object, use metaField(r.dep, "name") to access it
+}
+
+// NewDeploymentAttributes collects the attributes of a deployment, now is the reference time used for calculating the age
+func NewDeploymentAttributes(id string, i info.DeploymentInfo, now time.Time) DeploymentAttributes {
+	return DeploymentAttributes{
+		ID:         id,
+		Creator:    i.Creator,
+		State:      string(i.State),
+		Age:        now.Sub(i.CreatedAt).Seconds(),
+		Meta:       i.Meta,
+		metaFields: parseMetaFields(i.Meta),
+	}
+}
+
+// parseMetaFields tries to parse the meta as a flat JSON object, values that are not strings are converted to their JSON representation.
+// Returns nil if the meta is not a JSON object.
+func parseMetaFields(meta string) map[string]string {
+	var raw map[string]json.RawMessage
+	if json.Unmarshal([]byte(meta), &raw) != nil {
+		return nil
+	}
+
+	fields := make(map[string]string, len(raw))
+	for k, v := range raw {
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			fields[k] = s
+		} else {
+			fields[k] = string(v)
+		}
+	}
+	return fields
+}
+
+// metaFieldFunc is registered as metaField(r.dep, "name") for the matchers, it returns an empty string for missing fields
+func metaFieldFunc(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("metaField expects 2 arguments, got %d", len(args))
+	}
+	dep, ok := args[0].(DeploymentAttributes)
+	if !ok {
+		return nil, fmt.Errorf("the first argument of metaField must be r.dep")
+	}
+	var name string
+	name, ok = args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("the second argument of metaField must be a string")
+	}
+	return dep.metaFields[name], nil
+}
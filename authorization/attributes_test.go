@@ -0,0 +1,45 @@
+package authorization
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMetaFieldFunc(t *testing.T) {
+	testCases := []struct {
+		name     string
+		meta     string
+		field    string
+		expected string
+	}{
+		{name: "happy__string", meta: `{"branch":"main"}`, field: "branch", expected: "main"},
+		{name: "happy__number", meta: `{"pr":42}`, field: "pr", expected: "42"},
+		{name: "happy__bool", meta: `{"hotfix":true}`, field: "hotfix", expected: "true"},
+		{name: "happy__missing_field", meta: `{"branch":"main"}`, field: "commit", expected: ""},
+		{name: "happy__not_json", meta: "just some text", field: "branch", expected: ""},
+		{name: "happy__json_array", meta: `["main"]`, field: "branch", expected: ""},
+		{name: "happy__empty", meta: "", field: "branch", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dep := DeploymentAttributes{Meta: tc.meta, metaFields: parseMetaFields(tc.meta)}
+			value, err := metaFieldFunc(dep, tc.field)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, value)
+		})
+	}
+
+	t.Run("error__wrong_arg_count", func(t *testing.T) {
+		_, err := metaFieldFunc(DeploymentAttributes{})
+		assert.Error(t, err)
+	})
+	t.Run("error__not_attributes", func(t *testing.T) {
+		_, err := metaFieldFunc("test", "branch")
+		assert.Error(t, err)
+	})
+	t.Run("error__name_not_string", func(t *testing.T) {
+		_, err := metaFieldFunc(DeploymentAttributes{}, 1)
+		assert.Error(t, err)
+	})
+}
@@ -7,5 +7,5 @@ import (
 )
 
 func InitAuthorizator(cfg config.AuthorizationProviderConfig, logger *zap.Logger) (Provider, error) {
-	return NewCasbinProvider(cfg.PolicyFile, logger)
+	return NewCasbinProvider(cfg.ModelFile, cfg.PolicyFile, logger)
 }
@@ -0,0 +1,157 @@
+package authorization
+
+import (
+	"errors"
+	"go.uber.org/zap"
+)
+
+func (cb *CasbinProvider) GetPolicies() []PolicyRule {
+	rules := cb.enforcer.GetPolicy()
+	policies := make([]PolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule) != 4 {
+			continue // validated on load, should not happen
+		}
+		policies = append(policies, PolicyRule{Sub: rule[0], Obj: rule[1], Act: rule[2], Eft: rule[3]})
+	}
+	return policies
+}
+
+func (cb *CasbinProvider) GetGroupings() []GroupingRule {
+	rules := cb.enforcer.GetGroupingPolicy()
+	groupings := make([]GroupingRule, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule) != 2 {
+			continue // validated on load, should not happen
+		}
+		groupings = append(groupings, GroupingRule{Sub: rule[0], Group: rule[1]})
+	}
+	return groupings
+}
+
+func (cb *CasbinProvider) GetSiteGroupings() []SiteGroupingRule {
+	rules := cb.enforcer.GetNamedGroupingPolicy("g2")
+	groupings := make([]SiteGroupingRule, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule) != 2 {
+			continue // validated on load, should not happen
+		}
+		groupings = append(groupings, SiteGroupingRule{Site: rule[0], Group: rule[1]})
+	}
+	return groupings
+}
+
+// modifyAndSave runs the modification on the in-memory policy, then writes the whole policy to the policy file.
+// If saving fails, the modification is reverted.
+func (cb *CasbinProvider) modifyAndSave(modify func() (bool, error), revert func() (bool, error)) (bool, error) {
+	cb.modifyMutex.Lock()
+	defer cb.modifyMutex.Unlock()
+
+	changed, err := modify()
+	if err != nil {
+		return false, err
+	}
+	if !changed {
+		return false, nil // nothing to save
+	}
+
+	err = cb.enforcer.SavePolicy()
+	if err != nil {
+		cb.logger.Error("Failed to save policy file, reverting change", zap.String("policyFile", cb.policyFile), zap.Error(err))
+		_, revertErr := revert()
+		return false, errors.Join(err, revertErr)
+	}
+
+	return true, nil
+}
+
+func (cb *CasbinProvider) AddPolicy(rule PolicyRule) (bool, error) {
+	err := rule.Validate()
+	if err != nil {
+		return false, err
+	}
+
+	r := rule.asSlice()
+	changed, err := cb.modifyAndSave(
+		func() (bool, error) { return cb.enforcer.AddPolicy(r) },
+		func() (bool, error) { return cb.enforcer.RemovePolicy(r) },
+	)
+	if changed {
+		cb.logger.Info("Policy rule added", zap.Strings("rule", r))
+	}
+	return changed, err
+}
+
+func (cb *CasbinProvider) RemovePolicy(rule PolicyRule) (bool, error) {
+	r := rule.asSlice()
+	changed, err := cb.modifyAndSave(
+		func() (bool, error) { return cb.enforcer.RemovePolicy(r) },
+		func() (bool, error) { return cb.enforcer.AddPolicy(r) },
+	)
+	if changed {
+		cb.logger.Info("Policy rule removed", zap.Strings("rule", r))
+	}
+	return changed, err
+}
+
+func (cb *CasbinProvider) AddGrouping(rule GroupingRule) (bool, error) {
+	err := rule.Validate()
+	if err != nil {
+		return false, err
+	}
+
+	r := rule.asSlice()
+	changed, err := cb.modifyAndSave(
+		func() (bool, error) { return cb.enforcer.AddGroupingPolicy(r) },
+		func() (bool, error) { return cb.enforcer.RemoveGroupingPolicy(r) },
+	)
+	if changed {
+		cb.logger.Info("Grouping rule added", zap.Strings("rule", r))
+	}
+	return changed, err
+}
+
+func (cb *CasbinProvider) RemoveGrouping(rule GroupingRule) (bool, error) {
+	r := rule.asSlice()
+	changed, err := cb.modifyAndSave(
+		func() (bool, error) { return cb.enforcer.RemoveGroupingPolicy(r) },
+		func() (bool, error) { return cb.enforcer.AddGroupingPolicy(r) },
+	)
+	if changed {
+		cb.logger.Info("Grouping rule removed", zap.Strings("rule", r))
+	}
+	return changed, err
+}
+
+func (cb *CasbinProvider) AddSiteGrouping(rule SiteGroupingRule) (bool, error) {
+	err := rule.Validate()
+	if err != nil {
+		return false, err
+	}
+
+	r := rule.asSlice()
+	changed, err := cb.modifyAndSave(
+		func() (bool, error) { return cb.enforcer.AddNamedGroupingPolicy("g2", r) },
+		func() (bool, error) { return cb.enforcer.RemoveNamedGroupingPolicy("g2", r) },
+	)
+	if changed {
+		cb.logger.Info("Site grouping rule added", zap.Strings("rule", r))
+	}
+	return changed, err
+}
+
+func (cb *CasbinProvider) RemoveSiteGrouping(rule SiteGroupingRule) (bool, error) {
+	r := rule.asSlice()
+	changed, err := cb.modifyAndSave(
+		func() (bool, error) { return cb.enforcer.RemoveNamedGroupingPolicy("g2", r) },
+		func() (bool, error) { return cb.enforcer.AddNamedGroupingPolicy("g2", r) },
+	)
+	if changed {
+		cb.logger.Info("Site grouping rule removed", zap.Strings("rule", r))
+	}
+	return changed, err
+}
+
+func (cb *CasbinProvider) Check(user, obj, act string, dep DeploymentAttributes) (bool, error) {
+	return cb.enforce(user, obj, act, dep)
+}
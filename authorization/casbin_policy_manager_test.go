@@ -0,0 +1,70 @@
+package authorization
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCasbinProvider_PolicyManagement(t *testing.T) {
+	policyFile := path.Join(t.TempDir(), "policy.csv")
+	assert.NoError(t, os.WriteFile(policyFile, []byte("p,deployer,my_site,create-deployment,allow\n"), 0o600))
+
+	cb, err := NewCasbinProvider("", policyFile, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+
+	allowed, err := cb.Check("user", "my_site", ActCreateDeployment, DeploymentAttributes{})
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	// add a grouping and a policy
+	changed, err := cb.AddGrouping(GroupingRule{Sub: "user", Group: "deployer"})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	changed, err = cb.AddPolicy(PolicyRule{Sub: "deployer", Obj: "my_site", Act: ActReadLive, Eft: EffectAllow})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	// adding the same again does nothing
+	changed, err = cb.AddPolicy(PolicyRule{Sub: "deployer", Obj: "my_site", Act: ActReadLive, Eft: EffectAllow})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// invalid rules are rejected
+	_, err = cb.AddPolicy(PolicyRule{Sub: "deployer", Obj: "my_site", Act: "fly", Eft: EffectAllow})
+	assert.Error(t, err)
+
+	allowed, err = cb.Check("user", "my_site", ActCreateDeployment, DeploymentAttributes{})
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	// changes are persisted to the file
+	cb2, err := NewCasbinProvider("", policyFile, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []PolicyRule{
+		{Sub: "deployer", Obj: "my_site", Act: ActCreateDeployment, Eft: EffectAllow},
+		{Sub: "deployer", Obj: "my_site", Act: ActReadLive, Eft: EffectAllow},
+	}, cb2.GetPolicies())
+	assert.ElementsMatch(t, []GroupingRule{{Sub: "user", Group: "deployer"}}, cb2.GetGroupings())
+
+	// remove them
+	changed, err = cb.RemovePolicy(PolicyRule{Sub: "deployer", Obj: "my_site", Act: ActCreateDeployment, Eft: EffectAllow})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	changed, err = cb.RemoveGrouping(GroupingRule{Sub: "user", Group: "nonexistent"})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	allowed, err = cb.Check("user", "my_site", ActCreateDeployment, DeploymentAttributes{})
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	assert.NoError(t, cb2.Reload())
+	assert.ElementsMatch(t, []PolicyRule{
+		{Sub: "deployer", Obj: "my_site", Act: ActReadLive, Eft: EffectAllow},
+	}, cb2.GetPolicies())
+}
@@ -6,50 +6,250 @@ import (
 	"github.com/casbin/casbin/v2"
 	"github.com/casbin/casbin/v2/model"
 	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	"github.com/casbin/casbin/v2/util"
 	"github.com/gin-gonic/gin"
 	"github.com/marcsello/webploy-server/authentication"
 	"go.uber.org/zap"
 	"net/http"
+	"os"
+	"slices"
+	"sync"
 )
 
 type CasbinProvider struct {
-	enforcer *casbin.Enforcer
-	logger   *zap.Logger
+	modelText                string
+	policyFile               string
+	enforcer                 *casbin.SyncedEnforcer // the synced enforcer makes it safe to reload the policy while requests are being served
+	withDeploymentAttributes bool                   // whether the model expects deployment attributes as r.dep
+	coarseMatcher            string                 // used to check deployment-scoped acts before the deployment is known, empty if the model's own matcher does not use the attributes
+	modifyMutex              sync.Mutex             // serializes policy modifications, so that the in-memory change and saving it to the file happens together
+	logger                   *zap.Logger
 }
 
 //go:embed model.conf
 var modelConfigString string
 
-func NewCasbinProvider(policyFile string, logger *zap.Logger) (*CasbinProvider, error) {
+// NewCasbinProvider creates a new casbin based authorization provider, if modelFile is empty, the embedded model is used
+func NewCasbinProvider(modelFile, policyFile string, logger *zap.Logger) (*CasbinProvider, error) {
 	var err error
 
+	modelText := modelConfigString
+	if modelFile != "" {
+		var modelBytes []byte
+		modelBytes, err = os.ReadFile(modelFile) // #nosec G304
+		if err != nil {
+			logger.Error("Failed to read the casbin model file", zap.String("modelFile", modelFile), zap.Error(err))
+			return nil, err
+		}
+		modelText = string(modelBytes)
+	}
+
 	var m model.Model
-	m, err = model.NewModelFromString(modelConfigString)
+	m, err = model.NewModelFromString(modelText)
 	if err != nil {
 		logger.Error("Failed to build the casbin model", zap.Error(err))
 		return nil, err
 	}
 
+	var withDeploymentAttributes bool
+	withDeploymentAttributes, err = validateModel(m)
+	if err != nil {
+		logger.Error("The casbin model is not compatible with webploy", zap.Error(err))
+		return nil, err
+	}
+
+	var coarseMatcher string
+	coarseMatcher, err = getCoarseMatcher(m, withDeploymentAttributes)
+	if err != nil {
+		logger.Error("The casbin model is not compatible with webploy", zap.Error(err))
+		return nil, err
+	}
+
+	err = validatePolicyFile(modelText, policyFile)
+	if err != nil {
+		logger.Error("The policy file is invalid", zap.String("policyFile", policyFile), zap.Error(err))
+		return nil, err
+	}
+
 	adapter := fileadapter.NewAdapter(policyFile)
 
-	var e *casbin.Enforcer
-	e, err = casbin.NewEnforcer(m, adapter)
+	var e *casbin.SyncedEnforcer
+	e, err = casbin.NewSyncedEnforcer(m, adapter)
 	if err != nil {
 		logger.Error("Failed to initialize casbin enforcer", zap.Error(err))
 		return nil, err
 	}
 
+	// allow glob patterns in place of site names in site groups, so policies and site groups can use patterns like team-a-*
+	e.AddNamedMatchingFunc("g2", "globMatch", globMatch)
+	err = e.BuildRoleLinks()
+	if err != nil {
+		logger.Error("Failed to build role links", zap.Error(err))
+		return nil, err
+	}
+
+	// allow accessing parsed meta fields in the matchers
+	e.AddFunction("metaField", metaFieldFunc)
+
+	logger.Debug("Casbin enforcer initialized", zap.String("modelFile", modelFile), zap.Bool("withDeploymentAttributes", withDeploymentAttributes))
+
 	return &CasbinProvider{
-		enforcer: e,
-		logger:   logger,
+		modelText:                modelText,
+		policyFile:               policyFile,
+		enforcer:                 e,
+		withDeploymentAttributes: withDeploymentAttributes,
+		coarseMatcher:            coarseMatcher,
+		logger:                   logger,
 	}, nil
 }
 
+// validateModel checks if the parts of the model, that webploy depends on, are defined as expected.
+// Returns true when the request definition includes the deployment attributes.
+func validateModel(m model.Model) (bool, error) {
+	pTokens := m["p"]["p"].Tokens
+	if !slices.Equal(pTokens, []string{"p_sub", "p_obj", "p_act", "p_eft"}) {
+		return false, fmt.Errorf("policy definition must be p = sub, obj, act, eft")
+	}
+
+	for _, ptype := range []string{"g", "g2"} {
+		if _, ok := m["g"][ptype]; !ok {
+			return false, fmt.Errorf("role definition %s must be defined", ptype)
+		}
+	}
+
+	rTokens := m["r"]["r"].Tokens
+	switch {
+	case slices.Equal(rTokens, []string{"r_sub", "r_obj", "r_act"}):
+		return false, nil
+	case slices.Equal(rTokens, []string{"r_sub", "r_obj", "r_act", "r_dep"}):
+		return true, nil
+	default:
+		return false, fmt.Errorf("request definition must be either r = sub, obj, act or r = sub, obj, act, dep")
+	}
+}
+
+// CoarseMatcherName is the optional matcher of a custom model, that decides deployment-scoped acts without looking at the deployment attributes
+const CoarseMatcherName = "m2"
+
+// getCoarseMatcher returns the matcher used for the coarse checks of NewDeploymentMiddleware. Models using the deployment attributes may define it as m2,
+// otherwise the matcher of the embedded model is used.
+func getCoarseMatcher(m model.Model, withDeploymentAttributes bool) (string, error) {
+	if !withDeploymentAttributes {
+		return "", nil // the matcher can not depend on the attributes
+	}
+	if coarse, ok := m["m"][CoarseMatcherName]; ok {
+		return coarse.Value, nil
+	}
+
+	defaultModel, err := model.NewModelFromString(modelConfigString)
+	if err != nil {
+		return "", err
+	}
+	return defaultModel["m"]["m"].Value, nil
+}
+
+// enforceCoarse tells if the act is allowed for at least some deployments of the site, the attributes of the actual deployment must be checked later
+func (cb *CasbinProvider) enforceCoarse(user, obj, act string) (bool, error) {
+	if cb.coarseMatcher == "" {
+		return cb.enforce(user, obj, act, DeploymentAttributes{})
+	}
+	return cb.enforcer.EnforceWithMatcher(cb.coarseMatcher, user, obj, act, DeploymentAttributes{})
+}
+
+// enforce passes the deployment attributes to the enforcer only if the model expects it
+func (cb *CasbinProvider) enforce(user, obj, act string, dep DeploymentAttributes) (bool, error) {
+	if cb.withDeploymentAttributes {
+		return cb.enforcer.Enforce(user, obj, act, dep)
+	}
+	return cb.enforcer.Enforce(user, obj, act)
+}
+
+// validatePolicyFile loads the policy file into a scratch model, so that a broken file never reaches the enforcer
+func validatePolicyFile(modelText, policyFile string) error {
+	m, err := model.NewModelFromString(modelText)
+	if err != nil {
+		return err
+	}
+
+	err = fileadapter.NewAdapter(policyFile).LoadPolicy(m)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range m.GetPolicy("p", "p") {
+		if len(rule) != 4 {
+			return fmt.Errorf("invalid policy rule %v: expected 4 fields, got %d", rule, len(rule))
+		}
+		if rule[3] != "allow" && rule[3] != "deny" {
+			return fmt.Errorf("invalid policy rule %v: effect must be either allow or deny", rule)
+		}
+	}
+
+	for _, ptype := range []string{"g", "g2"} {
+		for _, rule := range m.GetPolicy("g", ptype) {
+			if len(rule) != 2 {
+				return fmt.Errorf("invalid %s grouping rule %v: expected 2 fields, got %d", ptype, rule, len(rule))
+			}
+		}
+	}
+
+	return nil
+}
+
+// globMatch is util.GlobMatch adapted to casbin's rbac.MatchingFunc, invalid patterns never match
+func globMatch(name, pattern string) bool {
+	ok, err := util.GlobMatch(name, pattern)
+	return err == nil && ok
+}
+
+// SiteMatchesPattern tells if the site name is matched by the pattern, the same way as in the policy
+func SiteMatchesPattern(name, pattern string) bool {
+	return globMatch(name, pattern)
+}
+
+// Reload re-reads the policy file. If the new file is invalid, the old policy is kept.
+func (cb *CasbinProvider) Reload() error {
+	l := cb.logger.With(zap.String("policyFile", cb.policyFile))
+
+	err := validatePolicyFile(cb.modelText, cb.policyFile)
+	if err == nil {
+		err = cb.enforcer.LoadPolicy() // casbin only swaps the policy when loading was successful
+	}
+	if err != nil {
+		l.Error("Failed to reload policy file, keeping the previously loaded policy", zap.Error(err))
+		return err
+	}
+
+	l.Info("Policy reloaded", zap.Int("policyCount", len(cb.enforcer.GetPolicy())), zap.Int("groupingPolicyCount", len(cb.enforcer.GetGroupingPolicy())), zap.Int("siteGroupingPolicyCount", len(cb.enforcer.GetNamedGroupingPolicy("g2"))))
+	return nil
+}
+
 const AuthZEnforcerFuncKey = "authz_enforcer_func"
 
-type EnforcerFunction func(string) (bool, error)
+type EnforcerFunction func(act string, dep DeploymentAttributes) (bool, error)
 
 func (cb *CasbinProvider) NewMiddleware(acts ...string) gin.HandlerFunc {
+	return cb.newMiddleware(func(ctx *gin.Context) string {
+		return ctx.Param("siteName") // read the url param directly
+	}, acts, false)
+}
+
+// NewDeploymentMiddleware is like NewMiddleware, but the acts are deployment-scoped. Only the coarse check is done here (without the attributes),
+// so the existence of deployments is not revealed to users who could never do the act. The handler must check the act again with EnforceAuthZ, once the deployment is loaded.
+func (cb *CasbinProvider) NewDeploymentMiddleware(acts ...string) gin.HandlerFunc {
+	return cb.newMiddleware(func(ctx *gin.Context) string {
+		return ctx.Param("siteName")
+	}, acts, true)
+}
+
+// NewGlobalMiddleware is like NewMiddleware, but the acts are checked against the GlobalObject instead of a site
+func (cb *CasbinProvider) NewGlobalMiddleware(acts ...string) gin.HandlerFunc {
+	return cb.newMiddleware(func(_ *gin.Context) string {
+		return GlobalObject
+	}, acts, false)
+}
+
+func (cb *CasbinProvider) newMiddleware(resourceFn func(ctx *gin.Context) string, acts []string, coarse bool) gin.HandlerFunc {
 
 	return func(ctx *gin.Context) {
 		user, ok := authentication.GetAuthenticatedUser(ctx)
@@ -59,16 +259,37 @@ func (cb *CasbinProvider) NewMiddleware(acts ...string) gin.HandlerFunc {
 			return
 		}
 
-		resource := ctx.Param("siteName") // read the url param directly
+		resource := resourceFn(ctx)
 
 		l := cb.logger.With(zap.Strings("acts", acts), zap.String("resource", resource), zap.String("user", user))
 
-		enforcerFunc := EnforcerFunction(func(act string) (bool, error) {
-			return cb.enforcer.Enforce(user, resource, act)
-		})
+		var enforcerFunc EnforcerFunction
+		var coarseFunc func(act string) (bool, error)
+		if claims, presigned := authentication.GetPresignedClaims(ctx); presigned {
+			l = l.With(zap.String("presignedDeploymentID", claims.DeploymentID), zap.Strings("presignedCapabilities", claims.Capabilities))
+			enforcerFunc = func(act string, dep DeploymentAttributes) (bool, error) {
+				return presignedAllows(claims, resource, act, dep), nil
+			}
+			coarseFunc = func(act string) (bool, error) {
+				return presignedAllows(claims, resource, act, DeploymentAttributes{ID: claims.DeploymentID}), nil
+			}
+		} else {
+			enforcerFunc = func(act string, dep DeploymentAttributes) (bool, error) {
+				return cb.enforce(user, resource, act, dep)
+			}
+			coarseFunc = func(act string) (bool, error) {
+				return cb.enforceCoarse(user, resource, act)
+			}
+		}
 
 		for _, act := range acts { // enforce all acts one-by-one
-			allowed, err := enforcerFunc(act)
+			var allowed bool
+			var err error
+			if coarse {
+				allowed, err = coarseFunc(act)
+			} else {
+				allowed, err = enforcerFunc(act, DeploymentAttributes{}) // these are not deployment-scoped
+			}
 
 			if err != nil {
 				ctx.AbortWithStatus(http.StatusInternalServerError)
@@ -92,7 +313,8 @@ func (cb *CasbinProvider) NewMiddleware(acts ...string) gin.HandlerFunc {
 	}
 }
 
-func EnforceAuthZ(ctx *gin.Context, act string) (bool, error) {
+// EnforceAuthZ checks act for the user and site of the current request. For deployment-scoped acts pass the attributes of the deployment, otherwise the zero value.
+func EnforceAuthZ(ctx *gin.Context, act string, dep DeploymentAttributes) (bool, error) {
 	val, ok := ctx.Get(AuthZEnforcerFuncKey)
 	if !ok {
 		return false, fmt.Errorf("could not load authz enforcer from context")
@@ -102,5 +324,5 @@ func EnforceAuthZ(ctx *gin.Context, act string) (bool, error) {
 	if !ok {
 		return false, fmt.Errorf("could not cast authz enforcer to type")
 	}
-	return fn(act)
+	return fn(act, dep)
 }
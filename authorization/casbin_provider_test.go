@@ -0,0 +1,276 @@
+package authorization
+
+import (
+	"github.com/marcsello/webploy-server/deployment/info"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPolicy = `
+# admin can do anything on any site
+p,admin,*,read-live,allow
+p,admin,*,update-live,allow
+p,admin,.global,manage-policy,allow
+
+# team a deployers can create deployments on team a sites, except the legacy one
+g,alice,team_a_deployer
+p,team_a_deployer,team-a-*,create-deployment,allow
+p,team_a_deployer,team-a-legacy,create-deployment,deny
+
+# site groups, members can be patterns too
+g2,docs,public_sites
+g2,blog-*,public_sites
+p,bob,public_sites,read-live,allow
+p,bob,blog-secret,read-live,deny
+
+# a deny on a site group takes precedence over an allow for a pattern
+g2,team-a-frozen,frozen_sites
+p,team_a_deployer,frozen_sites,create-deployment,deny
+`
+
+func TestCasbinProvider_Check(t *testing.T) {
+	testCases := []struct {
+		name     string
+		user     string
+		obj      string
+		act      string
+		expected bool
+	}{
+		{name: "pattern__star_matches_any_site", user: "admin", obj: "some_site", act: ActReadLive, expected: true},
+		{name: "pattern__star_does_not_grant_other_acts", user: "admin", obj: "some_site", act: ActCreateDeployment, expected: false},
+		{name: "pattern__star_does_not_match_global", user: "admin", obj: GlobalObject, act: ActReadLive, expected: false},
+		{name: "global__exact_match", user: "admin", obj: GlobalObject, act: ActManagePolicy, expected: true},
+		{name: "global__no_grant", user: "alice", obj: GlobalObject, act: ActManagePolicy, expected: false},
+		{name: "pattern__prefix_match", user: "alice", obj: "team-a-web", act: ActCreateDeployment, expected: true},
+		{name: "pattern__prefix_no_match", user: "alice", obj: "team-b-web", act: ActCreateDeployment, expected: false},
+		{name: "deny__exact_deny_over_pattern_allow", user: "alice", obj: "team-a-legacy", act: ActCreateDeployment, expected: false},
+		{name: "deny__group_deny_over_pattern_allow", user: "alice", obj: "team-a-frozen", act: ActCreateDeployment, expected: false},
+		{name: "site_group__exact_member", user: "bob", obj: "docs", act: ActReadLive, expected: true},
+		{name: "site_group__pattern_member", user: "bob", obj: "blog-main", act: ActReadLive, expected: true},
+		{name: "site_group__not_member", user: "bob", obj: "team-a-web", act: ActReadLive, expected: false},
+		{name: "deny__exact_deny_over_group_allow", user: "bob", obj: "blog-secret", act: ActReadLive, expected: false},
+		{name: "site_group__group_name_matches_itself", user: "bob", obj: "public_sites", act: ActReadLive, expected: true}, // the group name itself matches trivially, this is why site names and group names should not collide
+		{name: "unknown_user", user: "mallory", obj: "docs", act: ActReadLive, expected: false},
+	}
+
+	policyFile := path.Join(t.TempDir(), "policy.csv")
+	assert.NoError(t, os.WriteFile(policyFile, []byte(testPolicy), 0o600))
+
+	cb, err := NewCasbinProvider("", policyFile, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			allowed, err := cb.Check(tc.user, tc.obj, tc.act, DeploymentAttributes{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, allowed)
+		})
+	}
+
+	// patterns must keep working after reloading the policy
+	assert.NoError(t, cb.Reload())
+	for _, tc := range testCases {
+		t.Run(tc.name+"__after_reload", func(t *testing.T) {
+			allowed, err := cb.Check(tc.user, tc.obj, tc.act, DeploymentAttributes{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, allowed)
+		})
+	}
+}
+
+func TestCasbinProvider_Reload(t *testing.T) {
+	testCases := []struct {
+		name        string
+		newPolicy   string
+		expectError bool
+		expected    bool // whether alice can create deployments after the reload
+	}{
+		{
+			name:      "happy__changed",
+			newPolicy: "p,alice,my_site,create-deployment,deny\n",
+			expected:  false,
+		},
+		{
+			name:        "error__invalid_effect_keeps_old",
+			newPolicy:   "p,alice,my_site,create-deployment,nope\n",
+			expectError: true,
+			expected:    true,
+		},
+		{
+			name:        "error__missing_field_keeps_old",
+			newPolicy:   "p,alice,my_site,create-deployment\n",
+			expectError: true,
+			expected:    true,
+		},
+		{
+			name:        "error__invalid_grouping_keeps_old",
+			newPolicy:   "g,alice\n",
+			expectError: true,
+			expected:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policyFile := path.Join(t.TempDir(), "policy.csv")
+			assert.NoError(t, os.WriteFile(policyFile, []byte("p,alice,my_site,create-deployment,allow\n"), 0o600))
+
+			cb, err := NewCasbinProvider("", policyFile, zaptest.NewLogger(t))
+			assert.NoError(t, err)
+
+			assert.NoError(t, os.WriteFile(policyFile, []byte(tc.newPolicy), 0o600))
+			err = cb.Reload()
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			var allowed bool
+			allowed, err = cb.Check("alice", "my_site", ActCreateDeployment, DeploymentAttributes{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, allowed)
+		})
+	}
+}
+
+const testAttributeModel = `
+[request_definition]
+r = sub, obj, act, dep
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[role_definition]
+g = _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = g(r.sub, p.sub) && (r.obj == p.obj || (r.obj != ".global" && g2(r.obj, p.obj))) && r.act == p.act && (r.act != "update-live" || metaField(r.dep, "branch") == "main") && (r.act != "finish-any" || r.dep.Age < 86400)
+`
+
+const testAttributePolicy = `
+p,alice,my_site,update-live,allow
+p,alice,my_site,finish-any,allow
+p,alice,my_site,create-deployment,allow
+`
+
+func TestCasbinProvider_CheckAttributes(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		name     string
+		act      string
+		dep      info.DeploymentInfo
+		expected bool
+	}{
+		{name: "meta__matching_branch", act: ActUpdateLive, dep: info.DeploymentInfo{Meta: `{"branch":"main"}`, CreatedAt: now}, expected: true},
+		{name: "meta__other_branch", act: ActUpdateLive, dep: info.DeploymentInfo{Meta: `{"branch":"dev"}`, CreatedAt: now}, expected: false},
+		{name: "meta__not_json", act: ActUpdateLive, dep: info.DeploymentInfo{Meta: "main", CreatedAt: now}, expected: false},
+		{name: "age__young", act: ActFinishAny, dep: info.DeploymentInfo{CreatedAt: now.Add(-time.Hour)}, expected: true},
+		{name: "age__old", act: ActFinishAny, dep: info.DeploymentInfo{CreatedAt: now.Add(-48 * time.Hour)}, expected: false},
+		{name: "unrestricted_act", act: ActCreateDeployment, expected: true},
+	}
+
+	dir := t.TempDir()
+	modelFile := path.Join(dir, "model.conf")
+	policyFile := path.Join(dir, "policy.csv")
+	assert.NoError(t, os.WriteFile(modelFile, []byte(testAttributeModel), 0o600))
+	assert.NoError(t, os.WriteFile(policyFile, []byte(testAttributePolicy), 0o600))
+
+	cb, err := NewCasbinProvider(modelFile, policyFile, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var dep DeploymentAttributes
+			if tc.act != ActCreateDeployment { // not deployment-scoped
+				dep = NewDeploymentAttributes("test", tc.dep, now)
+			}
+			allowed, err := cb.Check("alice", "my_site", tc.act, dep)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, allowed)
+		})
+	}
+}
+
+func TestCasbinProvider_EnforceCoarse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		model    string
+		user     string
+		act      string
+		expected bool
+	}{
+		{name: "default__allowed", model: modelConfigString, user: "alice", act: ActUpdateLive, expected: true},
+		{name: "default__not_allowed", model: modelConfigString, user: "bob", act: ActUpdateLive, expected: false},
+		{name: "attributes__allowed_for_some", model: testAttributeModel, user: "alice", act: ActUpdateLive, expected: true},
+		{name: "attributes__not_allowed", model: testAttributeModel, user: "bob", act: ActUpdateLive, expected: false},
+		{name: "attributes__other_act", model: testAttributeModel, user: "alice", act: ActReadDeployment, expected: false},
+		{name: "coarse_matcher__used", model: testAttributeModel + "m2 = r.act == \"read-deployment\"\n", user: "bob", act: ActReadDeployment, expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			modelFile := path.Join(dir, "model.conf")
+			policyFile := path.Join(dir, "policy.csv")
+			assert.NoError(t, os.WriteFile(modelFile, []byte(tc.model), 0o600))
+			assert.NoError(t, os.WriteFile(policyFile, []byte(testAttributePolicy), 0o600))
+
+			cb, err := NewCasbinProvider(modelFile, policyFile, zaptest.NewLogger(t))
+			assert.NoError(t, err)
+
+			allowed, err := cb.enforceCoarse(tc.user, "my_site", tc.act)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, allowed)
+		})
+	}
+}
+
+func TestNewCasbinProvider_Model(t *testing.T) {
+	testCases := []struct {
+		name  string
+		model string
+		error bool
+	}{
+		{name: "happy__without_attributes", model: strings.Replace(modelConfigString, "r = sub, obj, act, dep", "r = sub, obj, act", 1), error: false},
+		{name: "happy__with_attributes", model: testAttributeModel, error: false},
+		{name: "error__missing_eft", model: strings.Replace(testAttributeModel, "p = sub, obj, act, eft", "p = sub, obj, act", 1), error: true},
+		{name: "error__extra_request_field", model: strings.Replace(testAttributeModel, "r = sub, obj, act, dep", "r = sub, obj, act, dep, foo", 1), error: true},
+		{name: "happy__coarse_matcher", model: testAttributeModel + "m2 = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act\n", error: false},
+		{name: "error__missing_site_groups", model: strings.Replace(testAttributeModel, "g2 = _, _\n", "", 1), error: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			modelFile := path.Join(dir, "model.conf")
+			policyFile := path.Join(dir, "policy.csv")
+			assert.NoError(t, os.WriteFile(modelFile, []byte(tc.model), 0o600))
+			assert.NoError(t, os.WriteFile(policyFile, []byte(testAttributePolicy), 0o600))
+
+			_, err := NewCasbinProvider(modelFile, policyFile, zaptest.NewLogger(t))
+			if tc.error {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("error__missing_model_file", func(t *testing.T) {
+		dir := t.TempDir()
+		policyFile := path.Join(dir, "policy.csv")
+		assert.NoError(t, os.WriteFile(policyFile, []byte(testAttributePolicy), 0o600))
+		_, err := NewCasbinProvider(path.Join(dir, "missing.conf"), policyFile, zaptest.NewLogger(t))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,109 @@
+package authorization
+
+import (
+	"fmt"
+	"github.com/marcsello/webploy-server/utils"
+	"slices"
+	"strings"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// PolicyRule is a single "p" line of the policy
+type PolicyRule struct {
+	Sub string
+	Obj string
+	Act string
+	Eft string
+}
+
+func (r PolicyRule) asSlice() []string {
+	return []string{r.Sub, r.Obj, r.Act, r.Eft}
+}
+
+// GroupingRule is a single "g" line of the policy, assigning Sub to the Group role
+type GroupingRule struct {
+	Sub   string
+	Group string
+}
+
+func (r GroupingRule) asSlice() []string {
+	return []string{r.Sub, r.Group}
+}
+
+// SiteGroupingRule is a single "g2" line of the policy, assigning Site (a site name or a glob pattern) to the Group site group
+type SiteGroupingRule struct {
+	Site  string
+	Group string
+}
+
+func (r SiteGroupingRule) asSlice() []string {
+	return []string{r.Site, r.Group}
+}
+
+// validatePolicyField makes sure that a field can be safely written to the CSV policy file
+func validatePolicyField(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is empty", name)
+	}
+	if !utils.ValidatePrintableAscii(value) {
+		return fmt.Errorf("%s contains non-ascii characters", name)
+	}
+	if strings.ContainsAny(value, ",\"") || strings.HasPrefix(value, "#") {
+		return fmt.Errorf("%s contains invalid characters", name)
+	}
+	if strings.TrimSpace(value) != value {
+		return fmt.Errorf("%s has leading or trailing whitespace", name)
+	}
+	return nil
+}
+
+func (r PolicyRule) Validate() error {
+	for _, f := range []struct{ name, value string }{{"sub", r.Sub}, {"obj", r.Obj}, {"act", r.Act}, {"eft", r.Eft}} {
+		if err := validatePolicyField(f.name, f.value); err != nil {
+			return err
+		}
+	}
+
+	if r.Eft != EffectAllow && r.Eft != EffectDeny {
+		return fmt.Errorf("eft must be either %s or %s", EffectAllow, EffectDeny)
+	}
+
+	switch {
+	case slices.Contains(GlobalActs, r.Act):
+		if r.Obj != GlobalObject {
+			return fmt.Errorf("%s is a global act, obj must be %s", r.Act, GlobalObject)
+		}
+	case slices.Contains(SiteActs, r.Act):
+		if r.Obj == GlobalObject {
+			return fmt.Errorf("%s is a site act, obj can not be %s", r.Act, GlobalObject)
+		}
+	default:
+		return fmt.Errorf("unknown act: %s", r.Act)
+	}
+
+	return nil
+}
+
+func (r GroupingRule) Validate() error {
+	if err := validatePolicyField("sub", r.Sub); err != nil {
+		return err
+	}
+	return validatePolicyField("group", r.Group)
+}
+
+func (r SiteGroupingRule) Validate() error {
+	if err := validatePolicyField("site", r.Site); err != nil {
+		return err
+	}
+	if err := validatePolicyField("group", r.Group); err != nil {
+		return err
+	}
+	if r.Site == GlobalObject || r.Group == GlobalObject {
+		return fmt.Errorf("%s can not be part of a site group", GlobalObject)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package authorization
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicyRule_Validate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		rule        PolicyRule
+		expectedErr error
+	}{
+		{
+			name: "happy__site_act",
+			rule: PolicyRule{Sub: "user", Obj: "my_site", Act: ActCreateDeployment, Eft: EffectAllow},
+		},
+		{
+			name: "happy__global_act",
+			rule: PolicyRule{Sub: "admin", Obj: GlobalObject, Act: ActManagePolicy, Eft: EffectDeny},
+		},
+		{
+			name:        "error__empty_sub",
+			rule:        PolicyRule{Sub: "", Obj: "my_site", Act: ActCreateDeployment, Eft: EffectAllow},
+			expectedErr: fmt.Errorf("sub is empty"),
+		},
+		{
+			name:        "error__comma",
+			rule:        PolicyRule{Sub: "user,admin", Obj: "my_site", Act: ActCreateDeployment, Eft: EffectAllow},
+			expectedErr: fmt.Errorf("sub contains invalid characters"),
+		},
+		{
+			name:        "error__comment",
+			rule:        PolicyRule{Sub: "#user", Obj: "my_site", Act: ActCreateDeployment, Eft: EffectAllow},
+			expectedErr: fmt.Errorf("sub contains invalid characters"),
+		},
+		{
+			name:        "error__whitespace",
+			rule:        PolicyRule{Sub: "user", Obj: " my_site", Act: ActCreateDeployment, Eft: EffectAllow},
+			expectedErr: fmt.Errorf("obj has leading or trailing whitespace"),
+		},
+		{
+			name:        "error__invalid_effect",
+			rule:        PolicyRule{Sub: "user", Obj: "my_site", Act: ActCreateDeployment, Eft: "maybe"},
+			expectedErr: fmt.Errorf("eft must be either allow or deny"),
+		},
+		{
+			name:        "error__unknown_act",
+			rule:        PolicyRule{Sub: "user", Obj: "my_site", Act: "fly", Eft: EffectAllow},
+			expectedErr: fmt.Errorf("unknown act"),
+		},
+		{
+			name:        "error__global_act_on_site",
+			rule:        PolicyRule{Sub: "user", Obj: "my_site", Act: ActManagePolicy, Eft: EffectAllow},
+			expectedErr: fmt.Errorf("is a global act"),
+		},
+		{
+			name:        "error__site_act_on_global",
+			rule:        PolicyRule{Sub: "user", Obj: GlobalObject, Act: ActReadLive, Eft: EffectAllow},
+			expectedErr: fmt.Errorf("is a site act"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.rule.Validate()
+			if tc.expectedErr != nil {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package authorization
+
+import (
+	"github.com/marcsello/webploy-server/authentication"
+	"slices"
+)
+
+// PresignCapabilityActs maps the capabilities of presigned tokens to the acts they grant.
+// The first act is the "self" variant, the second is the "any" variant, the issuer of the token must hold at least one of them.
+var PresignCapabilityActs = map[string][]string{
+	authentication.PresignCapabilityUpload: {ActUploadSelf, ActUploadAny},
+	authentication.PresignCapabilityFinish: {ActFinishSelf, ActFinishAny},
+}
+
+// presignedAllows tells if the claims of a presigned token allow act on the deployment of the site.
+// The policy is never consulted for presigned requests, everything not granted by the token is denied.
+func presignedAllows(claims authentication.PresignedClaims, obj, act string, dep DeploymentAttributes) bool {
+	if obj != claims.Site || dep.ID == "" || dep.ID != claims.DeploymentID {
+		return false
+	}
+
+	for _, c := range claims.Capabilities {
+		if slices.Contains(PresignCapabilityActs[c], act) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package authorization
+
+import (
+	"github.com/marcsello/webploy-server/authentication"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPresignedAllows(t *testing.T) {
+	claims := authentication.PresignedClaims{
+		Site:         "my_site",
+		DeploymentID: "deployment1",
+		Capabilities: []string{authentication.PresignCapabilityUpload},
+	}
+
+	testCases := []struct {
+		name     string
+		obj      string
+		act      string
+		dep      DeploymentAttributes
+		expected bool
+	}{
+		{name: "happy__upload_self", obj: "my_site", act: ActUploadSelf, dep: DeploymentAttributes{ID: "deployment1"}, expected: true},
+		{name: "happy__upload_any", obj: "my_site", act: ActUploadAny, dep: DeploymentAttributes{ID: "deployment1"}, expected: true},
+		{name: "denied__capability_not_granted", obj: "my_site", act: ActFinishAny, dep: DeploymentAttributes{ID: "deployment1"}, expected: false},
+		{name: "denied__other_act", obj: "my_site", act: ActDeleteAny, dep: DeploymentAttributes{ID: "deployment1"}, expected: false},
+		{name: "denied__other_deployment", obj: "my_site", act: ActUploadAny, dep: DeploymentAttributes{ID: "deployment2"}, expected: false},
+		{name: "denied__other_site", obj: "other_site", act: ActUploadAny, dep: DeploymentAttributes{ID: "deployment1"}, expected: false},
+		{name: "denied__not_deployment_scoped", obj: "my_site", act: ActListDeployments, expected: false},
+		{name: "denied__global", obj: GlobalObject, act: ActManagePolicy, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, presignedAllows(claims, tc.obj, tc.act, tc.dep))
+		})
+	}
+}
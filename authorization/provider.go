@@ -4,5 +4,31 @@ import "github.com/gin-gonic/gin"
 
 // Provider is an Authorization provider
 type Provider interface {
+	PolicyManager
+
 	NewMiddleware(acts ...string) gin.HandlerFunc
+	NewDeploymentMiddleware(acts ...string) gin.HandlerFunc
+	NewGlobalMiddleware(acts ...string) gin.HandlerFunc
+
+	// Reload re-reads the policy from its source, the previous policy is kept on failure
+	Reload() error
+}
+
+// PolicyManager allows inspecting and changing the policy at runtime, changes are persisted
+type PolicyManager interface {
+	GetPolicies() []PolicyRule
+	AddPolicy(rule PolicyRule) (bool, error)
+	RemovePolicy(rule PolicyRule) (bool, error)
+
+	GetGroupings() []GroupingRule
+	AddGrouping(rule GroupingRule) (bool, error)
+	RemoveGrouping(rule GroupingRule) (bool, error)
+
+	GetSiteGroupings() []SiteGroupingRule
+	AddSiteGrouping(rule SiteGroupingRule) (bool, error)
+	RemoveSiteGrouping(rule SiteGroupingRule) (bool, error)
+
+	// Check tells if the user would be allowed to do act on obj, without actually doing anything
+	// dep should be the zero value for acts that are not deployment-scoped
+	Check(user, obj, act string, dep DeploymentAttributes) (bool, error)
 }
@@ -0,0 +1,319 @@
+package check
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/marcsello/webploy-server/authentication"
+	"github.com/marcsello/webploy-server/authorization"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/hooks"
+	"github.com/marcsello/webploy-server/logging"
+	"github.com/marcsello/webploy-server/notify"
+	"github.com/marcsello/webploy-server/site"
+	"go.uber.org/zap"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CertExpiryWarning is how long before the expiry of the TLS certificate a warning is reported
+const CertExpiryWarning = 30 * 24 * time.Hour
+
+// Run loads the config file, and checks everything it refers to. It does not change anything.
+func Run(configPath string) *Report {
+	r := &Report{}
+
+	cfg, err := config.LoadConfigFile(configPath, zap.NewNop())
+	if err != nil {
+		r.fail("config", "failed to load %s: %s", configPath, err)
+		return r // nothing else can be checked
+	}
+	r.ok("config", "loaded %s", configPath)
+
+	siteNames := checkSites(r, cfg.Sites)
+	checkAuthentication(r, cfg.Authentication)
+	checkAuthorization(r, cfg.Authorization, siteNames)
+	checkTLS(r, cfg.Listen, time.Now())
+	checkLogging(r, cfg.Logging)
+
+	return r
+}
+
+// checkSites checks the names and the hooks of all sites (including the managed ones), returns the names of the valid sites
+func checkSites(r *Report, cfg config.SitesConfig) []string {
+	sites := slices.Clone(cfg.Sites)
+
+	if cfg.ManagedFile != "" {
+		managedSites, err := site.LoadManagedSites(cfg.ManagedFile)
+		if err != nil {
+			r.fail("sites", "failed to load managed sites from %s: %s", cfg.ManagedFile, err)
+		} else {
+			sites = append(sites, managedSites...)
+		}
+	}
+
+	if len(sites) == 0 {
+		r.warn("sites", "no sites configured")
+	}
+
+	var siteNames []string
+	for _, siteCfg := range sites {
+		subject := fmt.Sprintf("site %q", siteCfg.Name)
+
+		err := site.ValidateSiteName(siteCfg.Name)
+		if err != nil {
+			r.fail(subject, "invalid name: %s", err)
+			continue
+		}
+		if slices.Contains(siteNames, siteCfg.Name) {
+			r.fail(subject, "defined more than once")
+			continue
+		}
+		siteNames = append(siteNames, siteCfg.Name)
+
+		siteOk := true
+		configuredHooks := hooks.ConfiguredHooks(siteCfg.Hooks)
+		for _, hook := range hooks.AllHooks { // iterate in a fixed order, so the report is stable
+			for i, hd := range configuredHooks[hook] {
+				err = checkHookDefinition(hd, siteCfg.Hooks.Webhook)
+				if err != nil {
+					r.fail(subject, "hook %s #%d: %s", hook, i, err)
+					siteOk = false
+				}
+			}
+		}
+		for i, nc := range siteCfg.Notifications {
+			err = checkNotification(nc)
+			if err != nil {
+				r.fail(subject, "notification #%d: %s", i, err)
+				siteOk = false
+			}
+		}
+
+		if siteOk {
+			r.ok(subject, "valid")
+		}
+	}
+
+	return siteNames
+}
+
+// checkHookDefinition checks that the hook can be run, either as a webhook or as an executable
+func checkHookDefinition(hd config.HookDefinition, webhookConfig config.WebhookConfig) error {
+	if hooks.IsWebhook(hd.Path) {
+		return checkWebhook(hd.Path, webhookConfig)
+	}
+
+	err := checkExecutable(hd.Path)
+	if err != nil {
+		return err
+	}
+
+	if hd.WorkDir != "" {
+		var info os.FileInfo
+		info, err = os.Stat(hd.WorkDir)
+		if err != nil {
+			return fmt.Errorf("workdir: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("workdir: %s is not a directory", hd.WorkDir)
+		}
+	}
+
+	_, err = hooks.ResolveCredential(hd.User, hd.Group)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkWebhook checks if the url is valid, and the secret file can be read. It does not call the webhook.
+func checkWebhook(hookURL string, cfg config.WebhookConfig) error {
+	u, err := url.Parse(hookURL)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s has no host", hookURL)
+	}
+	if cfg.SecretFile != "" {
+		_, err = os.ReadFile(cfg.SecretFile)
+		if err != nil {
+			return fmt.Errorf("webhook secret: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkNotification checks the url, the events and the secret file of a notification endpoint. It does not call the endpoint.
+func checkNotification(cfg config.NotificationConfig) error {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s has no host", cfg.URL)
+	}
+	for _, event := range cfg.Events {
+		if !notify.IsValidEvent(event) {
+			return fmt.Errorf("unknown event: %s", event)
+		}
+	}
+	if cfg.SecretFile != "" {
+		_, err = os.ReadFile(cfg.SecretFile)
+		if err != nil {
+			return fmt.Errorf("notification secret: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkExecutable checks if the path is a regular file, that is executable by someone
+func checkExecutable(filePath string) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", filePath)
+	}
+	if info.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("%s is not executable", filePath)
+	}
+	return nil
+}
+
+func checkAuthentication(r *Report, cfg config.AuthenticationProviderConfig) {
+	if cfg.BasicAuth == nil {
+		r.fail("authentication", "no authentication method configured")
+	} else {
+		usersCount, err := authentication.CheckHtpasswdFile(cfg.BasicAuth.HTPasswdFile)
+		if err != nil {
+			r.fail("authentication", "failed to load htpasswd file %s: %s", cfg.BasicAuth.HTPasswdFile, err)
+		} else if usersCount == 0 {
+			r.warn("authentication", "htpasswd file %s contains no users", cfg.BasicAuth.HTPasswdFile)
+		} else {
+			r.ok("authentication", "htpasswd file %s contains %d user(s)", cfg.BasicAuth.HTPasswdFile, usersCount)
+		}
+	}
+
+	if cfg.Presigned != nil {
+		_, err := authentication.InitPresigner(cfg.Presigned)
+		if err != nil {
+			r.fail("presigned", "%s", err)
+		} else {
+			r.ok("presigned", "valid")
+		}
+	}
+}
+
+// isPattern tells if the object in the policy is a glob pattern
+func isPattern(obj string) bool {
+	return strings.ContainsAny(obj, "*?[")
+}
+
+func checkAuthorization(r *Report, cfg config.AuthorizationProviderConfig, siteNames []string) {
+	cb, err := authorization.NewCasbinProvider(cfg.ModelFile, cfg.PolicyFile, zap.NewNop())
+	if err != nil {
+		r.fail("authorization", "failed to load policy file %s: %s", cfg.PolicyFile, err)
+		return
+	}
+	r.ok("authorization", "policy file %s loaded", cfg.PolicyFile)
+
+	siteGroupings := cb.GetSiteGroupings()
+	siteGroups := make([]string, 0, len(siteGroupings))
+	for _, g := range siteGroupings {
+		siteGroups = append(siteGroups, g.Group)
+	}
+
+	// reports if the site or pattern does not refer to any existing site
+	checkObj := func(subject, obj string) {
+		if slices.Contains(siteNames, obj) {
+			return
+		}
+		if isPattern(obj) {
+			for _, name := range siteNames {
+				if authorization.SiteMatchesPattern(name, obj) {
+					return
+				}
+			}
+			r.warn(subject, "pattern %q does not match any site", obj)
+			return
+		}
+		r.fail(subject, "site %q does not exist", obj)
+	}
+
+	for _, g := range siteGroupings {
+		checkObj(fmt.Sprintf("site grouping %s -> %s", g.Site, g.Group), g.Site)
+	}
+
+	for _, p := range cb.GetPolicies() {
+		if p.Obj == authorization.GlobalObject || slices.Contains(siteGroups, p.Obj) {
+			continue
+		}
+		checkObj(fmt.Sprintf("policy %s, %s, %s, %s", p.Sub, p.Obj, p.Act, p.Eft), p.Obj)
+	}
+}
+
+func checkTLS(r *Report, cfg config.ListenConfig, now time.Time) {
+	if !cfg.EnableTLS {
+		r.warn("tls", "TLS is disabled")
+		return
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		r.fail("tls", "failed to load key pair (cert: %s, key: %s): %s", cfg.TLSCert, cfg.TLSKey, err)
+		return
+	}
+
+	var leaf *x509.Certificate
+	leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		r.fail("tls", "failed to parse certificate %s: %s", cfg.TLSCert, err)
+		return
+	}
+
+	switch {
+	case now.After(leaf.NotAfter):
+		r.fail("tls", "certificate %s expired at %s", cfg.TLSCert, leaf.NotAfter.Format(time.RFC3339))
+	case now.Before(leaf.NotBefore):
+		r.fail("tls", "certificate %s is not valid before %s", cfg.TLSCert, leaf.NotBefore.Format(time.RFC3339))
+	case leaf.NotAfter.Sub(now) < CertExpiryWarning:
+		r.warn("tls", "certificate %s expires soon, at %s", cfg.TLSCert, leaf.NotAfter.Format(time.RFC3339))
+	default:
+		r.ok("tls", "certificate %s is valid until %s", cfg.TLSCert, leaf.NotAfter.Format(time.RFC3339))
+	}
+}
+
+// checkLogging validates the logging config, and checks that the log files can be written
+func checkLogging(r *Report, cfg config.LoggingConfig) {
+	err := logging.Validate(cfg)
+	if err != nil {
+		r.fail("logging", "%s", err)
+		return
+	}
+
+	failed := false
+	for _, o := range cfg.Outputs {
+		if o.Path == "stdout" || o.Path == "stderr" {
+			continue
+		}
+		// opening for writing would create the file, so only check that the directory is there
+		dirInfo, err := os.Stat(path.Dir(o.Path))
+		if err != nil {
+			r.fail("logging", "log file %s can not be created: %s", o.Path, err)
+			failed = true
+		} else if !dirInfo.IsDir() {
+			r.fail("logging", "log file %s can not be created: %s is not a directory", o.Path, path.Dir(o.Path))
+			failed = true
+		}
+	}
+	if !failed {
+		r.ok("logging", "valid")
+	}
+}
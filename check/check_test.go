@@ -0,0 +1,216 @@
+package check
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// findings returns the findings in a compact form for easier assertions
+func findings(r *Report) []string {
+	var result []string
+	for _, f := range r.Findings {
+		result = append(result, fmt.Sprintf("%s|%s", strings.TrimSpace(f.Severity.String()), f.Subject))
+	}
+	return result
+}
+
+func TestCheckSites(t *testing.T) {
+	dir := t.TempDir()
+	executable := path.Join(dir, "hook.sh")
+	notExecutable := path.Join(dir, "not_executable.sh")
+	assert.NoError(t, os.WriteFile(executable, []byte("#!/bin/sh\n"), 0o700))
+	assert.NoError(t, os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0o600))
+
+	r := &Report{}
+	siteNames := checkSites(r, config.SitesConfig{
+		Sites: []config.SiteConfig{
+			{Name: "good", Hooks: config.HooksConfig{PreCreate: config.HookList{{Path: executable, OnFailure: config.HookOnFailureAbort}}}},
+			{Name: ".bad_name"},
+			{Name: "good"},
+			{Name: "bad_hook", Hooks: config.HooksConfig{PreFinish: config.HookList{{Path: notExecutable, OnFailure: config.HookOnFailureAbort}}, PostLive: config.HookList{{Path: path.Join(dir, "missing.sh"), OnFailure: config.HookOnFailureAbort}}}},
+			{Name: "dir_hook", Hooks: config.HooksConfig{PreLive: config.HookList{{Path: dir, OnFailure: config.HookOnFailureAbort}}}},
+			{Name: "webhook", Hooks: config.HooksConfig{PostLive: config.HookList{{Path: "https://example.com/hook", OnFailure: config.HookOnFailureAbort}}}},
+			{Name: "bad_webhook", Hooks: config.HooksConfig{PostLive: config.HookList{{Path: "https:///hook", OnFailure: config.HookOnFailureAbort}}, PreLive: config.HookList{{Path: "https://example.com/hook", OnFailure: config.HookOnFailureAbort}}, Webhook: config.WebhookConfig{SecretFile: path.Join(dir, "missing")}}},
+			{Name: "unknown_user", Hooks: config.HooksConfig{PostLive: config.HookList{{Path: executable, OnFailure: config.HookOnFailureAbort, User: "webploy-no-such-user"}}}},
+			{Name: "notifications", Notifications: []config.NotificationConfig{{URL: "https://example.com/events", Events: []string{"created", "live_changed"}}}},
+			{Name: "bad_notifications", Notifications: []config.NotificationConfig{{URL: "https:///events"}, {URL: "https://example.com/events", Events: []string{"exploded"}}, {URL: "https://example.com/events", SecretFile: path.Join(dir, "missing")}}},
+		},
+	})
+
+	assert.Equal(t, []string{"good", "bad_hook", "dir_hook", "webhook", "bad_webhook", "unknown_user", "notifications", "bad_notifications"}, siteNames)
+	assert.Equal(t, []string{
+		`OK|site "good"`,
+		`FAIL|site ".bad_name"`,
+		`FAIL|site "good"`,
+		`FAIL|site "bad_hook"`,
+		`FAIL|site "bad_hook"`,
+		`FAIL|site "dir_hook"`,
+		`OK|site "webhook"`,
+		`FAIL|site "bad_webhook"`,
+		`FAIL|site "bad_webhook"`,
+		`FAIL|site "unknown_user"`,
+		`OK|site "notifications"`,
+		`FAIL|site "bad_notifications"`,
+		`FAIL|site "bad_notifications"`,
+		`FAIL|site "bad_notifications"`,
+	}, findings(r))
+}
+
+func TestCheckAuthorization(t *testing.T) {
+	policyFile := path.Join(t.TempDir(), "policy.csv")
+	assert.NoError(t, os.WriteFile(policyFile, []byte(`
+p,admin,.global,manage-policy,allow
+p,alice,site_a,read-live,allow
+p,alice,site_*,read-live,allow
+p,alice,other_*,read-live,allow
+p,alice,missing,read-live,allow
+p,alice,group,read-live,allow
+g2,site_b,group
+g2,missing_too,group
+`), 0o600))
+
+	r := &Report{}
+	checkAuthorization(r, config.AuthorizationProviderConfig{PolicyFile: policyFile}, []string{"site_a", "site_b"})
+	assert.Equal(t, []string{
+		"OK|authorization",
+		"FAIL|site grouping missing_too -> group",
+		"WARN|policy alice, other_*, read-live, allow",
+		"FAIL|policy alice, missing, read-live, allow",
+	}, findings(r))
+
+	r = &Report{}
+	checkAuthorization(r, config.AuthorizationProviderConfig{PolicyFile: path.Join(t.TempDir(), "missing.csv")}, nil)
+	assert.Equal(t, []string{"FAIL|authorization"}, findings(r))
+}
+
+func writeTestCert(t *testing.T, dir string, notBefore, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "webploy.test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := path.Join(dir, "cert.pem")
+	keyFile := path.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile
+}
+
+func TestCheckTLS(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name             string
+		notBefore        time.Time
+		notAfter         time.Time
+		missing          bool
+		disabled         bool
+		expectedSeverity Severity
+	}{
+		{name: "valid", notBefore: now.Add(-time.Hour), notAfter: now.Add(365 * 24 * time.Hour), expectedSeverity: SeverityOK},
+		{name: "expires_soon", notBefore: now.Add(-time.Hour), notAfter: now.Add(24 * time.Hour), expectedSeverity: SeverityWarning},
+		{name: "expired", notBefore: now.Add(-48 * time.Hour), notAfter: now.Add(-24 * time.Hour), expectedSeverity: SeverityError},
+		{name: "not_yet_valid", notBefore: now.Add(time.Hour), notAfter: now.Add(48 * time.Hour), expectedSeverity: SeverityError},
+		{name: "missing", missing: true, expectedSeverity: SeverityError},
+		{name: "disabled", disabled: true, expectedSeverity: SeverityWarning},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certFile, keyFile := path.Join(dir, "cert.pem"), path.Join(dir, "key.pem")
+			if !tc.missing && !tc.disabled {
+				certFile, keyFile = writeTestCert(t, dir, tc.notBefore, tc.notAfter)
+			}
+
+			r := &Report{}
+			checkTLS(r, config.ListenConfig{EnableTLS: !tc.disabled, TLSCert: certFile, TLSKey: keyFile}, now)
+			assert.Len(t, r.Findings, 1)
+			assert.Equal(t, tc.expectedSeverity, r.Findings[0].Severity)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	htpasswdFile := path.Join(dir, ".htpasswd")
+	policyFile := path.Join(dir, "policy.csv")
+	configFile := path.Join(dir, "webploy.conf")
+	assert.NoError(t, os.WriteFile(htpasswdFile, []byte("user:{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M=\n"), 0o600))
+	assert.NoError(t, os.WriteFile(policyFile, []byte("p,user,my_site,read-live,allow\n"), 0o600))
+
+	t.Run("happy", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(`
+authentication:
+  basic_auth:
+    htpasswd_file: %s
+authorization:
+  policy_file: %s
+sites:
+  sites:
+    - name: my_site
+`, htpasswdFile, policyFile)), 0o600))
+
+		r := Run(configFile)
+		assert.False(t, r.HasErrors(), findings(r))
+	})
+
+	t.Run("error__unknown_field", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(configFile, []byte("sites:\n  sitez: []\n"), 0o600))
+		r := Run(configFile)
+		assert.True(t, r.HasErrors())
+		assert.Equal(t, []string{"FAIL|config"}, findings(r))
+	})
+
+	t.Run("error__invalid_hook_queue", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(configFile, []byte("hook_queue:\n  max_attempts: 0\n"), 0o600))
+		r := Run(configFile)
+		assert.True(t, r.HasErrors())
+		assert.Equal(t, []string{"FAIL|config"}, findings(r))
+	})
+}
+
+func TestCheckLogging(t *testing.T) {
+	dir := t.TempDir()
+
+	testCases := []struct {
+		name             string
+		cfg              config.LoggingConfig
+		expectedSeverity Severity
+	}{
+		{name: "happy", cfg: config.LoggingConfig{Level: "info", Format: "json", Outputs: []config.LogOutputConfig{{Path: "stdout"}, {Path: path.Join(dir, "webploy.log")}}}, expectedSeverity: SeverityOK},
+		{name: "error__invalid_level", cfg: config.LoggingConfig{Level: "loud", Format: "json"}, expectedSeverity: SeverityError},
+		{name: "error__missing_dir", cfg: config.LoggingConfig{Level: "info", Format: "json", Outputs: []config.LogOutputConfig{{Path: path.Join(dir, "missing", "webploy.log")}}}, expectedSeverity: SeverityError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Report{}
+			checkLogging(r, tc.cfg)
+			assert.Len(t, r.Findings, 1)
+			assert.Equal(t, tc.expectedSeverity, r.Findings[0].Severity)
+		})
+	}
+}
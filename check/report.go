@@ -0,0 +1,81 @@
+package check
+
+import (
+	"fmt"
+	"io"
+)
+
+type Severity int
+
+const (
+	SeverityOK Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityOK:
+		return " OK "
+	case SeverityWarning:
+		return "WARN"
+	case SeverityError:
+		return "FAIL"
+	}
+	return "????"
+}
+
+// Finding is the result of a single check
+type Finding struct {
+	Severity Severity
+	Subject  string // what was checked, e.g. site "my_site"
+	Message  string
+}
+
+// Report collects the findings of all checks
+type Report struct {
+	Findings []Finding
+}
+
+func (r *Report) add(severity Severity, subject, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{
+		Severity: severity,
+		Subject:  subject,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (r *Report) ok(subject, format string, args ...any) {
+	r.add(SeverityOK, subject, format, args...)
+}
+
+func (r *Report) warn(subject, format string, args ...any) {
+	r.add(SeverityWarning, subject, format, args...)
+}
+
+func (r *Report) fail(subject, format string, args ...any) {
+	r.add(SeverityError, subject, format, args...)
+}
+
+func (r *Report) count(severity Severity) int {
+	var cnt int
+	for _, f := range r.Findings {
+		if f.Severity == severity {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// HasErrors tells if any of the checks failed, warnings are not counted
+func (r *Report) HasErrors() bool {
+	return r.count(SeverityError) > 0
+}
+
+// Print writes the human-readable report to w
+func (r *Report) Print(w io.Writer) {
+	for _, f := range r.Findings {
+		_, _ = fmt.Fprintf(w, "[%s] %s: %s\n", f.Severity, f.Subject, f.Message)
+	}
+	_, _ = fmt.Fprintf(w, "\n%d error(s), %d warning(s)\n", r.count(SeverityError), r.count(SeverityWarning))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"github.com/marcsello/webploy-server/check"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/hooks"
+	"gitlab.com/MikeTTh/env"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+// runCommand runs a subcommand instead of the server, returns the exit code
+func runCommand(command string, args []string) int {
+	switch command {
+	case "check-config":
+		return checkConfigCommand(args)
+	case "print-config":
+		return printConfigCommand(args)
+	case hooks.LimitHelperCommand: // not listed, only used internally
+		return hooks.RunLimitHelper(args)
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "unknown command: %s\navailable commands: check-config, print-config\n", command)
+		return 2
+	}
+}
+
+// configPathFromArgs returns the config path from the first argument, or WEBPLOY_CONFIG if there are no arguments
+func configPathFromArgs(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return env.String("WEBPLOY_CONFIG", config.ConfigDefaultPath)
+}
+
+// checkConfigCommand validates the config file (WEBPLOY_CONFIG or the first argument), and everything it refers to
+func checkConfigCommand(args []string) int {
+	report := check.Run(configPathFromArgs(args))
+	report.Print(os.Stdout)
+
+	if report.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
+// printConfigCommand prints the effective config (the config file merged with the env-var overrides), with the secrets redacted
+func printConfigCommand(args []string) int {
+	cfg, err := config.LoadConfigFile(configPathFromArgs(args), zap.NewNop())
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "could not load config: %s\n", err)
+		return 1
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	err = encoder.Encode(cfg.Redacted())
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "could not print config: %s\n", err)
+		return 1
+	}
+	return 0
+}
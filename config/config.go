@@ -11,10 +11,15 @@ import (
 const ConfigDefaultPath = "/etc/webploy/webploy.conf"
 
 func LoadConfig(logger *zap.Logger) (WebployConfig, error) {
+	configPath := env.String("WEBPLOY_CONFIG", ConfigDefaultPath)
+	return LoadConfigFile(configPath, logger)
+}
+
+// LoadConfigFile loads the config from the given path, unknown fields are treated as errors
+func LoadConfigFile(configPath string, logger *zap.Logger) (WebployConfig, error) {
 	var err error
 
 	// open file
-	configPath := env.String("WEBPLOY_CONFIG", ConfigDefaultPath)
 	logger.Info("Loading config", zap.String("configPath", configPath))
 
 	var configFile *os.File
@@ -46,7 +51,27 @@ func LoadConfig(logger *zap.Logger) (WebployConfig, error) {
 		return WebployConfig{}, err
 	}
 
-	logger.Debug("Config successfully loaded", zap.Any("config", newConfig))
+	// merge the sites from the include dir
+	err = newConfig.Sites.loadIncludeDir(configPath)
+	if err != nil {
+		return WebployConfig{}, err
+	}
+
+	// env-vars take precedence over the file
+	err = applyEnvOverrides(&newConfig, os.Environ(), logger)
+	if err != nil {
+		return WebployConfig{}, err
+	}
+	err = newConfig.Sites.validate() // the overrides skip the checks of un-marshalling
+	if err != nil {
+		return WebployConfig{}, err
+	}
+	err = newConfig.HookQueue.validate()
+	if err != nil {
+		return WebployConfig{}, err
+	}
+
+	logger.Debug("Config successfully loaded", zap.Any("config", newConfig.Redacted()))
 	// very good
 	return newConfig, nil
 }
@@ -15,6 +15,7 @@ func TestLoadConfig(t *testing.T) {
 		name           string
 		configYAML     string
 		dontCreateFile bool
+		env            map[string]string
 		expectedConfig WebployConfig
 		expectedErr    error
 	}{
@@ -33,6 +34,17 @@ func TestLoadConfig(t *testing.T) {
 				Authorization: AuthorizationProviderConfig{
 					PolicyFile: "/etc/webploy/policy.csv",
 				},
+				Logging: LoggingConfig{
+					Level:    "info",
+					Format:   "json",
+					Sampling: LogSamplingConfig{Initial: 100, Thereafter: 100},
+				},
+				HookQueue: HookQueueConfig{
+					Workers:        2,
+					MaxAttempts:    5,
+					InitialBackoff: 10 * time.Second,
+					MaxBackoff:     10 * time.Minute,
+				},
 			},
 		},
 		{
@@ -61,18 +73,36 @@ sites:
 							LiveLinkName:         "live",
 							GoLiveOnFinish:       true,
 							StaleCleanupTimeout:  time.Minute * 30,
-							Hooks:                HooksConfig{},
+							Hooks:                HooksConfig{Script: ScriptConfig{Timeout: 10 * time.Minute, GracePeriod: 5 * time.Second, MaxOutputKB: 1024}, Webhook: WebhookConfig{Timeout: 10 * time.Second}},
 						},
 					},
 				},
 				Authentication: AuthenticationProviderConfig{
 					BasicAuth: &AuthenticationProviderBasicAuth{
 						HTPasswdFile: "/etc/webploy/.htpasswd",
+						Lockout: BasicAuthLockoutConfig{
+							IPThreshold:   10,
+							UserThreshold: 5,
+							BaseDuration:  time.Second * 30,
+							MaxDuration:   time.Hour,
+							ForgetAfter:   time.Hour,
+						},
 					},
 				},
 				Authorization: AuthorizationProviderConfig{
 					PolicyFile: "/etc/webploy/policy.csv",
 				},
+				Logging: LoggingConfig{
+					Level:    "info",
+					Format:   "json",
+					Sampling: LogSamplingConfig{Initial: 100, Thereafter: 100},
+				},
+				HookQueue: HookQueueConfig{
+					Workers:        2,
+					MaxAttempts:    5,
+					InitialBackoff: 10 * time.Second,
+					MaxBackoff:     10 * time.Minute,
+				},
 			},
 		},
 		{
@@ -132,11 +162,13 @@ sites:
 							GoLiveOnFinish:       false,
 							StaleCleanupTimeout:  time.Minute * 30,
 							Hooks: HooksConfig{
-								PreCreate:  "test1",
-								PreFinish:  "test2",
-								PostFinish: "test3",
-								PreLive:    "test4",
-								PostLive:   "test5",
+								PreCreate:  HookList{{Path: "test1", OnFailure: HookOnFailureAbort}},
+								PreFinish:  HookList{{Path: "test2", OnFailure: HookOnFailureAbort}},
+								PostFinish: HookList{{Path: "test3", OnFailure: HookOnFailureAbort}},
+								PreLive:    HookList{{Path: "test4", OnFailure: HookOnFailureAbort}},
+								PostLive:   HookList{{Path: "test5", OnFailure: HookOnFailureAbort}},
+								Script:     ScriptConfig{Timeout: 10 * time.Minute, GracePeriod: 5 * time.Second, MaxOutputKB: 1024},
+								Webhook:    WebhookConfig{Timeout: 10 * time.Second},
 							},
 						},
 						{
@@ -148,11 +180,13 @@ sites:
 							GoLiveOnFinish:       true,
 							StaleCleanupTimeout:  time.Minute * 30,
 							Hooks: HooksConfig{
-								PreCreate:  "test6",
-								PreFinish:  "test7",
-								PostFinish: "test8",
-								PreLive:    "test9",
-								PostLive:   "test10",
+								PreCreate:  HookList{{Path: "test6", OnFailure: HookOnFailureAbort}},
+								PreFinish:  HookList{{Path: "test7", OnFailure: HookOnFailureAbort}},
+								PostFinish: HookList{{Path: "test8", OnFailure: HookOnFailureAbort}},
+								PreLive:    HookList{{Path: "test9", OnFailure: HookOnFailureAbort}},
+								PostLive:   HookList{{Path: "test10", OnFailure: HookOnFailureAbort}},
+								Script:     ScriptConfig{Timeout: 10 * time.Minute, GracePeriod: 5 * time.Second, MaxOutputKB: 1024},
+								Webhook:    WebhookConfig{Timeout: 10 * time.Second},
 							},
 						},
 					},
@@ -160,11 +194,29 @@ sites:
 				Authentication: AuthenticationProviderConfig{
 					BasicAuth: &AuthenticationProviderBasicAuth{
 						HTPasswdFile: "/etc/webploy/.htpasswd",
+						Lockout: BasicAuthLockoutConfig{
+							IPThreshold:   10,
+							UserThreshold: 5,
+							BaseDuration:  time.Second * 30,
+							MaxDuration:   time.Hour,
+							ForgetAfter:   time.Hour,
+						},
 					},
 				},
 				Authorization: AuthorizationProviderConfig{
 					PolicyFile: "/etc/webploy/policy.csv",
 				},
+				Logging: LoggingConfig{
+					Level:    "info",
+					Format:   "json",
+					Sampling: LogSamplingConfig{Initial: 100, Thereafter: 100},
+				},
+				HookQueue: HookQueueConfig{
+					Workers:        2,
+					MaxAttempts:    5,
+					InitialBackoff: 10 * time.Second,
+					MaxBackoff:     10 * time.Minute,
+				},
 			},
 		},
 		{
@@ -172,6 +224,61 @@ sites:
 			configYAML:  `gfad ji a`,
 			expectedErr: fmt.Errorf("cannot unmarshal"),
 		},
+		{
+			name: "error__invalid_env_on_failure",
+			configYAML: `---
+sites:
+  sites:
+    - name: test1
+      hooks:
+        pre_create: "test1"
+`,
+			env:         map[string]string{"WEBPLOY_SITES__SITES__0__HOOKS__PRE_CREATE__0__ON_FAILURE": "bogus"},
+			expectedErr: fmt.Errorf("site test1: invalid on_failure for hook test1: bogus"),
+		},
+		{
+			name: "error__invalid_env_notification_event",
+			configYAML: `---
+sites:
+  sites:
+    - name: test1
+      notifications:
+        - url: "http://example.com"
+`,
+			env:         map[string]string{"WEBPLOY_SITES__SITES__0__NOTIFICATIONS__0__EVENTS": "[exploded]"},
+			expectedErr: fmt.Errorf("site test1: unknown event for notification http://example.com: exploded"),
+		},
+		{
+			name: "error__hook_queue_max_attempts",
+			configYAML: `---
+hook_queue:
+  max_attempts: 0
+`,
+			expectedErr: fmt.Errorf("max_attempts of the hook queue must be at least 1"),
+		},
+		{
+			name: "error__hook_queue_initial_backoff",
+			configYAML: `---
+hook_queue:
+  initial_backoff: 0s
+`,
+			expectedErr: fmt.Errorf("initial_backoff of the hook queue must be positive"),
+		},
+		{
+			name: "error__hook_queue_max_backoff",
+			configYAML: `---
+hook_queue:
+  initial_backoff: 1m
+  max_backoff: 30s
+`,
+			expectedErr: fmt.Errorf("max_backoff of the hook queue can not be less than initial_backoff"),
+		},
+		{
+			name:        "error__hook_queue_env_override",
+			configYAML:  `---`,
+			env:         map[string]string{"WEBPLOY_HOOK_QUEUE__MAX_ATTEMPTS": "0"},
+			expectedErr: fmt.Errorf("max_attempts of the hook queue must be at least 1"),
+		},
 		{
 			name:           "error__missing_file",
 			dontCreateFile: true,
@@ -184,6 +291,9 @@ sites:
 			tmpDir := t.TempDir()
 			tmpCfgFile := path.Join(tmpDir, "webploy.conf")
 			t.Setenv("WEBPLOY_CONFIG", tmpCfgFile)
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
 
 			if !tc.dontCreateFile {
 				assert.NoErrorf(t,
@@ -0,0 +1,33 @@
+package config
+
+import "reflect"
+
+// RestartRequiredChanges compares the running config with a newly loaded one, and returns the keys of the sections that changed, but can not be applied without restarting.
+// Everything else (the list of sites and their settings) can be applied at runtime.
+func RestartRequiredChanges(running, loaded WebployConfig) []string {
+	var changes []string
+
+	if !reflect.DeepEqual(running.Listen, loaded.Listen) {
+		changes = append(changes, "listen")
+	}
+	if !reflect.DeepEqual(running.Authentication, loaded.Authentication) {
+		changes = append(changes, "authentication")
+	}
+	if !reflect.DeepEqual(running.Authorization, loaded.Authorization) {
+		changes = append(changes, "authorization")
+	}
+	if !reflect.DeepEqual(running.Logging, loaded.Logging) {
+		changes = append(changes, "logging")
+	}
+	if !reflect.DeepEqual(running.HookQueue, loaded.HookQueue) {
+		changes = append(changes, "hook_queue")
+	}
+	if running.Sites.Root != loaded.Sites.Root {
+		changes = append(changes, "sites.root")
+	}
+	if running.Sites.ManagedFile != loaded.Sites.ManagedFile {
+		changes = append(changes, "sites.managed_file")
+	}
+
+	return changes
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRestartRequiredChanges(t *testing.T) {
+	base := WebployConfig{
+		Listen: ListenConfig{BindAddr: ":8000"},
+		Authentication: AuthenticationProviderConfig{
+			BasicAuth: &AuthenticationProviderBasicAuth{HTPasswdFile: "/etc/webploy/.htpasswd"},
+		},
+		Authorization: AuthorizationProviderConfig{PolicyFile: "/etc/webploy/policy.csv"},
+		Sites: SitesConfig{
+			Root:  "/var/www",
+			Sites: []SiteConfig{{Name: "test1", MaxHistory: 2}},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		modify   func(cfg *WebployConfig)
+		expected []string
+	}{
+		{
+			name:     "nothing_changed",
+			modify:   func(cfg *WebployConfig) {},
+			expected: nil,
+		},
+		{
+			name: "sites_changed_only",
+			modify: func(cfg *WebployConfig) {
+				cfg.Sites.Sites = []SiteConfig{{Name: "test1", MaxHistory: 5}, {Name: "test2"}}
+			},
+			expected: nil,
+		},
+		{
+			name: "listen_changed",
+			modify: func(cfg *WebployConfig) {
+				cfg.Listen.BindAddr = ":9000"
+			},
+			expected: []string{"listen"},
+		},
+		{
+			name: "auth_changed",
+			modify: func(cfg *WebployConfig) {
+				cfg.Authentication.BasicAuth = &AuthenticationProviderBasicAuth{HTPasswdFile: "/tmp/.htpasswd"}
+				cfg.Authorization.PolicyFile = "/tmp/policy.csv"
+			},
+			expected: []string{"authentication", "authorization"},
+		},
+		{
+			name: "sites_root_changed",
+			modify: func(cfg *WebployConfig) {
+				cfg.Sites.Root = "/srv/www"
+				cfg.Sites.ManagedFile = "/tmp/sites.yaml"
+			},
+			expected: []string{"sites.root", "sites.managed_file"},
+		},
+		{
+			name: "logging_changed",
+			modify: func(cfg *WebployConfig) {
+				cfg.Logging.Level = "debug"
+			},
+			expected: []string{"logging"},
+		},
+		{
+			name: "hook_queue_changed",
+			modify: func(cfg *WebployConfig) {
+				cfg.HookQueue.MaxAttempts = 10
+			},
+			expected: []string{"hook_queue"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			loaded := base
+			loaded.Authentication.BasicAuth = &AuthenticationProviderBasicAuth{HTPasswdFile: base.Authentication.BasicAuth.HTPasswdFile} // the pointed value should be compared, not the pointer
+			tc.modify(&loaded)
+			assert.Equal(t, tc.expected, RestartRequiredChanges(base, loaded))
+		})
+	}
+}
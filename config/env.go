@@ -0,0 +1,366 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/creasty/defaults"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the env-vars overriding config fields. The path of the field is built from the yaml keys separated by EnvSeparator,
+// list elements are addressed by their index, e.g. WEBPLOY_SITES__SITES__0__MAX_OPEN
+const EnvPrefix = "WEBPLOY_"
+
+const EnvSeparator = "__"
+
+// EnvFileSuffix can be appended to any override, to read the value from the file at the given path instead (useful for secrets)
+const EnvFileSuffix = "_FILE"
+
+// RedactedValue replaces the values of the fields tagged with secret:"true" in the redacted config
+const RedactedValue = "<redacted>"
+
+// envReserved are the env-vars with the prefix, that are not config overrides
+var envReserved = map[string]bool{
+	"WEBPLOY_CONFIG": true,
+	"WEBPLOY_DEBUG":  true,
+}
+
+// IsEnvOverride tells if the env-var is a config override, they may contain secrets, so they should not be passed on to the hooks
+func IsEnvOverride(key string) bool {
+	return strings.HasPrefix(key, EnvPrefix) && !envReserved[key]
+}
+
+// applyEnvOverrides overrides the config fields from the env-vars in environ (in the format of os.Environ)
+func applyEnvOverrides(cfg *WebployConfig, environ []string, logger *zap.Logger) error {
+	// sort the keys, so that the result does not depend on the order of the environment
+	overrides := make(map[string]string)
+	var keys []string
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		if !IsEnvOverride(key) {
+			continue
+		}
+		overrides[key] = value
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return envKeyLess(keys[i], keys[j])
+	})
+
+	for _, key := range keys {
+		value := overrides[key]
+		fieldPath := strings.Split(strings.TrimPrefix(key, EnvPrefix), EnvSeparator)
+
+		field, err := envField(reflect.ValueOf(cfg).Elem(), fieldPath)
+		if err != nil && strings.HasSuffix(key, EnvFileSuffix) {
+			// no such field, try reading the value of the field without the suffix from a file
+			fieldPath[len(fieldPath)-1] = strings.TrimSuffix(fieldPath[len(fieldPath)-1], EnvFileSuffix)
+			var fileField reflect.Value
+			fileField, err = envField(reflect.ValueOf(cfg).Elem(), fieldPath)
+			if err == nil {
+				var content []byte
+				content, err = os.ReadFile(value) // #nosec G304
+				if err != nil {
+					return fmt.Errorf("%s: %w", key, err)
+				}
+				field = fileField
+				value = strings.TrimRight(string(content), "\r\n")
+			}
+		}
+		if err != nil {
+			if errors.Is(err, errEnvNoSuchField) {
+				logger.Warn("Ignoring env-var not matching any config field", zap.String("key", key))
+				continue
+			}
+			return fmt.Errorf("%s: %w", key, err)
+		}
+
+		err = setEnvValue(field, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		logger.Debug("Config field overridden from env", zap.String("key", key))
+	}
+
+	return nil
+}
+
+// envKeyLess orders the keys by their path elements, comparing list indexes numerically, so list elements are added in order
+func envKeyLess(a, b string) bool {
+	aPath, bPath := strings.Split(a, EnvSeparator), strings.Split(b, EnvSeparator)
+	for i := 0; i < len(aPath) && i < len(bPath); i++ {
+		if aPath[i] == bPath[i] {
+			continue
+		}
+		aIndex, aErr := strconv.Atoi(aPath[i])
+		bIndex, bErr := strconv.Atoi(bPath[i])
+		if aErr == nil && bErr == nil {
+			return aIndex < bIndex
+		}
+		return aPath[i] < bPath[i]
+	}
+	return len(aPath) < len(bPath)
+}
+
+var errEnvNoSuchField = errors.New("no such config field")
+
+// envField finds the field addressed by the path elements, allocating pointers and growing lists as needed
+func envField(v reflect.Value, fieldPath []string) (reflect.Value, error) {
+	if len(fieldPath) == 0 {
+		return v, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			// we may fail later, so don't touch v until the whole path is resolved
+			newValue, err := newWithDefaults(v.Type().Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			field, err := envField(newValue.Elem(), fieldPath)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.Set(newValue)
+			return field, nil
+		}
+		return envField(v.Elem(), fieldPath)
+
+	case reflect.Struct:
+		name := strings.ToLower(fieldPath[0])
+		for i := 0; i < v.NumField(); i++ {
+			tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			if tag == name {
+				return envField(v.Field(i), fieldPath[1:])
+			}
+		}
+		return reflect.Value{}, errEnvNoSuchField
+
+	case reflect.Slice:
+		index, err := strconv.Atoi(fieldPath[0])
+		if err != nil || index < 0 {
+			return reflect.Value{}, errEnvNoSuchField
+		}
+		if index >= v.Len() {
+			if index > v.Len() {
+				return reflect.Value{}, fmt.Errorf("list index %d out of range, elements must be added in order", index)
+			}
+			// resolve the path on a new element first, so that nothing is appended if it's invalid
+			newElem, err := newWithDefaults(v.Type().Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			_, err = envField(newElem.Elem(), fieldPath[1:])
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.Set(reflect.Append(v, newElem.Elem()))
+		}
+		return envField(v.Index(index), fieldPath[1:])
+
+	default:
+		return reflect.Value{}, errEnvNoSuchField
+	}
+}
+
+// newWithDefaults returns a pointer to a new value of the type, with the defaults set for structs
+func newWithDefaults(t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t)
+	if t.Kind() == reflect.Struct {
+		err := defaults.Set(v.Interface())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return v, nil
+}
+
+// setEnvValue sets the field from the string value. Strings are set as-is, everything else is parsed as YAML (e.g. durations, bools, [a, b] lists)
+func setEnvValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+
+	newValue := reflect.New(field.Type())
+	err := yaml.Unmarshal([]byte(value), newValue.Interface())
+	if err != nil {
+		return err
+	}
+	field.Set(newValue.Elem())
+	return nil
+}
+
+// Redacted returns a copy of the config, with the values of the fields tagged with secret:"true" replaced
+func (c WebployConfig) Redacted() WebployConfig {
+	return Redact(c)
+}
+
+// Redact returns a copy of any part of the config, with the values of the fields tagged with secret:"true" replaced
+func Redact[T any](v T) T {
+	var redacted T
+	redactCopy(reflect.ValueOf(&redacted).Elem(), reflect.ValueOf(v))
+	return redacted
+}
+
+// redactable is implemented by the types that keep secrets in unexported fields, which can not be redacted by reflection
+type redactable interface {
+	redacted() any
+}
+
+func redactCopy(dst, src reflect.Value) {
+	if !src.IsValid() {
+		return
+	}
+	if r, ok := src.Interface().(redactable); ok && src.Kind() != reflect.Pointer {
+		dst.Set(reflect.ValueOf(r.redacted()))
+		return
+	}
+
+	switch src.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.New(src.Type().Elem()))
+		redactCopy(dst.Elem(), src.Elem())
+	case reflect.Struct:
+		dst.Set(src) // copies the unexported fields, types keeping secrets in them must implement redactable
+		for i := 0; i < src.NumField(); i++ {
+			if !dst.Field(i).CanSet() {
+				continue
+			}
+			if src.Type().Field(i).Tag.Get("secret") == "true" && !src.Field(i).IsZero() {
+				redactSecret(dst.Field(i), src.Field(i))
+				continue
+			}
+			redactCopy(dst.Field(i), src.Field(i))
+		}
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+		for i := 0; i < src.Len(); i++ {
+			redactCopy(dst.Index(i), src.Index(i))
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		iter := src.MapRange()
+		for iter.Next() {
+			value := reflect.New(src.Type().Elem()).Elem()
+			redactCopy(value, iter.Value())
+			dst.SetMapIndex(iter.Key(), value)
+		}
+	default:
+		dst.Set(src)
+	}
+}
+
+// redactSecret sets dst to the redacted src. A secret is either a string, or a map of strings (e.g. headers), where the keys are kept
+func redactSecret(dst, src reflect.Value) {
+	if src.Kind() != reflect.Map {
+		dst.SetString(RedactedValue)
+		return
+	}
+	dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+	iter := src.MapRange()
+	for iter.Next() {
+		dst.SetMapIndex(iter.Key(), reflect.ValueOf(RedactedValue).Convert(src.Type().Elem()))
+	}
+}
+
+// ErrRedactedSecret is returned by RestoreRedacted when a redacted secret is sent back, but there is no secret to keep in its place
+var ErrRedactedSecret = errors.New("the secret is redacted, but there is no secret to keep")
+
+// RestoreRedacted replaces the secrets of v that are RedactedValue with the secret at the same place in old,
+// so that a redacted config can be edited and sent back without storing the RedactedValue as the secret.
+func RestoreRedacted[T any](v *T, old T) error {
+	return restoreRedacted(reflect.ValueOf(v).Elem(), reflect.ValueOf(old))
+}
+
+// restoreRedacted walks dst and old together, old is invalid where it has no counterpart of dst
+func restoreRedacted(dst, old reflect.Value) error {
+	switch dst.Kind() {
+	case reflect.Pointer:
+		if dst.IsNil() {
+			return nil
+		}
+		if old.IsValid() && !old.IsNil() {
+			old = old.Elem()
+		} else {
+			old = reflect.Value{}
+		}
+		return restoreRedacted(dst.Elem(), old)
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			if !dst.Field(i).CanSet() {
+				continue
+			}
+			var oldField reflect.Value
+			if old.IsValid() {
+				oldField = old.Field(i)
+			}
+			if dst.Type().Field(i).Tag.Get("secret") == "true" {
+				if err := restoreSecret(dst.Field(i), oldField); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := restoreRedacted(dst.Field(i), oldField); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < dst.Len(); i++ {
+			var oldElem reflect.Value
+			if old.IsValid() && i < old.Len() {
+				oldElem = old.Index(i)
+			}
+			if err := restoreRedacted(dst.Index(i), oldElem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restoreSecret restores a single secret, which is either a string, or a map of strings restored key by key
+func restoreSecret(dst, old reflect.Value) error {
+	if dst.Kind() != reflect.Map {
+		if dst.String() != RedactedValue {
+			return nil // changed or removed
+		}
+		if !old.IsValid() || old.String() == "" {
+			return ErrRedactedSecret
+		}
+		dst.SetString(old.String())
+		return nil
+	}
+
+	iter := dst.MapRange()
+	for iter.Next() {
+		if iter.Value().String() != RedactedValue {
+			continue
+		}
+		var oldValue reflect.Value
+		if old.IsValid() && !old.IsNil() {
+			oldValue = old.MapIndex(iter.Key())
+		}
+		if !oldValue.IsValid() || oldValue.String() == "" {
+			return ErrRedactedSecret
+		}
+		dst.SetMapIndex(iter.Key(), oldValue)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"github.com/creasty/defaults"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestApplyEnvOverrides(t *testing.T) {
+	secretFile := path.Join(t.TempDir(), "secret")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("very-secret\n"), 0o600))
+
+	testCases := []struct {
+		name        string
+		environ     []string
+		check       func(t *testing.T, cfg WebployConfig)
+		expectedErr string
+	}{
+		{
+			name: "happy__scalars",
+			environ: []string{
+				"WEBPLOY_LISTEN__BIND_ADDR=:9000",
+				"WEBPLOY_LISTEN__ENABLE_TLS=true",
+				"WEBPLOY_LISTEN__TRUSTED_PROXIES=[127.0.0.1, 10.0.0.0/8]",
+				"WEBPLOY_SITES__ROOT=/srv",
+				"WEBPLOY_CONFIG=ignored",
+				"WEBPLOY_DEBUG=true",
+				"OTHER=ignored",
+			},
+			check: func(t *testing.T, cfg WebployConfig) {
+				assert.Equal(t, ":9000", cfg.Listen.BindAddr)
+				assert.True(t, cfg.Listen.EnableTLS)
+				assert.Equal(t, []string{"127.0.0.1", "10.0.0.0/8"}, cfg.Listen.TrustedProxies)
+				assert.Equal(t, "/srv", cfg.Sites.Root)
+			},
+		},
+		{
+			name: "happy__pointer_allocated_with_defaults",
+			environ: []string{
+				"WEBPLOY_AUTHENTICATION__PRESIGNED__SECRET_FILE=/some/file",
+				"WEBPLOY_AUTHENTICATION__BASIC_AUTH__LOCKOUT__BASE_DURATION=1m",
+			},
+			check: func(t *testing.T, cfg WebployConfig) {
+				assert.Equal(t, "/some/file", cfg.Authentication.Presigned.SecretFile)
+				assert.Equal(t, 15*time.Minute, cfg.Authentication.Presigned.DefaultTTL)
+				assert.Equal(t, time.Minute, cfg.Authentication.BasicAuth.Lockout.BaseDuration)
+				assert.Equal(t, uint(10), cfg.Authentication.BasicAuth.Lockout.IPThreshold)
+			},
+		},
+		{
+			name: "happy__value_from_file",
+			environ: []string{
+				"WEBPLOY_AUTHENTICATION__PRESIGNED__SECRET_FILE=" + secretFile,
+				"WEBPLOY_AUTHENTICATION__PRESIGNED__SECRET=overridden", // unrelated keys are not affected
+				"WEBPLOY_SITES__SITES__0__LINK_NAME_FILE=" + secretFile,
+			},
+			check: func(t *testing.T, cfg WebployConfig) {
+				// SECRET_FILE is a field on its own, so it's not read
+				assert.Equal(t, secretFile, cfg.Authentication.Presigned.SecretFile)
+				assert.Equal(t, "overridden", cfg.Authentication.Presigned.Secret)
+				assert.Equal(t, "very-secret", cfg.Sites.Sites[0].LiveLinkName)
+			},
+		},
+		{
+			name: "happy__sites",
+			environ: []string{
+				"WEBPLOY_SITES__SITES__0__MAX_OPEN=5",
+				"WEBPLOY_SITES__SITES__1__NAME=new",
+				"WEBPLOY_SITES__SITES__1__HOOKS__PRE_CREATE=/hook.sh",
+				"WEBPLOY_SITES__SITES__2__NAME=new2",
+				"WEBPLOY_SITES__SITES__3__NAME=new3",
+				"WEBPLOY_SITES__SITES__4__NAME=new4",
+				"WEBPLOY_SITES__SITES__5__NAME=new5",
+				"WEBPLOY_SITES__SITES__6__NAME=new6",
+				"WEBPLOY_SITES__SITES__7__NAME=new7",
+				"WEBPLOY_SITES__SITES__8__NAME=new8",
+				"WEBPLOY_SITES__SITES__9__NAME=new9",
+				"WEBPLOY_SITES__SITES__10__NAME=new10",
+			},
+			check: func(t *testing.T, cfg WebployConfig) {
+				assert.Len(t, cfg.Sites.Sites, 11)
+				assert.Equal(t, "existing", cfg.Sites.Sites[0].Name)
+				assert.Equal(t, uint(5), cfg.Sites.Sites[0].MaxOpen)
+				assert.Equal(t, "new", cfg.Sites.Sites[1].Name)
+				assert.Equal(t, HookList{{Path: "/hook.sh", OnFailure: HookOnFailureAbort}}, cfg.Sites.Sites[1].Hooks.PreCreate)
+				assert.Equal(t, "live", cfg.Sites.Sites[1].LiveLinkName)
+				assert.Equal(t, "new10", cfg.Sites.Sites[10].Name)
+			},
+		},
+		{
+			name:    "happy__unknown_ignored",
+			environ: []string{"WEBPLOY_LISTEN__BIND_ADRR=:9000", "WEBPLOY_SITES__SITES__1__NAEM=x"},
+			check: func(t *testing.T, cfg WebployConfig) {
+				assert.Equal(t, ":8000", cfg.Listen.BindAddr)
+				assert.Len(t, cfg.Sites.Sites, 1)
+			},
+		},
+		{
+			name:        "error__index_gap",
+			environ:     []string{"WEBPLOY_SITES__SITES__2__NAME=new"},
+			expectedErr: "WEBPLOY_SITES__SITES__2__NAME: list index 2 out of range",
+		},
+		{
+			name:        "error__invalid_value",
+			environ:     []string{"WEBPLOY_SITES__SITES__0__MAX_OPEN=many"},
+			expectedErr: "WEBPLOY_SITES__SITES__0__MAX_OPEN: yaml: unmarshal errors",
+		},
+		{
+			name:        "error__missing_file",
+			environ:     []string{"WEBPLOY_SITES__ROOT_FILE=/nonexistent"},
+			expectedErr: "WEBPLOY_SITES__ROOT_FILE: open /nonexistent",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg WebployConfig
+			assert.NoError(t, defaults.Set(&cfg))
+			existing := SiteConfig{Name: "existing"}
+			assert.NoError(t, defaults.Set(&existing))
+			cfg.Sites.Sites = []SiteConfig{existing}
+
+			err := applyEnvOverrides(&cfg, tc.environ, zaptest.NewLogger(t))
+			if tc.expectedErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				tc.check(t, cfg)
+			}
+		})
+	}
+}
+
+func TestWebployConfig_Redacted(t *testing.T) {
+	cfg := WebployConfig{
+		Authentication: AuthenticationProviderConfig{
+			BasicAuth: &AuthenticationProviderBasicAuth{HTPasswdFile: "/htpasswd"},
+			Presigned: &PresignedConfig{Secret: "very-secret", MaxTTL: time.Hour},
+		},
+		Sites: SitesConfig{Sites: []SiteConfig{{Name: "test"}}},
+	}
+
+	redacted := cfg.Redacted()
+	assert.Equal(t, RedactedValue, redacted.Authentication.Presigned.Secret)
+	assert.Equal(t, time.Hour, redacted.Authentication.Presigned.MaxTTL)
+	assert.Equal(t, cfg.Authentication.BasicAuth, redacted.Authentication.BasicAuth)
+	assert.Equal(t, cfg.Sites, redacted.Sites)
+
+	// the original is not modified
+	assert.Equal(t, "very-secret", cfg.Authentication.Presigned.Secret)
+	redacted.Sites.Sites[0].Name = "changed"
+	assert.Equal(t, "test", cfg.Sites.Sites[0].Name)
+
+	// empty secrets are not redacted, so it's visible that they are not set
+	cfg.Authentication.Presigned.Secret = ""
+	assert.Empty(t, cfg.Redacted().Authentication.Presigned.Secret)
+
+	// the secrets of the sites are redacted as well
+	cfg.Sites.Sites[0].Notifications = []NotificationConfig{{URL: "https://example.com/events", Secret: "notify-secret"}}
+	assert.Equal(t, RedactedValue, cfg.Redacted().Sites.Sites[0].Notifications[0].Secret)
+	assert.Equal(t, "notify-secret", cfg.Sites.Sites[0].Notifications[0].Secret)
+
+	// the values of the headers are redacted, the names are kept
+	cfg.Sites.Sites[0].Hooks.Webhook.Headers = map[string]string{"Authorization": "Bearer xyz", "X-Empty": ""}
+	assert.Equal(t, map[string]string{"Authorization": RedactedValue, "X-Empty": RedactedValue}, cfg.Redacted().Sites.Sites[0].Hooks.Webhook.Headers)
+	assert.Equal(t, "Bearer xyz", cfg.Sites.Sites[0].Hooks.Webhook.Headers["Authorization"])
+	cfg.Sites.Sites[0].Notifications[0].Headers = map[string]string{"Authorization": "Bearer abc"}
+	assert.Equal(t, map[string]string{"Authorization": RedactedValue}, cfg.Redacted().Sites.Sites[0].Notifications[0].Headers)
+}
+
+func TestRestoreRedacted(t *testing.T) {
+	old := SiteConfig{
+		Name:          "test",
+		Hooks:         HooksConfig{Webhook: WebhookConfig{Secret: "webhook-secret", Headers: map[string]string{"Authorization": "Bearer xyz"}}},
+		Notifications: []NotificationConfig{{URL: "https://example.com/a", Secret: "notify-secret"}},
+	}
+
+	testCases := []struct {
+		name        string
+		cfg         SiteConfig
+		expected    SiteConfig
+		expectedErr error
+	}{
+		{
+			name:     "happy__kept",
+			cfg:      Redact(old),
+			expected: old,
+		},
+		{
+			name:     "happy__changed",
+			cfg:      SiteConfig{Name: "test", Hooks: HooksConfig{Webhook: WebhookConfig{Secret: "new-secret"}}},
+			expected: SiteConfig{Name: "test", Hooks: HooksConfig{Webhook: WebhookConfig{Secret: "new-secret"}}},
+		},
+		{
+			name:     "happy__header_changed",
+			cfg:      SiteConfig{Name: "test", Hooks: HooksConfig{Webhook: WebhookConfig{Secret: RedactedValue, Headers: map[string]string{"Authorization": RedactedValue, "X-New": "new"}}}},
+			expected: SiteConfig{Name: "test", Hooks: HooksConfig{Webhook: WebhookConfig{Secret: "webhook-secret", Headers: map[string]string{"Authorization": "Bearer xyz", "X-New": "new"}}}},
+		},
+		{
+			name:        "error__unknown_header",
+			cfg:         SiteConfig{Name: "test", Hooks: HooksConfig{Webhook: WebhookConfig{Headers: map[string]string{"X-Other": RedactedValue}}}},
+			expectedErr: ErrRedactedSecret,
+		},
+		{
+			name:     "happy__removed",
+			cfg:      SiteConfig{Name: "test"},
+			expected: SiteConfig{Name: "test"},
+		},
+		{
+			name:        "error__nothing_to_keep",
+			cfg:         SiteConfig{Name: "test", Notifications: []NotificationConfig{{URL: "https://example.com/a", Secret: RedactedValue}, {URL: "https://example.com/b", Secret: RedactedValue}}},
+			expectedErr: ErrRedactedSecret,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := RestoreRedacted(&tc.cfg, old)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, tc.cfg)
+			}
+		})
+	}
+}
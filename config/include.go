@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// IncludeFilePattern is the pattern of the files loaded from the sites include directory
+const IncludeFilePattern = "*.yaml"
+
+// loadIncludeDir merges the sites defined in the include dir into the list of sites. configPath is the path of the main config file,
+// it is used to resolve relative include dirs and to name the origin of duplicated sites.
+func (sc *SitesConfig) loadIncludeDir(configPath string) error {
+	if sc.IncludeDir == "" {
+		return nil
+	}
+
+	includeDir := sc.IncludeDir
+	if !filepath.IsAbs(includeDir) {
+		includeDir = filepath.Join(filepath.Dir(configPath), includeDir)
+	}
+
+	// Glob does not report a missing dir, so check it first
+	dirInfo, err := os.Stat(includeDir)
+	if err != nil {
+		return fmt.Errorf("sites include dir: %w", err)
+	}
+	if !dirInfo.IsDir() {
+		return fmt.Errorf("sites include dir: %s is not a directory", includeDir)
+	}
+
+	var files []string
+	files, err = filepath.Glob(filepath.Join(includeDir, IncludeFilePattern))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	origins := make(map[string]string, len(sc.Sites))
+	for _, s := range sc.Sites {
+		if origin, duplicate := origins[s.Name]; duplicate {
+			return fmt.Errorf("duplicate site config: %s (defined twice in %s)", s.Name, origin)
+		}
+		origins[s.Name] = configPath
+	}
+
+	for _, file := range files {
+		var layers []*SiteConfigLayer
+		layers, err = loadSitesFile(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		for _, layer := range layers {
+			var s SiteConfig
+			s, err = sc.ResolveSite(layer)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			if origin, duplicate := origins[s.Name]; duplicate {
+				return fmt.Errorf("%s: duplicate site config: %s (already defined in %s)", file, s.Name, origin)
+			}
+			origins[s.Name] = file
+			sc.Sites = append(sc.Sites, s)
+		}
+	}
+
+	return nil
+}
+
+// loadSitesFile loads a site file from the include dir, the file may contain a single site, or a list of sites
+func loadSitesFile(path string) ([]*SiteConfigLayer, error) {
+	content, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+
+	// peek at the document first, to see if it's a list or a single site
+	var doc yaml.Node
+	err = yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil // empty file
+	}
+
+	// decode again, so that unknown fields are rejected (Node.Decode does not support that)
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	switch doc.Content[0].Kind {
+	case yaml.SequenceNode:
+		var sites []*SiteConfigLayer
+		err = decoder.Decode(&sites)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		return sites, nil
+	case yaml.MappingNode:
+		var s SiteConfigLayer
+		err = decoder.Decode(&s)
+		if err != nil {
+			return nil, err
+		}
+		return []*SiteConfigLayer{&s}, nil
+	default:
+		return nil, fmt.Errorf("expected a site or a list of sites")
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func defaultSiteConfig(name string) SiteConfig {
+	return SiteConfig{
+		Name:                 name,
+		MaxHistory:           2,
+		MaxOpen:              2,
+		MaxConcurrentUploads: 10,
+		LiveLinkName:         "live",
+		GoLiveOnFinish:       true,
+		StaleCleanupTimeout:  time.Minute * 30,
+		Hooks:                HooksConfig{Script: ScriptConfig{Timeout: 10 * time.Minute, GracePeriod: 5 * time.Second, MaxOutputKB: 1024}, Webhook: WebhookConfig{Timeout: 10 * time.Second}},
+	}
+}
+
+func TestLoadConfigFile_IncludeDir(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configYAML    string
+		includeFiles  map[string]string
+		expectedSites []SiteConfig
+		expectedErr   string
+	}{
+		{
+			name: "happy__single_and_list",
+			configYAML: `
+sites:
+  include_dir: sites.d
+  sites:
+    - name: main
+`,
+			includeFiles: map[string]string{
+				"b.yaml":     "- name: b1\n- name: b2\n  max_open: 5\n",
+				"a.yaml":     "name: a\n",
+				"c.yml":      "name: ignored\n",
+				"empty.yaml": "",
+			},
+			expectedSites: []SiteConfig{
+				defaultSiteConfig("main"),
+				defaultSiteConfig("a"),
+				defaultSiteConfig("b1"),
+				func() SiteConfig { s := defaultSiteConfig("b2"); s.MaxOpen = 5; return s }(),
+			},
+		},
+		{
+			name:          "happy__empty_dir",
+			configYAML:    "sites:\n  include_dir: sites.d\n",
+			includeFiles:  map[string]string{},
+			expectedSites: []SiteConfig{},
+		},
+		{
+			name:         "error__duplicate_with_main",
+			configYAML:   "sites:\n  include_dir: sites.d\n  sites:\n    - name: a\n",
+			includeFiles: map[string]string{"a.yaml": "name: a\n"},
+			expectedErr:  "a.yaml: duplicate site config: a (already defined in ",
+		},
+		{
+			name:         "error__duplicate_between_files",
+			configYAML:   "sites:\n  include_dir: sites.d\n",
+			includeFiles: map[string]string{"a.yaml": "name: a\n", "b.yaml": "- name: a\n"},
+			expectedErr:  "b.yaml: duplicate site config: a (already defined in ",
+		},
+		{
+			name:         "error__unknown_field",
+			configYAML:   "sites:\n  include_dir: sites.d\n",
+			includeFiles: map[string]string{"a.yaml": "name: a\nmax_opne: 3\n"},
+			expectedErr:  "a.yaml: yaml: unmarshal errors",
+		},
+		{
+			name:         "error__not_a_site",
+			configYAML:   "sites:\n  include_dir: sites.d\n",
+			includeFiles: map[string]string{"a.yaml": "just a string\n"},
+			expectedErr:  "a.yaml: expected a site or a list of sites",
+		},
+		{
+			name:        "error__missing_dir",
+			configYAML:  "sites:\n  include_dir: sites.d\n",
+			expectedErr: "sites include dir",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfgFile := path.Join(tmpDir, "webploy.conf")
+			assert.NoError(t, os.WriteFile(cfgFile, []byte(tc.configYAML), 0o640))
+
+			if tc.includeFiles != nil {
+				includeDir := path.Join(tmpDir, "sites.d")
+				assert.NoError(t, os.Mkdir(includeDir, 0o750))
+				for name, content := range tc.includeFiles {
+					assert.NoError(t, os.WriteFile(path.Join(includeDir, name), []byte(content), 0o640))
+				}
+			}
+
+			cfg, err := LoadConfigFile(cfgFile, zaptest.NewLogger(t))
+			if tc.expectedErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedSites, cfg.Sites.Sites)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"fmt"
+	"github.com/creasty/defaults"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+)
+
+// SiteConfigLayer is a partial site config: the sites.defaults block, a template or a site entry.
+// It remembers which fields were set in it, so that only those are applied when the layers are merged.
+type SiteConfigLayer struct {
+	cfg      SiteConfig
+	template string
+	set      map[string]any // the layer as a generic map, used to tell which fields were set
+}
+
+func (l *SiteConfigLayer) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// the plain type skips SiteConfig.UnmarshalYAML, defaults are set when merging the layers, not for each of them
+	type plain SiteConfig
+	var layer struct {
+		plain    `yaml:",inline"`
+		Template string `yaml:"template"`
+	}
+	if err := unmarshal(&layer); err != nil {
+		return err
+	}
+	if err := unmarshal(&l.set); err != nil {
+		return err
+	}
+	l.cfg = SiteConfig(layer.plain)
+	l.template = layer.Template
+	return nil
+}
+
+// MarshalYAML returns the layer as it was written in the config
+func (l SiteConfigLayer) MarshalYAML() (interface{}, error) {
+	return l.set, nil
+}
+
+// redacted returns a copy of the layer with the secrets redacted, in the set map as well
+func (l SiteConfigLayer) redacted() any {
+	redacted := SiteConfigLayer{
+		cfg:      Redact(l.cfg),
+		template: l.template,
+	}
+
+	// the set map is rebuilt from the redacted config, keeping only the keys that were set in the layer
+	raw, err := yaml.Marshal(redacted.cfg)
+	var full map[string]any
+	if err == nil {
+		err = yaml.Unmarshal(raw, &full)
+	}
+	if err != nil {
+		return redacted // better to lose the set fields than leaking a secret
+	}
+	redacted.set = limitToSet(full, l.set)
+	return redacted
+}
+
+// limitToSet returns the values of full for the keys in set, nested maps (and maps in lists) are limited the same way
+func limitToSet(full, set map[string]any) map[string]any {
+	limited := make(map[string]any, len(set))
+	for key, value := range set {
+		fullValue, ok := full[key]
+		if !ok {
+			limited[key] = value // not a field of the config (e.g. template), or it is empty
+			continue
+		}
+		limited[key] = limitValueToSet(fullValue, value)
+	}
+	return limited
+}
+
+func limitValueToSet(fullValue, setValue any) any {
+	switch setValue := setValue.(type) {
+	case map[string]any:
+		if fullMap, ok := fullValue.(map[string]any); ok {
+			return limitToSet(fullMap, setValue)
+		}
+	case []any:
+		if fullList, ok := fullValue.([]any); ok && len(fullList) == len(setValue) {
+			limited := make([]any, len(setValue))
+			for i := range setValue {
+				limited[i] = limitValueToSet(fullList[i], setValue[i])
+			}
+			return limited
+		}
+	}
+	return fullValue
+}
+
+// isSet returns true if the key is set in the layer
+func (l *SiteConfigLayer) isSet(key string) bool {
+	_, ok := l.set[key]
+	return ok
+}
+
+// applyTo overwrites the fields of dst that are set in this layer
+func (l *SiteConfigLayer) applyTo(dst *SiteConfig) {
+	applySet(reflect.ValueOf(dst).Elem(), reflect.ValueOf(l.cfg), l.set)
+}
+
+// applySet copies the fields of src to dst that are set, nested structs are merged field by field
+func applySet(dst, src reflect.Value, set map[string]any) {
+	for f := 0; f < src.NumField(); f++ {
+		tag, _, _ := strings.Cut(src.Type().Field(f).Tag.Get("yaml"), ",")
+		value, ok := set[tag]
+		if !ok {
+			continue
+		}
+
+		nestedSet, isMap := value.(map[string]any)
+		if src.Field(f).Kind() == reflect.Struct && isMap {
+			applySet(dst.Field(f), src.Field(f), nestedSet)
+		} else {
+			dst.Field(f).Set(src.Field(f))
+		}
+	}
+}
+
+func (sc *SitesConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// sites are decoded as layers first, and then merged with the defaults and the templates.
+	// This mirrors SitesConfig, because the sites field can not be replaced when inlining it.
+	raw := struct {
+		Root        string                      `yaml:"root"`
+		Sites       []*SiteConfigLayer          `yaml:"sites"`
+		ManagedFile string                      `yaml:"managed_file"`
+		IncludeDir  string                      `yaml:"include_dir"`
+		Defaults    *SiteConfigLayer            `yaml:"defaults"`
+		Templates   map[string]*SiteConfigLayer `yaml:"templates"`
+	}{
+		Root:        sc.Root,
+		ManagedFile: sc.ManagedFile,
+		IncludeDir:  sc.IncludeDir,
+		Defaults:    sc.Defaults,
+		Templates:   sc.Templates,
+	}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	sc.Root = raw.Root
+	sc.ManagedFile = raw.ManagedFile
+	sc.IncludeDir = raw.IncludeDir
+	sc.Defaults = raw.Defaults
+	sc.Templates = raw.Templates
+
+	if sc.Defaults != nil {
+		if err := validateSharedLayer(sc.Defaults); err != nil {
+			return fmt.Errorf("sites.defaults: %w", err)
+		}
+	}
+	for name, template := range sc.Templates {
+		if err := validateSharedLayer(template); err != nil {
+			return fmt.Errorf("sites.templates.%s: %w", name, err)
+		}
+	}
+
+	if raw.Sites == nil {
+		return nil // keep the default
+	}
+	sc.Sites = make([]SiteConfig, 0, len(raw.Sites))
+	for i, layer := range raw.Sites {
+		s, err := sc.ResolveSite(layer)
+		if err != nil {
+			return fmt.Errorf("sites.sites[%d]: %w", i, err)
+		}
+		sc.Sites = append(sc.Sites, s)
+	}
+	return nil
+}
+
+// validateSharedLayer checks that the layer (the defaults or a template) does not set site specific fields
+func validateSharedLayer(l *SiteConfigLayer) error {
+	for _, key := range []string{"name", "template"} {
+		if l.isSet(key) {
+			return fmt.Errorf("%s can not be set here", key)
+		}
+	}
+	return nil
+}
+
+// ResolveSite merges the defaults, the template referenced by the site (if any), and the site itself, in this order
+func (sc *SitesConfig) ResolveSite(layer *SiteConfigLayer) (SiteConfig, error) {
+	var s SiteConfig
+	err := defaults.Set(&s)
+	if err != nil {
+		return SiteConfig{}, err
+	}
+
+	if sc.Defaults != nil {
+		sc.Defaults.applyTo(&s)
+	}
+	if layer.template != "" {
+		template, ok := sc.Templates[layer.template]
+		if !ok {
+			return SiteConfig{}, fmt.Errorf("unknown template: %s", layer.template)
+		}
+		template.applyTo(&s)
+	}
+	layer.applyTo(&s)
+
+	return s, nil
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSitesConfig_DefaultsAndTemplates(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configYAML    string
+		includeFile   string
+		expectedSites func() []SiteConfig
+		expectedErr   string
+	}{
+		{
+			name: "happy__merge_order",
+			configYAML: `
+sites:
+  defaults:
+    max_history: 5
+    go_live_on_finish: false
+    hooks:
+      pre_create: /defaults/pre_create.sh
+      post_live: /defaults/post_live.sh
+  templates:
+    static-spa:
+      max_history: 3
+      max_open: 1
+      hooks:
+        post_live: /template/post_live.sh
+  sites:
+    - name: plain
+    - name: templated
+      template: static-spa
+    - name: overridden
+      template: static-spa
+      max_open: 4
+      go_live_on_finish: true
+      hooks:
+        pre_create: /site/pre_create.sh
+`,
+			expectedSites: func() []SiteConfig {
+				plain := defaultSiteConfig("plain")
+				plain.MaxHistory = 5
+				plain.GoLiveOnFinish = false
+				plain.Hooks.PreCreate = HookList{{Path: "/defaults/pre_create.sh", OnFailure: HookOnFailureAbort}}
+				plain.Hooks.PostLive = HookList{{Path: "/defaults/post_live.sh", OnFailure: HookOnFailureAbort}}
+
+				templated := defaultSiteConfig("templated")
+				templated.MaxHistory = 3
+				templated.MaxOpen = 1
+				templated.GoLiveOnFinish = false
+				templated.Hooks.PreCreate = HookList{{Path: "/defaults/pre_create.sh", OnFailure: HookOnFailureAbort}}
+				templated.Hooks.PostLive = HookList{{Path: "/template/post_live.sh", OnFailure: HookOnFailureAbort}}
+
+				overridden := defaultSiteConfig("overridden")
+				overridden.MaxHistory = 3
+				overridden.MaxOpen = 4
+				overridden.Hooks.PreCreate = HookList{{Path: "/site/pre_create.sh", OnFailure: HookOnFailureAbort}}
+				overridden.Hooks.PostLive = HookList{{Path: "/template/post_live.sh", OnFailure: HookOnFailureAbort}}
+
+				return []SiteConfig{plain, templated, overridden}
+			},
+		},
+		{
+			name: "happy__zero_values_override",
+			configYAML: `
+sites:
+  defaults:
+    stale_cleanup_timeout: 1h
+  sites:
+    - name: site
+      stale_cleanup_timeout: 0s
+`,
+			expectedSites: func() []SiteConfig {
+				s := defaultSiteConfig("site")
+				s.StaleCleanupTimeout = 0
+				return []SiteConfig{s}
+			},
+		},
+		{
+			name: "happy__include_dir",
+			configYAML: `
+sites:
+  include_dir: sites.d
+  defaults:
+    max_history: 7
+  templates:
+    t:
+      link_name: current
+`,
+			includeFile: "name: included\ntemplate: t\n",
+			expectedSites: func() []SiteConfig {
+				s := defaultSiteConfig("included")
+				s.MaxHistory = 7
+				s.LiveLinkName = "current"
+				return []SiteConfig{s}
+			},
+		},
+		{
+			name:        "error__unknown_template",
+			configYAML:  "sites:\n  sites:\n    - name: site\n      template: missing\n",
+			expectedErr: "sites.sites[0]: unknown template: missing",
+		},
+		{
+			name:        "error__unknown_template_include_dir",
+			configYAML:  "sites:\n  include_dir: sites.d\n",
+			includeFile: "name: site\ntemplate: missing\n",
+			expectedErr: "site.yaml: unknown template: missing",
+		},
+		{
+			name:        "error__name_in_defaults",
+			configYAML:  "sites:\n  defaults:\n    name: site\n",
+			expectedErr: "sites.defaults: name can not be set here",
+		},
+		{
+			name:        "error__template_in_template",
+			configYAML:  "sites:\n  templates:\n    a:\n      template: b\n",
+			expectedErr: "sites.templates.a: template can not be set here",
+		},
+		{
+			name:        "error__unknown_field_in_template",
+			configYAML:  "sites:\n  templates:\n    a:\n      max_opne: 2\n",
+			expectedErr: "field max_opne not found",
+		},
+		{
+			name:        "error__unknown_field_in_site",
+			configYAML:  "sites:\n  sites:\n    - name: a\n      hooks:\n        pre_craete: /a.sh\n",
+			expectedErr: "field pre_craete not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfgFile := path.Join(tmpDir, "webploy.conf")
+			assert.NoError(t, os.WriteFile(cfgFile, []byte(tc.configYAML), 0o640))
+			if tc.includeFile != "" {
+				assert.NoError(t, os.Mkdir(path.Join(tmpDir, "sites.d"), 0o750))
+				assert.NoError(t, os.WriteFile(path.Join(tmpDir, "sites.d", "site.yaml"), []byte(tc.includeFile), 0o640))
+			}
+
+			cfg, err := LoadConfigFile(cfgFile, zaptest.NewLogger(t))
+			if tc.expectedErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedSites(), cfg.Sites.Sites)
+			}
+		})
+	}
+}
+
+func TestSiteConfigLayer_MarshalYAML(t *testing.T) {
+	var sc SitesConfig
+	assert.NoError(t, yaml.Unmarshal([]byte("defaults:\n  max_open: 3\n  hooks:\n    pre_live: /a.sh\n"), &sc))
+
+	out, err := yaml.Marshal(sc.Defaults)
+	assert.NoError(t, err)
+
+	var roundTrip map[string]any
+	assert.NoError(t, yaml.Unmarshal(out, &roundTrip))
+	assert.Equal(t, map[string]any{"max_open": 3, "hooks": map[string]any{"pre_live": "/a.sh"}}, roundTrip)
+	assert.Equal(t, time.Duration(0), sc.Defaults.cfg.StaleCleanupTimeout) // no defaults are set on the layers
+}
+
+func TestWebployConfig_Redacted_Layers(t *testing.T) {
+	var cfg WebployConfig
+	assert.NoError(t, yaml.Unmarshal([]byte("sites:\n  defaults:\n    max_open: 3\n  templates:\n    t:\n      max_history: 1\n"), &cfg))
+
+	redacted := cfg.Redacted()
+	assert.Equal(t, cfg.Sites.Defaults, redacted.Sites.Defaults)
+	assert.Equal(t, cfg.Sites.Templates, redacted.Sites.Templates)
+
+	// the secrets of the layers are redacted, both in the merged sites and in the layers themselves
+	cfg = WebployConfig{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+sites:
+  defaults:
+    hooks:
+      webhook:
+        secret: topsecret-defaults
+  templates:
+    t:
+      max_history: 1
+      notifications:
+        - url: https://example.com/events
+          secret: template-secret
+  sites:
+    - name: s
+      template: t
+`), &cfg))
+
+	redacted = cfg.Redacted()
+	out, err := yaml.Marshal(redacted)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(out), "topsecret-defaults")
+	assert.NotContains(t, string(out), "template-secret")
+
+	defaultsOut, err := yaml.Marshal(redacted.Sites.Defaults)
+	assert.NoError(t, err)
+	assert.Equal(t, "hooks:\n    webhook:\n        secret: <redacted>\n", string(defaultsOut))
+	templateOut, err := yaml.Marshal(redacted.Sites.Templates["t"])
+	assert.NoError(t, err)
+	assert.Equal(t, "max_history: 1\nnotifications:\n    - secret: <redacted>\n      url: https://example.com/events\n", string(templateOut))
+	assert.Equal(t, RedactedValue, redacted.Sites.Sites[0].Notifications[0].Secret)
+
+	// the original is not modified
+	assert.Equal(t, "template-secret", cfg.Sites.Sites[0].Notifications[0].Secret)
+	out, err = yaml.Marshal(cfg.Sites.Templates["t"])
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "template-secret")
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"github.com/creasty/defaults"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -11,15 +14,110 @@ type WebployConfig struct {
 	Authentication AuthenticationProviderConfig `yaml:"authentication"`
 	Authorization  AuthorizationProviderConfig  `yaml:"authorization"`
 	Sites          SitesConfig                  `yaml:"sites"`
+	Logging        LoggingConfig                `yaml:"logging"`
+	HookQueue      HookQueueConfig              `yaml:"hook_queue"`
+}
+
+// LoggingConfig configures the logger, it is ignored in debug mode (WEBPLOY_DEBUG)
+type LoggingConfig struct {
+	Level      string            `yaml:"level" default:"info"`  // debug, info, warn, error
+	Format     string            `yaml:"format" default:"json"` // json or console
+	Outputs    []LogOutputConfig `yaml:"outputs"`               // stderr if empty
+	Sampling   LogSamplingConfig `yaml:"sampling"`
+	Subsystems map[string]string `yaml:"subsystems"` // override the level for some subsystems (api, hooks, jobs, site)
+}
+
+type LogOutputConfig struct {
+	Path       string `yaml:"path"`                      // stdout, stderr or the path of a file
+	MaxSizeMB  uint   `yaml:"max_size_mb" default:"100"` // files are rotated after reaching this size, 0 to disable rotation
+	MaxBackups uint   `yaml:"max_backups" default:"5"`   // number of rotated files to keep
+}
+
+func (loc *LogOutputConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// Same as AuthenticationProviderBasicAuth.UnmarshalYAML
+	err := defaults.Set(loc)
+	if err != nil {
+		return err
+	}
+
+	type plain LogOutputConfig
+	if err = unmarshal((*plain)(loc)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LogSamplingConfig limits the number of identical log entries per second, after Initial entries only every Thereafter-th entry is logged
+type LogSamplingConfig struct {
+	Initial    int `yaml:"initial" default:"100"` // 0 to disable sampling
+	Thereafter int `yaml:"thereafter" default:"100"`
+}
+
+// HookQueueConfig configures the queue of the post_* hooks, these are run in the background, and retried when they fail
+type HookQueueConfig struct {
+	Dir            string        `yaml:"dir"`                           // the queue is persisted here, defaults to .hook_queue in the root of the sites
+	Workers        uint          `yaml:"workers" default:"2"`           // number of hook events run in parallel
+	MaxAttempts    uint          `yaml:"max_attempts" default:"5"`      // the event is moved to the dead letters after this many failed attempts
+	InitialBackoff time.Duration `yaml:"initial_backoff" default:"10s"` // delay before the first retry, doubled for every further retry
+	MaxBackoff     time.Duration `yaml:"max_backoff" default:"10m"`     // upper limit of the delay between retries
+}
+
+func (hqc HookQueueConfig) validate() error {
+	if hqc.MaxAttempts < 1 {
+		return fmt.Errorf("max_attempts of the hook queue must be at least 1")
+	}
+	if hqc.InitialBackoff <= 0 {
+		return fmt.Errorf("initial_backoff of the hook queue must be positive")
+	}
+	if hqc.MaxBackoff < hqc.InitialBackoff {
+		return fmt.Errorf("max_backoff of the hook queue can not be less than initial_backoff")
+	}
+	return nil
 }
 
 type AuthenticationProviderConfig struct {
 	// Currently we only plan to support BasicAuth
 	BasicAuth *AuthenticationProviderBasicAuth `yaml:"basic_auth"`
+
+	// Presigned tokens can be used in addition to the provider above, leave it out to disable them
+	Presigned *PresignedConfig `yaml:"presigned"`
+}
+
+type PresignedConfig struct {
+	Secret     string        `yaml:"secret" secret:"true"` // key used for signing the tokens, either this or SecretFile must be set
+	SecretFile string        `yaml:"secret_file"`          // file containing the key used for signing the tokens
+	DefaultTTL time.Duration `yaml:"default_ttl" default:"15m"`
+	MaxTTL     time.Duration `yaml:"max_ttl" default:"1h"`
+}
+
+func (pc *PresignedConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// Same as AuthenticationProviderBasicAuth.UnmarshalYAML
+	err := defaults.Set(pc)
+	if err != nil {
+		return err
+	}
+
+	type plain PresignedConfig
+	if err = unmarshal((*plain)(pc)); err != nil {
+		return err
+	}
+
+	return nil
 }
 
 type AuthenticationProviderBasicAuth struct {
-	HTPasswdFile string `yaml:"htpasswd_file" default:"/etc/webploy/.htpasswd"`
+	HTPasswdFile string                 `yaml:"htpasswd_file" default:"/etc/webploy/.htpasswd"`
+	Lockout      BasicAuthLockoutConfig `yaml:"lockout"`
+}
+
+// BasicAuthLockoutConfig configures the brute-force protection, clients are locked out temporarily after too many failed attempts
+type BasicAuthLockoutConfig struct {
+	IPThreshold   uint          `yaml:"ip_threshold" default:"10"`   // failed attempts from the same IP address before locking it out, 0 to disable
+	UserThreshold uint          `yaml:"user_threshold" default:"5"`  // failed attempts for the same username before locking it out, 0 to disable
+	BaseDuration  time.Duration `yaml:"base_duration" default:"30s"` // duration of the first lockout, doubled for each consecutive lockout
+	MaxDuration   time.Duration `yaml:"max_duration" default:"1h"`   // upper limit of the lockout duration
+	ForgetAfter   time.Duration `yaml:"forget_after" default:"1h"`   // failures (and previous lockouts) are forgotten after this time without a failed attempt
 }
 
 func (apba *AuthenticationProviderBasicAuth) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -42,18 +140,25 @@ func (apba *AuthenticationProviderBasicAuth) UnmarshalYAML(unmarshal func(interf
 
 type AuthorizationProviderConfig struct {
 	PolicyFile string `yaml:"policy_file" default:"/etc/webploy/policy.csv"`
+	ModelFile  string `yaml:"model_file"` // use a custom casbin model instead of the embedded one
 }
 
 type ListenConfig struct {
-	BindAddr  string `yaml:"bind_addr" default:":8000"`
-	EnableTLS bool   `yaml:"enable_tls" default:"false"`
-	TLSKey    string `yaml:"tls_key"`
-	TLSCert   string `yaml:"tls_cert"`
+	BindAddr       string   `yaml:"bind_addr" default:":8000"`
+	EnableTLS      bool     `yaml:"enable_tls" default:"false"`
+	TLSKey         string   `yaml:"tls_key"`
+	TLSCert        string   `yaml:"tls_cert"`
+	TrustedProxies []string `yaml:"trusted_proxies"` // addresses or CIDRs of reverse proxies allowed to set the client IP through headers (e.g. X-Forwarded-For), none by default
 }
 
 type SitesConfig struct {
-	Root  string       `yaml:"root" default:"/var/www"`
-	Sites []SiteConfig `yaml:"sites" default:"[]"`
+	Root        string       `yaml:"root" default:"/var/www"`
+	Sites       []SiteConfig `yaml:"sites" default:"[]"`
+	ManagedFile string       `yaml:"managed_file"` // sites created through the API are stored here, leave empty to disable managing sites through the API
+	IncludeDir  string       `yaml:"include_dir"`  // every *.yaml file in this directory defines a site or a list of sites, relative to the config file
+
+	Defaults  *SiteConfigLayer            `yaml:"defaults"`  // applied to every site defined in the config (and in the include dir) or created through the API
+	Templates map[string]*SiteConfigLayer `yaml:"templates"` // sites can reference one of these with "template", applied after the defaults
 }
 
 func (sc *SitesConfig) GetConfigForSite(name string) (SiteConfig, bool) {
@@ -67,6 +172,25 @@ func (sc *SitesConfig) GetConfigForSite(name string) (SiteConfig, bool) {
 	return SiteConfig{}, false
 }
 
+// validate repeats the checks done when un-marshalling the sites, for the values that are set by other means (e.g. env-vars)
+func (sc SitesConfig) validate() error {
+	for _, s := range sc.Sites {
+		for _, hl := range s.Hooks.hookLists() {
+			for _, hd := range hl {
+				if err := hd.validate(); err != nil {
+					return fmt.Errorf("site %s: %w", s.Name, err)
+				}
+			}
+		}
+		for _, nc := range s.Notifications {
+			if err := nc.validate(); err != nil {
+				return fmt.Errorf("site %s: %w", s.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
 type SiteConfig struct {
 	Name string `yaml:"name"` // this will be the "resource name" in the authorization
 
@@ -74,12 +198,16 @@ type SiteConfig struct {
 	MaxOpen              uint   `yaml:"max_open" default:"2"`                // how many unfinished uploads to keep open (block new ones until purged)
 	MaxConcurrentUploads uint   `yaml:"max_concurrent_uploads" default:"10"` // set to 0 for no limit
 	LiveLinkName         string `yaml:"link_name" default:"live"`
+	Path                 string `yaml:"path"`     // directory of the deployments, defaults to root/name, relative paths are relative to the root
+	LinkDir              string `yaml:"link_dir"` // directory of the live symlink, defaults to the directory of the deployments, relative paths are relative to the root
 
 	GoLiveOnFinish bool `yaml:"go_live_on_finish" default:"true"` // automatically set a finished deployment live
 
 	StaleCleanupTimeout time.Duration `yaml:"stale_cleanup_timeout" default:"30m"` // clean up unfinished deployments after this time, 0 to disable stale cleanup
 
 	Hooks HooksConfig `yaml:"hooks"`
+
+	Notifications []NotificationConfig `yaml:"notifications,omitempty"` // endpoints notified of the events of the site, they can not prevent anything
 }
 
 func (sc *SiteConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -101,10 +229,198 @@ func (sc *SiteConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 }
 
 type HooksConfig struct {
-	// those are paths for scripts
-	PreCreate  string `yaml:"pre_create"`  // runs before the deployment is created, may prevent creation
-	PreFinish  string `yaml:"pre_finish"`  // runs before actually finishing, may prevent finishing
-	PostFinish string `yaml:"post_finish"` // runs after a deployment is finished
-	PreLive    string `yaml:"pre_live"`    // runs before the deployment is set to live, may prevent setting it live (but not finishing)
-	PostLive   string `yaml:"post_live"`   // runs after the deployment is set to live
+	// each of these is a list of hooks, run in order. For backwards compatibility, a single path (or URL) is also accepted
+	PreCreate      HookList `yaml:"pre_create,omitempty"`       // runs before the deployment is created, may prevent creation
+	PostCreate     HookList `yaml:"post_create,omitempty"`      // runs after the deployment is created
+	PreUpload      HookList `yaml:"pre_upload,omitempty"`       // runs before files are uploaded to the deployment, may prevent the upload
+	PostUpload     HookList `yaml:"post_upload,omitempty"`      // runs after files are uploaded to the deployment
+	PreFinish      HookList `yaml:"pre_finish,omitempty"`       // runs before actually finishing, may prevent finishing
+	Build          HookList `yaml:"build,omitempty"`            // runs after pre_finish in the content dir of the deployment, its changes become part of the deployment, may prevent finishing
+	PostFinish     HookList `yaml:"post_finish,omitempty"`      // runs after a deployment is finished
+	PreLive        HookList `yaml:"pre_live,omitempty"`         // runs before the deployment is set to live, may prevent setting it live (but not finishing)
+	PostLive       HookList `yaml:"post_live,omitempty"`        // runs after the deployment is set to live
+	PreDelete      HookList `yaml:"pre_delete,omitempty"`       // runs before a deployment is deleted or aborted through the API, may prevent deletion
+	PostDelete     HookList `yaml:"post_delete,omitempty"`      // runs after a deployment is deleted or aborted through the API
+	OnStaleCleanup HookList `yaml:"on_stale_cleanup,omitempty"` // runs before a stale deployment is deleted by the cleanup job, can not prevent deletion
+
+	Script  ScriptConfig  `yaml:"script"`  // settings for the hooks that are scripts
+	Webhook WebhookConfig `yaml:"webhook"` // settings for the hooks that are URLs
+
+	ExposeOutput bool `yaml:"expose_output"` // include the output of the hooks in the response when an action is prevented by a hook
+}
+
+// hookLists returns the hooks of every event
+func (hc HooksConfig) hookLists() []HookList {
+	return []HookList{
+		hc.PreCreate, hc.PostCreate, hc.PreUpload, hc.PostUpload, hc.PreFinish, hc.Build, hc.PostFinish,
+		hc.PreLive, hc.PostLive, hc.PreDelete, hc.PostDelete, hc.OnStaleCleanup,
+	}
+}
+
+// HasHooks tells if there is at least one hook configured for any event
+func (hc HooksConfig) HasHooks() bool {
+	for _, hl := range hc.hookLists() {
+		if len(hl) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// HookOnFailureAbort stops running the rest of the hooks, and for pre_* hooks, prevents the action
+	HookOnFailureAbort = "abort"
+
+	// HookOnFailureIgnore logs the failure, and continues as if the hook succeeded
+	HookOnFailureIgnore = "ignore"
+)
+
+// HookList is a list of hooks for a single lifecycle event, it can be written as a single path, a single hook, or a list of either of them
+type HookList []HookDefinition
+
+func (hl *HookList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// peek at the value first, so that the errors are about the right form
+	var raw interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	if raw == nil || raw == "" {
+		*hl = nil // no hooks, an empty path was used for that before
+		return nil
+	}
+
+	if _, isList := raw.([]interface{}); isList {
+		var list []HookDefinition
+		if err := unmarshal(&list); err != nil {
+			return err
+		}
+		*hl = list
+		return nil
+	}
+
+	var single HookDefinition
+	if err := unmarshal(&single); err != nil {
+		return err
+	}
+	*hl = HookList{single}
+	return nil
+}
+
+// Paths returns the paths (or URLs) of the hooks in the list
+func (hl HookList) Paths() []string {
+	paths := make([]string, len(hl))
+	for i, h := range hl {
+		paths[i] = h.Path
+	}
+	return paths
+}
+
+type HookDefinition struct {
+	Path      string            `yaml:"path"`                       // path of the script, or a http(s) URL for webhooks
+	Timeout   time.Duration     `yaml:"timeout,omitempty"`          // kill the script (or give up on the webhook) after this time, 0 to use the script (or webhook) timeout
+	Env       map[string]string `yaml:"env,omitempty"`              // extra env-vars for the script, ignored for webhooks
+	WorkDir   string            `yaml:"workdir,omitempty"`          // working directory of the script, ignored for webhooks
+	OnFailure string            `yaml:"on_failure" default:"abort"` // abort or ignore
+
+	// sandboxing of the script, all of these are ignored for webhooks
+	ClearEnv     bool       `yaml:"clear_env,omitempty"`     // don't pass the env-vars of webploy to the script (the WEBPLOY_* vars and env are passed anyway)
+	EnvWhitelist []string   `yaml:"env_whitelist,omitempty"` // only these env-vars of webploy are passed to the script, implies clear_env
+	User         string     `yaml:"user,omitempty"`          // run the script as this user (name or uid), webploy must run as root for this
+	Group        string     `yaml:"group,omitempty"`         // run the script with this group (name or gid), defaults to the primary group of the user
+	Limits       HookLimits `yaml:"limits,omitempty"`
+}
+
+// HookLimits are resource limits (rlimits) of a script, they apply to the script and each of its children separately. Zero means no limit.
+type HookLimits struct {
+	CPUTime     time.Duration `yaml:"cpu_time,omitempty"`      // rounded up to seconds, the script gets SIGXCPU then SIGKILL when exceeded
+	MemoryMB    uint64        `yaml:"memory_mb,omitempty"`     // the size of the address space, allocations fail above this
+	OpenFiles   uint64        `yaml:"open_files,omitempty"`    // max number of open file descriptors
+	MaxOutputKB uint          `yaml:"max_output_kb,omitempty"` // overrides the max_output_kb of the script config
+}
+
+func (hd *HookDefinition) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// Same as AuthenticationProviderBasicAuth.UnmarshalYAML, but a single path is also accepted
+	err := defaults.Set(hd)
+	if err != nil {
+		return err
+	}
+
+	var raw interface{}
+	if err = unmarshal(&raw); err != nil {
+		return err
+	}
+	if hookPath, isString := raw.(string); isString {
+		hd.Path = hookPath
+	} else {
+		type plain HookDefinition
+		if err = unmarshal((*plain)(hd)); err != nil {
+			return err
+		}
+	}
+
+	return hd.validate()
+}
+
+func (hd HookDefinition) validate() error {
+	if hd.Path == "" {
+		return fmt.Errorf("the path of a hook can not be empty")
+	}
+	if hd.OnFailure != HookOnFailureAbort && hd.OnFailure != HookOnFailureIgnore {
+		return fmt.Errorf("invalid on_failure for hook %s: %s (must be %s or %s)", hd.Path, hd.OnFailure, HookOnFailureAbort, HookOnFailureIgnore)
+	}
+	return nil
+}
+
+// NotificationEvents are the names of the events a notification can be limited to, see notify.Event
+var NotificationEvents = []string{"created", "uploaded", "finished", "live_changed", "deleted", "stale_reaped"}
+
+// NotificationConfig is an endpoint that receives the events of a site as CloudEvents
+type NotificationConfig struct {
+	URL        string            `yaml:"url"`
+	Events     []string          `yaml:"events,omitempty"` // only these events are sent, all of them if empty
+	Timeout    time.Duration     `yaml:"timeout" default:"10s"`
+	Secret     string            `yaml:"secret" secret:"true"`            // the body is signed with this key (HMAC-SHA256) if set
+	SecretFile string            `yaml:"secret_file"`                     // file containing the key used for signing, read on every event
+	Headers    map[string]string `yaml:"headers,omitempty" secret:"true"` // extra headers added to the requests, the values are redacted like for webhooks
+}
+
+func (nc *NotificationConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// Same as AuthenticationProviderBasicAuth.UnmarshalYAML
+	err := defaults.Set(nc)
+	if err != nil {
+		return err
+	}
+
+	type plain NotificationConfig
+	if err = unmarshal((*plain)(nc)); err != nil {
+		return err
+	}
+
+	return nc.validate()
+}
+
+func (nc NotificationConfig) validate() error {
+	if nc.URL == "" {
+		return fmt.Errorf("the url of a notification can not be empty")
+	}
+	for _, event := range nc.Events {
+		if !slices.Contains(NotificationEvents, event) {
+			return fmt.Errorf("unknown event for notification %s: %s (must be one of %s)", nc.URL, event, strings.Join(NotificationEvents, ", "))
+		}
+	}
+	return nil
+}
+
+type ScriptConfig struct {
+	Timeout     time.Duration `yaml:"timeout" default:"10m"`        // used when the hook has no timeout of its own, 0 for no timeout
+	GracePeriod time.Duration `yaml:"grace_period" default:"5s"`    // time between SIGTERM and SIGKILL when a hook times out
+	MaxOutputKB uint          `yaml:"max_output_kb" default:"1024"` // stdout and stderr are captured up to this size each (the end is kept), 0 for no limit
+}
+
+type WebhookConfig struct {
+	Timeout    time.Duration     `yaml:"timeout" default:"10s"`
+	Secret     string            `yaml:"secret" secret:"true"`            // the body is signed with this key (HMAC-SHA256) if set
+	SecretFile string            `yaml:"secret_file"`                     // file containing the key used for signing, read on every call
+	Headers    map[string]string `yaml:"headers,omitempty" secret:"true"` // extra headers added to the requests, these often contain tokens, so the values are redacted
 }
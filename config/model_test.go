@@ -2,7 +2,10 @@ package config
 
 import (
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSitesConfig_GetConfigForSite(t *testing.T) {
@@ -32,3 +35,115 @@ func TestSitesConfig_GetConfigForSite(t *testing.T) {
 	assert.False(t, ok)
 
 }
+
+func TestHookList_UnmarshalYAML(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expected    HookList
+		expectedErr bool
+	}{
+		{
+			name:     "happy__single_path",
+			yaml:     "pre_create: /hook.sh",
+			expected: HookList{{Path: "/hook.sh", OnFailure: HookOnFailureAbort}},
+		},
+		{
+			name:     "happy__empty_path",
+			yaml:     `pre_create: ""`,
+			expected: nil,
+		},
+		{
+			name:     "happy__single_definition",
+			yaml:     "pre_create: {path: /hook.sh, timeout: 5s, workdir: /tmp, on_failure: ignore, env: {A: B}}",
+			expected: HookList{{Path: "/hook.sh", Timeout: 5 * time.Second, WorkDir: "/tmp", OnFailure: HookOnFailureIgnore, Env: map[string]string{"A": "B"}}},
+		},
+		{
+			name: "happy__list",
+			yaml: "pre_create:\n  - /hook1.sh\n  - path: /hook2.sh\n    on_failure: ignore\n",
+			expected: HookList{
+				{Path: "/hook1.sh", OnFailure: HookOnFailureAbort},
+				{Path: "/hook2.sh", OnFailure: HookOnFailureIgnore},
+			},
+		},
+		{
+			name:        "error__invalid_on_failure",
+			yaml:        "pre_create: {path: /hook.sh, on_failure: retry}",
+			expectedErr: true,
+		},
+		{
+			name:        "error__missing_path",
+			yaml:        "pre_create: [{timeout: 5s}]",
+			expectedErr: true,
+		},
+		{
+			name:        "error__unknown_field",
+			yaml:        "pre_create: {path: /hook.sh, foo: bar}",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var hc HooksConfig
+			dec := yaml.NewDecoder(strings.NewReader(tc.yaml))
+			dec.KnownFields(true)
+			err := dec.Decode(&hc)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, hc.PreCreate)
+			}
+		})
+	}
+}
+
+func TestNotificationConfig_UnmarshalYAML(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expected    []NotificationConfig
+		expectedErr bool
+	}{
+		{
+			name:     "happy__defaults",
+			yaml:     "notifications: [{url: https://example.com/events}]",
+			expected: []NotificationConfig{{URL: "https://example.com/events", Timeout: 10 * time.Second}},
+		},
+		{
+			name: "happy__full",
+			yaml: "notifications: [{url: https://example.com/events, events: [created, finished], timeout: 1s, secret: s, headers: {A: B}}]",
+			expected: []NotificationConfig{{
+				URL:     "https://example.com/events",
+				Events:  []string{"created", "finished"},
+				Timeout: time.Second,
+				Secret:  "s",
+				Headers: map[string]string{"A": "B"},
+			}},
+		},
+		{
+			name:        "error__missing_url",
+			yaml:        "notifications: [{events: [created]}]",
+			expectedErr: true,
+		},
+		{
+			name:        "error__unknown_event",
+			yaml:        "notifications: [{url: https://example.com/events, events: [created, finised]}]",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sc SiteConfig
+			err := yaml.Unmarshal([]byte(tc.yaml), &sc)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, sc.Notifications)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"bytes"
+	"os"
+)
+
+// ReadSecret returns secret if it is set, otherwise the content of secretFile with the surrounding whitespace trimmed.
+// Returns nil if neither is set.
+func ReadSecret(secret, secretFile string) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+	if secretFile != "" {
+		content, err := os.ReadFile(secretFile) // #nosec G304
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimSpace(content), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestReadSecret(t *testing.T) {
+	secretFile := path.Join(t.TempDir(), "secret")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("from file\n"), 0o600))
+
+	testCases := []struct {
+		name       string
+		secret     string
+		secretFile string
+		expected   []byte
+		expectErr  bool
+	}{
+		{
+			name:     "happy__secret",
+			secret:   "inline",
+			expected: []byte("inline"),
+		},
+		{
+			name:       "happy__secret_file",
+			secretFile: secretFile,
+			expected:   []byte("from file"),
+		},
+		{
+			name:       "happy__secret_preferred",
+			secret:     "inline",
+			secretFile: secretFile,
+			expected:   []byte("inline"),
+		},
+		{
+			name: "happy__none",
+		},
+		{
+			name:       "error__missing_file",
+			secretFile: path.Join(t.TempDir(), "missing"),
+			expectErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			secret, err := ReadSecret(tc.secret, tc.secretFile)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, secret)
+			}
+		})
+	}
+}
@@ -29,39 +29,48 @@ func CreateDefaultDeploymentsForSites(sitesProvider site.Provider, lgr *zap.Logg
 			return err
 		}
 
-		id, d, err := s.CreateNewDeployment(SystemCreatorName, "")
+		err := CreateDefaultDeployment(s, sLogger)
 		if err != nil {
-			sLogger.Error("Failure while creating the initial default deployment", zap.Error(err))
 			return err
 		}
-		dLogger := sLogger.With(zap.String("deploymentID", id))
+	}
 
-		dLogger.Debug("Created initial default deployment")
+	return nil
 
-		// Add the default stuff
-		err = d.AddFile(context.Background(), "index.html", io.NopCloser(bytes.NewReader([]byte(defaultDeploymentIndexContent))))
-		if err != nil {
-			dLogger.Error("Failure while adding the index file to the deployment", zap.Error(err))
-			return err
-		}
+}
 
-		// Finish deployment
-		err = d.Finish()
-		if err != nil {
-			dLogger.Error("Failure while finishing the deployment", zap.Error(err))
-			return err
-		}
+// CreateDefaultDeployment creates a deployment with the default content for a site, and sets it live
+func CreateDefaultDeployment(s site.Site, sLogger *zap.Logger) error {
+	id, d, err := s.CreateNewDeployment(SystemCreatorName, "")
+	if err != nil {
+		sLogger.Error("Failure while creating the initial default deployment", zap.Error(err))
+		return err
+	}
+	dLogger := sLogger.With(zap.String("deploymentID", id))
 
-		// Set as live
-		err = s.SetLiveDeploymentID(id)
-		if err != nil {
-			dLogger.Error("Failure while setting the deployment as live", zap.Error(err))
-			return err
-		}
+	dLogger.Debug("Created initial default deployment")
 
-		dLogger.Info("Created initial deployment for new site")
+	// Add the default stuff
+	err = d.AddFile(context.Background(), "index.html", io.NopCloser(bytes.NewReader([]byte(defaultDeploymentIndexContent))))
+	if err != nil {
+		dLogger.Error("Failure while adding the index file to the deployment", zap.Error(err))
+		return err
 	}
 
-	return nil
+	// Finish deployment
+	err = d.Finish()
+	if err != nil {
+		dLogger.Error("Failure while finishing the deployment", zap.Error(err))
+		return err
+	}
+
+	// Set as live
+	err = s.SetLiveDeploymentID(id)
+	if err != nil {
+		dLogger.Error("Failure while setting the deployment as live", zap.Error(err))
+		return err
+	}
 
+	dLogger.Info("Created initial deployment for new site")
+	return nil
 }
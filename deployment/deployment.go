@@ -12,7 +12,9 @@ type Deployment interface {
 	AddFile(ctx context.Context, relpath string, stream io.ReadCloser) error
 	IsFinished() (bool, error)
 	Finish() error
+	StartBuild() (func(), error)
 	Creator() (string, error)
 	LastActivity() (time.Time, error)
 	GetFullInfo() (info.DeploymentInfo, error)
+	ListFiles() ([]string, error)
 }
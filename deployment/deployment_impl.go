@@ -8,14 +8,19 @@ import (
 	"github.com/marcsello/webploy-server/utils"
 	"go.uber.org/zap"
 	"io"
+	"io/fs"
 	"jayconrod.com/ctxio"
 	"os"
 	"path"
+	"path/filepath"
 	"time"
 )
 
 const ContentSubDirName = "_content"
 
+// BuildLogFileName is the name of the file in the deployment dir, that contains the output of the last build
+const BuildLogFileName = "build.log"
+
 type DeploymentImpl struct {
 	infoProvider  info.InfoProvider // <- store all state info here, as the Deployment objects generally live for a single request and they are not shared
 	fullPath      string            // full path of the deployment (used as unique id for the deployment)
@@ -92,10 +97,63 @@ func (d *DeploymentImpl) GetFullInfo() (info.DeploymentInfo, error) {
 	return i_, err
 }
 
+// ListFiles returns the path of every file uploaded to the deployment, relative to the content dir, in lexical order
+func (d *DeploymentImpl) ListFiles() ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(d.contentSubDir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(d.contentSubDir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+	return files, err
+}
+
 // because deployment objects are short-lived objects, we have to put this here...
 // also, this is purely runtime info, would not make sense to store it in the state
 var pendingUploads = utils.NewKCounter() // TODO: maybe set this up with the provider?
 
+// runningBuilds is the same kind of runtime info, uploads are rejected while the build hooks write the content dir
+var runningBuilds = utils.NewKCounter()
+
+// StartBuild marks the deployment as being built until the returned function is called. Uploads fail with ErrBuildRunning meanwhile.
+// It fails with ErrUploadPending if an upload is in progress, or with ErrBuildRunning if an other build is running.
+func (d *DeploymentImpl) StartBuild() (func(), error) {
+	// increment first, so an upload starting now either sees the build or is seen by us
+	if runningBuilds.Incr(d.fullPath) > 1 {
+		runningBuilds.Dec(d.fullPath)
+		return nil, ErrBuildRunning
+	}
+	done := func() {
+		runningBuilds.Dec(d.fullPath)
+	}
+
+	if pendingUploads.Get(d.fullPath) > 0 {
+		done()
+		return nil, ErrUploadPending
+	}
+
+	finished, err := d.IsFinished()
+	if err != nil {
+		done()
+		return nil, err
+	}
+	if finished {
+		done()
+		return nil, ErrDeploymentFinished
+	}
+
+	return done, nil
+}
+
 func (d *DeploymentImpl) Finish() error {
 	return d.infoProvider.Tx(false, func(i *info.DeploymentInfo) error {
 
@@ -155,6 +213,11 @@ func (d *DeploymentImpl) AddFile(ctx context.Context, relpath string, stream io.
 	}
 	d.logger.Debug("Concurrent uploads limit is not reached", zap.Uint("uploadCnt", uploadCnt), zap.Uint("MaxConcurrentUploads", d.siteConfig.MaxConcurrentUploads))
 
+	// checked after incrementing pendingUploads, for the same reason as above
+	if runningBuilds.Get(d.fullPath) > 0 {
+		return ErrBuildRunning
+	}
+
 	// update info
 	err = d.infoProvider.Tx(false, func(i *info.DeploymentInfo) error {
 
@@ -1,9 +1,16 @@
 package deployment
 
 import (
+	"context"
 	"fmt"
+	"github.com/marcsello/webploy-server/config"
 	"github.com/marcsello/webploy-server/deployment/info"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"io"
+	"os"
+	"path"
+	"strings"
 	"testing"
 	"time"
 )
@@ -229,3 +236,53 @@ func TestDeploymentImpl_GetFullInfo(t *testing.T) {
 	}
 
 }
+
+func TestDeploymentImpl_ListFiles(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDeployment(dir, config.SiteConfig{}, zaptest.NewLogger(t))
+
+	_, err := d.ListFiles()
+	assert.Error(t, err) // not initialized yet
+
+	assert.NoError(t, os.MkdirAll(path.Join(dir, ContentSubDirName, "assets", "empty"), 0o750))
+	for _, f := range []string{"index.html", "assets/style.css", "assets/app.js"} {
+		assert.NoError(t, os.WriteFile(path.Join(dir, ContentSubDirName, f), []byte("test"), 0o640))
+	}
+	assert.NoError(t, os.Symlink("index.html", path.Join(dir, ContentSubDirName, "link.html")))
+
+	files, err := d.ListFiles()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"assets/app.js", "assets/style.css", "index.html"}, files)
+}
+
+func TestDeploymentImpl_StartBuild(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDeployment(dir, config.SiteConfig{}, zaptest.NewLogger(t))
+	assert.NoError(t, d.Init("alice", ""))
+
+	done, err := d.StartBuild()
+	assert.NoError(t, err)
+
+	_, err = d.StartBuild()
+	assert.ErrorIs(t, err, ErrBuildRunning)
+
+	err = d.AddFile(context.Background(), "index.html", io.NopCloser(strings.NewReader("test")))
+	assert.ErrorIs(t, err, ErrBuildRunning)
+	assert.NoFileExists(t, path.Join(dir, ContentSubDirName, "index.html"))
+
+	done()
+
+	err = d.AddFile(context.Background(), "index.html", io.NopCloser(strings.NewReader("test")))
+	assert.NoError(t, err)
+	assert.FileExists(t, path.Join(dir, ContentSubDirName, "index.html"))
+
+	pendingUploads.Incr(dir) // simulate an upload in progress
+	_, err = d.StartBuild()
+	assert.ErrorIs(t, err, ErrUploadPending)
+	pendingUploads.Dec(dir)
+
+	assert.NoError(t, d.Finish())
+	_, err = d.StartBuild()
+	assert.ErrorIs(t, err, ErrDeploymentFinished)
+	assert.Zero(t, runningBuilds.Get(dir))
+}
@@ -37,6 +37,12 @@ func (m *MockDeployment) Finish() error {
 	return args.Error(0)
 }
 
+// StartBuild mocks the StartBuild method of the Deployment interface.
+func (m *MockDeployment) StartBuild() (func(), error) {
+	args := m.Called()
+	return args.Get(0).(func()), args.Error(1)
+}
+
 // Creator mocks the Creator method of the Deployment interface.
 func (m *MockDeployment) Creator() (string, error) {
 	args := m.Called()
@@ -54,3 +60,9 @@ func (m *MockDeployment) GetFullInfo() (info.DeploymentInfo, error) {
 	args := m.Called()
 	return args.Get(0).(info.DeploymentInfo), args.Error(1)
 }
+
+// ListFiles mocks the ListFiles method of the Deployment interface.
+func (m *MockDeployment) ListFiles() ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
@@ -10,3 +10,4 @@ var ErrDeploymentFinished = errors.New("deployment finished")
 
 var ErrTooManyConcurrentUploads = errors.New("too many concurrent uploads")
 var ErrUploadPending = errors.New("upload is pending")
+var ErrBuildRunning = errors.New("build is running")
@@ -1,6 +1,9 @@
 package deployment
 
+import "github.com/marcsello/webploy-server/config"
+
 type Provider interface {
 	InitDeployment(deploymentDir, creator, meta string) (Deployment, error) // Initializes a new deployment in an empty folder
 	LoadDeployment(deploymentDir string) (Deployment, error)                // Load deployment from an already populated folder
+	UpdateSiteConfig(siteConfig config.SiteConfig)                          // Replace the site config used for deployments loaded or initialized after this call
 }
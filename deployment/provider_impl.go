@@ -10,7 +10,7 @@ import (
 type ProviderImpl struct {
 	siteRoot   string // This is only used for sanity checks... maybe
 	siteConfig config.SiteConfig
-	mutex      *sync.RWMutex // This is only used to prevent loading from a deployment folder that is not yet initialized... pretty weak, as it don't protect when an initialization is not finished due to crashing
+	mutex      *sync.RWMutex // This is only used to prevent loading from a deployment folder that is not yet initialized... pretty weak, as it don't protect when an initialization is not finished due to crashing. It also protects siteConfig
 	logger     *zap.Logger
 }
 
@@ -76,3 +76,9 @@ func (p *ProviderImpl) InitDeployment(deploymentDir, creator, meta string) (Depl
 
 	return d, nil
 }
+
+func (p *ProviderImpl) UpdateSiteConfig(siteConfig config.SiteConfig) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.siteConfig = siteConfig
+}
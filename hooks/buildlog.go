@@ -0,0 +1,57 @@
+package hooks
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// WriteBuildLog writes the full output of the build hooks in a human-readable form
+func WriteBuildLog(w io.Writer, result RunResult) error {
+	bw := bufio.NewWriter(w)
+	for _, r := range result.Results {
+		status := fmt.Sprintf("exit code: %d", r.ExitCode)
+		if r.TimedOut {
+			status += ", timed out"
+		}
+		if r.Err != nil {
+			status = fmt.Sprintf("error: %s", r.Err)
+		}
+		if r.Ignored {
+			status += ", ignored"
+		}
+
+		_, _ = fmt.Fprintf(bw, "=== %s #%d: %s (%s, duration: %s)\n", result.Hook, r.Index, r.Path, status, r.Duration)
+		writeBuildLogSection(bw, "stdout", r.Stdout)
+		writeBuildLogSection(bw, "stderr", r.Stderr)
+	}
+	if len(result.Results) == 0 {
+		_, _ = fmt.Fprintf(bw, "=== no %s hooks were run\n", result.Hook)
+	}
+	return bw.Flush() // errors are sticky in bufio.Writer, so they are returned here
+}
+
+func writeBuildLogSection(w io.Writer, name, output string) {
+	if output == "" {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "--- %s\n%s", name, output)
+	if output[len(output)-1] != '\n' {
+		_, _ = io.WriteString(w, "\n")
+	}
+}
+
+// SaveBuildLog writes the build log to the file, overwriting the log of the previous build
+func SaveBuildLog(filePath string, result RunResult) (err error) {
+	var f *os.File
+	f, err = os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+	return WriteBuildLog(f, result)
+}
@@ -1,31 +1,134 @@
 package hooks
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"syscall"
+	"time"
 )
 
+// Command is a script to be run by the Executor
+type Command struct {
+	Path        string
+	Args        []string
+	ExtraEnv    []string      // appended to the env of webploy, in the form of KEY=VALUE
+	Stdin       []byte        // written to the stdin of the script, the script does not have to read it
+	WorkDir     string        // the working directory of webploy if empty
+	GracePeriod time.Duration // time between SIGTERM and SIGKILL when the context is done
+
+	ClearEnv     bool                // the env of webploy is not passed to the script, except EnvWhitelist
+	EnvWhitelist []string            // only these env-vars of webploy are passed to the script, implies ClearEnv
+	Credential   *syscall.Credential // run the script as this user, the user of webploy if nil
+	Limits       Limits
+	MaxOutput    int // bytes of stdout and stderr kept each (the end of the output), no limit if 0
+}
+
+// Result is the outcome of a script that could be run
+type Result struct {
+	ExitCode int
+	Stdout   []byte
+	Stderr   []byte
+	TimedOut bool // the script was killed because the deadline of the context was exceeded
+}
+
 // Executor is basically a shim for os.exec for easier testing
-type Executor func(ctx context.Context, name string, args []string, extraEnv []string) (int, []byte, error)
+type Executor func(ctx context.Context, cmd Command) (Result, error)
+
+// DefaultExecutor runs the script in its own process group. When the context is done, the whole group gets a SIGTERM,
+// and a SIGKILL after the grace period, so that the children of the script do not keep running either.
+func DefaultExecutor(ctx context.Context, cmd Command) (Result, error) {
+	path, args := limitedCommand(cmd.Path, cmd.Args, cmd.Limits)
+	x := exec.CommandContext(ctx, path, args...)
+	x.Dir = cmd.WorkDir // set before calling Environ, so that PWD is set correctly
+	x.Env = append(inheritedEnv(x.Environ(), cmd.ClearEnv, cmd.EnvWhitelist), cmd.ExtraEnv...)
+	x.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: cmd.Credential}
+
+	x.Cancel = func() error {
+		pgid := x.Process.Pid // the pgid is the same as the pid of the leader
+		// the children may ignore SIGTERM even if the script does not, so the group is killed anyway
+		time.AfterFunc(cmd.GracePeriod, func() {
+			_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		})
+		err := syscall.Kill(-pgid, syscall.SIGTERM)
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone // everything exited already
+		}
+		return err
+	}
+	// Children may keep the output pipe open after the script exited, don't wait for them forever.
+	// This also covers the case when the script exits on SIGTERM, but its children do not.
+	x.WaitDelay = cmd.GracePeriod + time.Second
+
+	x.Stdin = bytes.NewReader(cmd.Stdin)
+	stdout := &tailBuffer{limit: cmd.MaxOutput}
+	stderr := &tailBuffer{limit: cmd.MaxOutput}
+	x.Stdout = stdout
+	x.Stderr = stderr
+
+	var errPipe, errPipeWriter *os.File
+	if path == limitHelperExe {
+		var err error
+		errPipe, errPipeWriter, err = os.Pipe()
+		if err != nil {
+			return Result{}, err
+		}
+		defer errPipe.Close()
+		x.ExtraFiles = []*os.File{errPipeWriter} // becomes limitHelperErrFd in the helper
+	}
 
-func DefaultExecutor(ctx context.Context, name string, args []string, extraEnv []string) (int, []byte, error) {
-	x := exec.CommandContext(ctx, name, args...)
-	x.Env = append(x.Environ(), extraEnv...)
+	err := x.Start()
+	if errPipeWriter != nil {
+		_ = errPipeWriter.Close() // only the helper keeps it open, so reading ends when the script is executed
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	if errPipe != nil {
+		err = readHelperErr(errPipe)
+		if err != nil {
+			// the script is never executed without its limits
+			_ = x.Wait()
+			return Result{}, fmt.Errorf("failed to set the limits of the script: %w", err)
+		}
+	}
+	err = x.Wait()
 
-	output, err := x.CombinedOutput()
-	var exitCode int
+	result := Result{
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
 
 	if err != nil {
 		var exiterr *exec.ExitError
-		ok := errors.As(err, &exiterr)
-		if ok {
-			exitCode = exiterr.ExitCode()
-		} else {
+		switch {
+		case errors.As(err, &exiterr):
+			result.ExitCode = exiterr.ExitCode()
+		case errors.Is(err, exec.ErrWaitDelay):
+			// the script itself exited successfully, only something it started kept the output open
+			result.ExitCode = x.ProcessState.ExitCode()
+		default:
 			// some other error
-			return 0, nil, err
+			return Result{}, err
 		}
 	}
 
-	return exitCode, output, nil
+	return result, nil
+}
+
+// readHelperErr waits until the limit helper executes the script, and returns the error it reported, if any
+func readHelperErr(errPipe io.Reader) error {
+	helperErr, err := io.ReadAll(errPipe)
+	if err != nil {
+		return err
+	}
+	if len(helperErr) > 0 {
+		return errors.New(string(helperErr))
+	}
+	return nil
 }
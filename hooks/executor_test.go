@@ -0,0 +1,315 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// waitForPidFile waits until the script writes the pid of its child, and returns it
+func waitForPidFile(t *testing.T, pidFile string) int {
+	for i := 0; i < 100; i++ {
+		data, err := os.ReadFile(pidFile)
+		if err == nil && strings.HasSuffix(string(data), "\n") {
+			pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+			assert.NoError(t, err)
+			return pid
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("the script did not write the pid file")
+	return 0
+}
+
+// processGone tells if the process exited. Zombies count as exited, as the orphans may not be reaped in containers.
+func processGone(pid int) bool {
+	for i := 0; i < 100; i++ {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			return true
+		}
+		// the state comes after the command, which is in parentheses
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		if len(fields) > 0 && fields[0] == "Z" {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+// TestMain runs the limit helper when the test binary is executed as one, the same way as webploy does
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == LimitHelperCommand {
+		os.Exit(RunLimitHelper(os.Args[2:]))
+	}
+	os.Exit(m.Run())
+}
+
+func TestDefaultExecutor(t *testing.T) {
+	dir := t.TempDir()
+
+	testCases := []struct {
+		name string
+
+		script      string
+		stdin       string
+		timeout     time.Duration
+		gracePeriod time.Duration
+
+		expectedExitCode int
+		expectedStdout   string
+		expectedStderr   string
+		expectedTimedOut bool
+		maxDuration      time.Duration
+	}{
+		{
+			name:             "happy__exit_code",
+			script:           "echo $FOO; echo baz >&2; exit 3",
+			expectedExitCode: 3,
+			expectedStdout:   "bar\n",
+			expectedStderr:   "baz\n",
+			maxDuration:      5 * time.Second,
+		},
+		{
+			name:           "happy__stdin",
+			script:         "cat",
+			stdin:          `{"version": 1}`,
+			expectedStdout: `{"version": 1}`,
+			maxDuration:    5 * time.Second,
+		},
+		{
+			name:           "happy__stdin_not_read",
+			script:         "echo done",
+			stdin:          strings.Repeat("a", 1024*1024), // more than the pipe buffer
+			expectedStdout: "done\n",
+			maxDuration:    5 * time.Second,
+		},
+		{
+			name:             "happy__timeout_kills_children",
+			script:           "sleep 60 & echo $! > $PID_FILE; wait",
+			timeout:          200 * time.Millisecond,
+			gracePeriod:      5 * time.Second,
+			expectedExitCode: -1,
+			expectedTimedOut: true,
+			maxDuration:      3 * time.Second, // SIGTERM is enough, the grace period is not waited
+		},
+		{
+			name:             "happy__timeout_sigterm_ignored",
+			script:           "trap '' TERM; sh -c 'trap \"\" TERM; sleep 60' & echo $! > $PID_FILE; wait",
+			timeout:          200 * time.Millisecond,
+			gracePeriod:      500 * time.Millisecond,
+			expectedExitCode: -1,
+			expectedTimedOut: true,
+			maxDuration:      4 * time.Second,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pidFile := path.Join(dir, strconv.Itoa(i)+".pid")
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			result, err := DefaultExecutor(ctx, Command{
+				Path:        "/bin/sh",
+				Args:        []string{"-c", tc.script},
+				ExtraEnv:    []string{"FOO=bar", "PID_FILE=" + pidFile},
+				Stdin:       []byte(tc.stdin),
+				WorkDir:     dir,
+				GracePeriod: tc.gracePeriod,
+			})
+			assert.NoError(t, err)
+			assert.Less(t, time.Since(start), tc.maxDuration)
+
+			assert.Equal(t, tc.expectedExitCode, result.ExitCode)
+			assert.Equal(t, tc.expectedTimedOut, result.TimedOut)
+			assert.Equal(t, tc.expectedStdout, string(result.Stdout))
+			assert.Equal(t, tc.expectedStderr, string(result.Stderr))
+
+			if tc.expectedTimedOut {
+				childPid := waitForPidFile(t, pidFile)
+				assert.True(t, processGone(childPid), "the child of the script is still running")
+			}
+		})
+	}
+}
+
+func TestDefaultExecutor_NotFound(t *testing.T) {
+	_, err := DefaultExecutor(context.Background(), Command{Path: path.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+}
+
+func TestDefaultExecutor_Sandbox(t *testing.T) {
+	t.Setenv("TEST_INHERITED", "yes")
+	t.Setenv("WEBPLOY_SITES__SITES__0__HOOKS__WEBHOOK__SECRET", "override-secret")
+	t.Setenv("WEBPLOY_CONFIG", "/config.yaml")
+
+	testCases := []struct {
+		name string
+
+		script string
+		cmd    Command
+
+		expectedStdout string
+		expectedErr    bool
+	}{
+		{
+			name:           "happy__env_inherited",
+			script:         `echo "$TEST_INHERITED|$FOO"`,
+			expectedStdout: "yes|bar\n",
+		},
+		{
+			name:           "happy__env_overrides_not_inherited",
+			script:         `echo "$WEBPLOY_SITES__SITES__0__HOOKS__WEBHOOK__SECRET|$WEBPLOY_CONFIG"`,
+			expectedStdout: "|/config.yaml\n",
+		},
+		{
+			name:           "happy__env_overrides_not_whitelisted",
+			script:         `echo "$WEBPLOY_SITES__SITES__0__HOOKS__WEBHOOK__SECRET|$TEST_INHERITED"`,
+			cmd:            Command{EnvWhitelist: []string{"WEBPLOY_SITES__SITES__0__HOOKS__WEBHOOK__SECRET", "TEST_INHERITED"}},
+			expectedStdout: "|yes\n",
+		},
+		{
+			name:           "happy__env_cleared",
+			script:         `echo "$TEST_INHERITED|$FOO"`,
+			cmd:            Command{ClearEnv: true},
+			expectedStdout: "|bar\n",
+		},
+		{
+			name:           "happy__env_whitelist",
+			script:         `echo "$TEST_INHERITED|$FOO|$HOME"`,
+			cmd:            Command{EnvWhitelist: []string{"TEST_INHERITED"}},
+			expectedStdout: "yes|bar|\n",
+		},
+		{
+			name:           "happy__limits",
+			script:         "ulimit -t; ulimit -v; ulimit -n",
+			cmd:            Command{Limits: Limits{CPUTime: 1500 * time.Millisecond, Memory: 512 * 1024 * 1024, OpenFiles: 64}},
+			expectedStdout: "2\n524288\n64\n",
+		},
+		{
+			name:           "happy__limits_inherited",
+			script:         "sh -c 'ulimit -n' & wait", // started right away, still limited
+			cmd:            Command{Limits: Limits{OpenFiles: 64}},
+			expectedStdout: "64\n",
+		},
+		{
+			name:           "happy__output_capped",
+			script:         "head -c 5000 /dev/zero | tr '\\0' a",
+			cmd:            Command{MaxOutput: 1000},
+			expectedStdout: truncatedMarker + strings.Repeat("a", 1000),
+		},
+		{
+			name:           "happy__output_not_capped",
+			script:         "head -c 5000 /dev/zero | tr '\\0' a",
+			expectedStdout: strings.Repeat("a", 5000),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := tc.cmd
+			cmd.Path = "/bin/sh"
+			cmd.Args = []string{"-c", tc.script}
+			cmd.ExtraEnv = []string{"FOO=bar"}
+
+			result, err := DefaultExecutor(context.Background(), cmd)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, result.ExitCode)
+			assert.Equal(t, tc.expectedStdout, string(result.Stdout))
+		})
+	}
+}
+
+func TestDefaultExecutor_LimitsNotSet(t *testing.T) {
+	testCases := []struct {
+		name string
+		cmd  Command
+	}{
+		{name: "error__limit_too_high", cmd: Command{Path: "/bin/sh", Args: []string{"-c", "echo should not run"}, Limits: Limits{OpenFiles: 1 << 40}}}, // above fs.nr_open, even for root
+		{name: "error__script_not_found", cmd: Command{Path: path.Join(t.TempDir(), "missing"), Limits: Limits{OpenFiles: 64}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := DefaultExecutor(context.Background(), tc.cmd)
+			assert.Error(t, err)
+			assert.Empty(t, result.Stdout)
+		})
+	}
+}
+
+func TestDefaultExecutor_Credential(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("only root can run scripts as another user")
+	}
+	credential, err := ResolveCredential("nobody", "")
+	if err != nil {
+		t.Skip("the nobody user is not available")
+	}
+
+	result, err := DefaultExecutor(context.Background(), Command{
+		Path:       "/bin/sh",
+		Args:       []string{"-c", "id -u; id -G"},
+		WorkDir:    "/", // the temp dirs of the tests are not accessible for nobody
+		Credential: credential,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%d\n%d\n", credential.Uid, credential.Gid), string(result.Stdout)) // the groups of webploy are dropped
+}
+
+func TestResolveCredential(t *testing.T) {
+	credential, err := ResolveCredential("", "")
+	assert.NoError(t, err)
+	assert.Nil(t, credential)
+
+	_, err = ResolveCredential("webploy-no-such-user", "")
+	assert.Error(t, err)
+
+	_, err = ResolveCredential("", "webploy-no-such-group")
+	assert.Error(t, err)
+
+	current := strconv.Itoa(os.Geteuid())
+	credential, err = ResolveCredential(current, "")
+	assert.NoError(t, err)
+	if os.Geteuid() == 0 {
+		assert.Equal(t, &syscall.Credential{Uid: 0, Gid: 0}, credential)
+	} else {
+		assert.Nil(t, credential) // nothing to switch
+
+		_, err = ResolveCredential("0", "")
+		assert.ErrorIs(t, err, ErrCannotSwitchUser)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{limit: 4}
+	for _, w := range []string{"ab", "cd", "ef", "ghijklmn", "o"} {
+		n, err := b.Write([]byte(w))
+		assert.NoError(t, err)
+		assert.Equal(t, len(w), n)
+	}
+	assert.Equal(t, truncatedMarker+"lmno", string(b.Bytes()))
+
+	b = &tailBuffer{limit: 4}
+	_, _ = b.Write([]byte("abcd"))
+	assert.Equal(t, "abcd", string(b.Bytes()))
+
+	b = &tailBuffer{}
+	_, _ = b.Write([]byte("abcdefgh"))
+	assert.Equal(t, "abcdefgh", string(b.Bytes()))
+}
@@ -2,43 +2,203 @@ package hooks
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/marcsello/webploy-server/config"
 	"go.uber.org/zap"
+	"net/http"
+	"sort"
+	"time"
 )
 
 var (
-	logger *zap.Logger
-	exc    Executor
+	logger        *zap.Logger
+	exc           Executor
+	webhookClient *http.Client
 )
 
-func RunHook(ctx context.Context, hooksConfig config.HooksConfig, hook HookID, vars HookVars) (bool, error) {
+// RunHook runs all hooks configured for the event in order. The result is not Ok if a hook with on_failure: abort failed.
+// For pre_* and build events, the first such failure stops running the rest of the hooks, for post_* events all hooks are run anyway.
+// Errors are only returned for hooks that could not be run at all (and are not ignored).
+func RunHook(ctx context.Context, hooksConfig config.HooksConfig, hook HookID, vars HookVars) (RunResult, error) {
+	return runHooks(ctx, hooksConfig, hook, vars, nil)
+}
+
+// runHooks is RunHook, but if selected is not nil, only the hooks for which it returns true are run
+func runHooks(ctx context.Context, hooksConfig config.HooksConfig, hook HookID, vars HookVars, selected func(index int, hd config.HookDefinition) bool) (RunResult, error) {
 	l := logger.With(zap.String("hook", string(hook)), zap.String("deploymentID", vars.DeploymentID), zap.String("site", vars.SiteName))
 
-	hookPath := getHookPathFromConfig(hook, hooksConfig)
-	if hookPath == "" {
+	runResult := RunResult{Hook: hook, Ok: true}
+
+	hookList := getHooksFromConfig(hook, hooksConfig)
+	if len(hookList) == 0 {
 		l.Debug("no hook configured")
-		return true, nil
+		return runResult, nil
+	}
+
+	var firstErr error
+	for i, hd := range hookList {
+		if selected != nil && !selected(i, hd) {
+			continue
+		}
+		hl := l.With(zap.Int("hookIndex", i), zap.String("hookPath", hd.Path))
+
+		result := runSingleHook(ctx, hl, hooksConfig, hd, hook, vars)
+		result.Index = i
+		if !result.Ok && hd.OnFailure == config.HookOnFailureIgnore {
+			hl.Warn("Hook failed, ignoring", zap.Error(result.Err))
+			result.Ignored = true
+		}
+		runResult.Results = append(runResult.Results, result)
+
+		if result.Ok || result.Ignored {
+			continue
+		}
+
+		runResult.Ok = false
+		if firstErr == nil && result.Err != nil {
+			firstErr = fmt.Errorf("hook #%d (%s): %w", i, hd.Path, result.Err)
+		}
+		if stopsOnFailure(hook) {
+			hl.Warn("Hook failed, skipping the remaining hooks", zap.Int("skippedHooks", len(hookList)-i-1))
+			break
+		}
+	}
+
+	return runResult, firstErr
+}
+
+// runSingleHook runs a script or calls a webhook, the Index of the result is not set
+func runSingleHook(ctx context.Context, l *zap.Logger, hooksConfig config.HooksConfig, hd config.HookDefinition, hook HookID, vars HookVars) HookResult {
+	result := HookResult{
+		Path:    hd.Path,
+		Webhook: IsWebhook(hd.Path),
+	}
+	start := time.Now()
+
+	if result.Webhook {
+		webhookConfig := hooksConfig.Webhook
+		if hd.Timeout > 0 {
+			webhookConfig.Timeout = hd.Timeout
+		}
+
+		statusCode, respBody, err := runWebhook(ctx, webhookClient, webhookConfig, hd.Path, hook, vars)
+		result.Duration = time.Since(start)
+		if err != nil {
+			l.Error("Error while calling webhook", zap.Error(err))
+			result.Err = err
+			result.TimedOut = errors.Is(err, context.DeadlineExceeded)
+			return result
+		}
+
+		l.Info("Webhook called successfully", zap.Int("statusCode", statusCode), zap.ByteString("response", respBody))
+		result.ExitCode = statusCode
+		result.Stdout = string(respBody)
+		result.Ok = statusCode >= 200 && statusCode < 300
+		return result
+	}
+
+	timeout := hd.Timeout
+	if timeout == 0 {
+		timeout = hooksConfig.Script.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
-	l = l.With(zap.String("hookPath", hookPath))
 
-	extraEnv := vars.compileEnvvars(hook)
+	// the vars are added last, so they can not be overridden by the hook's env
+	extraEnv := compileHookEnv(hd.Env)
+	extraEnv = append(extraEnv, vars.compileEnvvars(hook)...)
 
 	args := []string{string(hook)}
 	if vars.DeploymentPath != "" {
 		args = append(args, vars.DeploymentPath)
 	}
 
-	exitCode, output, err := exc(ctx, hookPath, args, extraEnv)
+	payload, err := json.Marshal(NewPayload(hook, vars))
+	if err != nil {
+		l.Error("Error while creating the payload of the hook", zap.Error(err))
+		result.Err = err
+		return result
+	}
+
+	workDir := hd.WorkDir
+	if workDir == "" && hook == HookBuild {
+		workDir = vars.DeploymentContentPath // build steps work on the content
+	}
+
+	credential, err := ResolveCredential(hd.User, hd.Group)
+	if err != nil {
+		// the hook must not be run as webploy instead
+		l.Error("Can not run the hook as the configured user", zap.String("user", hd.User), zap.String("group", hd.Group), zap.Error(err))
+		result.Err = err
+		return result
+	}
+
+	maxOutputKB := hd.Limits.MaxOutputKB
+	if maxOutputKB == 0 {
+		maxOutputKB = hooksConfig.Script.MaxOutputKB
+	}
+
+	var excResult Result
+	excResult, err = exc(ctx, Command{
+		Path:         hd.Path,
+		Args:         args,
+		ExtraEnv:     extraEnv,
+		Stdin:        payload,
+		WorkDir:      workDir,
+		GracePeriod:  hooksConfig.Script.GracePeriod,
+		ClearEnv:     hd.ClearEnv,
+		EnvWhitelist: hd.EnvWhitelist,
+		Credential:   credential,
+		Limits: Limits{
+			CPUTime:   hd.Limits.CPUTime,
+			Memory:    hd.Limits.MemoryMB * 1024 * 1024,
+			OpenFiles: hd.Limits.OpenFiles,
+		},
+		MaxOutput: int(maxOutputKB) * 1024,
+	})
+	result.Duration = time.Since(start)
 	if err != nil {
 		l.Error("Error while executing hook", zap.Error(err))
-		return false, err
+		result.Err = err
+		return result
+	}
+
+	result.ExitCode = excResult.ExitCode
+	result.TimedOut = excResult.TimedOut
+	result.Stdout = string(excResult.Stdout)
+	result.Stderr = string(excResult.Stderr)
+
+	if excResult.TimedOut {
+		l.Warn("Hook timed out", zap.Duration("timeout", timeout), zap.Int("exitCode", excResult.ExitCode), zap.ByteString("stdout", excResult.Stdout), zap.ByteString("stderr", excResult.Stderr))
+		return result
 	}
 
-	l.Info("Hook executed successfully", zap.Int("exitCode", exitCode), zap.ByteString("output", output))
-	return exitCode == 0, nil
+	l.Info("Hook executed successfully", zap.Int("exitCode", excResult.ExitCode), zap.ByteString("stdout", excResult.Stdout), zap.ByteString("stderr", excResult.Stderr), zap.Duration("duration", result.Duration))
+	result.Ok = excResult.ExitCode == 0
+	return result
+}
+
+// compileHookEnv converts the env of the hook definition to KEY=VALUE form, in a stable order
+func compileHookEnv(env map[string]string) []string {
+	envvars := make([]string, 0, len(env))
+	for k, v := range env {
+		envvars = append(envvars, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(envvars)
+	return envvars
 }
 
 func InitHooks(lgr *zap.Logger) { // called from main on init
 	logger = lgr
 	exc = DefaultExecutor // set the default executor
+	webhookClient = &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse // redirects are treated as failures, the body should not be sent anywhere else
+		},
+	}
 }
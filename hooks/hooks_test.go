@@ -6,7 +6,9 @@ import (
 	"github.com/marcsello/webploy-server/config"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap/zaptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRunHook(t *testing.T) {
@@ -34,7 +36,7 @@ func TestRunHook(t *testing.T) {
 			name: "happy__simple",
 
 			argHooksConfig: config.HooksConfig{
-				PostFinish: "test_path",
+				PostFinish: config.HookList{{Path: "test_path", OnFailure: config.HookOnFailureAbort}},
 			},
 			argHook: HookPostFinish,
 			argVars: HookVars{
@@ -72,7 +74,7 @@ func TestRunHook(t *testing.T) {
 			name: "happy__simple2",
 
 			argHooksConfig: config.HooksConfig{
-				PreCreate: "test_path",
+				PreCreate: config.HookList{{Path: "test_path", OnFailure: config.HookOnFailureAbort}},
 			},
 			argHook: HookPreCreate,
 			argVars: HookVars{
@@ -110,7 +112,7 @@ func TestRunHook(t *testing.T) {
 			name: "happy__non_zero",
 
 			argHooksConfig: config.HooksConfig{
-				PreCreate: "test_path",
+				PreCreate: config.HookList{{Path: "test_path", OnFailure: config.HookOnFailureAbort}},
 			},
 			argHook: HookPreCreate,
 			argVars: HookVars{
@@ -148,7 +150,7 @@ func TestRunHook(t *testing.T) {
 			name: "happy__no_hook_configured",
 
 			argHooksConfig: config.HooksConfig{
-				PreCreate: "",
+				PreCreate: nil,
 			},
 			argHook: HookPreCreate,
 			argVars: HookVars{
@@ -170,7 +172,7 @@ func TestRunHook(t *testing.T) {
 			name: "error__exec_fail",
 
 			argHooksConfig: config.HooksConfig{
-				PreCreate: "test_path",
+				PreCreate: config.HookList{{Path: "test_path", OnFailure: config.HookOnFailureAbort}},
 			},
 			argHook: HookPreCreate,
 			argVars: HookVars{
@@ -209,19 +211,28 @@ func TestRunHook(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			logger = zaptest.NewLogger(t)
 			var excCalled bool
-			exc = func(_ context.Context, name string, args []string, extraEnv []string) (int, []byte, error) {
+			exc = func(_ context.Context, cmd Command) (Result, error) {
 				// Mock "exec"
 				excCalled = true
-				assert.Equal(t, tc.excExpectedName, name)
-				assert.Equal(t, tc.excExpectedArgs, args)
-				assert.ElementsMatch(t, tc.excExpectedExtraEnv, extraEnv)
-				return tc.excRetExitCode, tc.excRetOutput, tc.excRetError
+				assert.Equal(t, tc.excExpectedName, cmd.Path)
+				assert.Equal(t, tc.excExpectedArgs, cmd.Args)
+				assert.ElementsMatch(t, tc.excExpectedExtraEnv, cmd.ExtraEnv)
+				return Result{ExitCode: tc.excRetExitCode, Stdout: tc.excRetOutput}, tc.excRetError
 			}
 
-			retOk, retErr := RunHook(context.Background(), tc.argHooksConfig, tc.argHook, tc.argVars)
+			retResult, retErr := RunHook(context.Background(), tc.argHooksConfig, tc.argHook, tc.argVars)
 
 			assert.Equal(t, tc.expectExcCalled, excCalled)
-			assert.Equal(t, tc.expectedOk, retOk)
+			assert.Equal(t, tc.expectedOk, retResult.Ok)
+			assert.Equal(t, tc.argHook, retResult.Hook)
+			if tc.expectExcCalled {
+				assert.Len(t, retResult.Results, 1)
+				assert.Equal(t, tc.excRetExitCode, retResult.Results[0].ExitCode)
+				assert.Equal(t, string(tc.excRetOutput), retResult.Results[0].Stdout)
+				assert.Equal(t, tc.excRetError, retResult.Results[0].Err)
+			} else {
+				assert.Empty(t, retResult.Results)
+			}
 
 			if tc.expectedErr != nil {
 				assert.Error(t, retErr)
@@ -234,3 +245,394 @@ func TestRunHook(t *testing.T) {
 	}
 
 }
+
+func TestRunHookMultiple(t *testing.T) {
+	testErr := fmt.Errorf("test error")
+
+	type excResult struct {
+		exitCode int
+		err      error
+	}
+
+	testCases := []struct {
+		name string
+
+		argHook  HookID
+		argHooks config.HookList
+		results  map[string]excResult // by hook path, exit code 0 if missing
+
+		expectedOk     bool
+		expectedErr    error
+		expectedCalled []string
+	}{
+		{
+			name:    "happy__all_run_in_order",
+			argHook: HookPreCreate,
+			argHooks: config.HookList{
+				{Path: "hook1", OnFailure: config.HookOnFailureAbort},
+				{Path: "hook2", OnFailure: config.HookOnFailureAbort},
+				{Path: "hook3", OnFailure: config.HookOnFailureAbort},
+			},
+			expectedOk:     true,
+			expectedCalled: []string{"hook1", "hook2", "hook3"},
+		},
+		{
+			name:    "happy__pre_short_circuit",
+			argHook: HookPreCreate,
+			argHooks: config.HookList{
+				{Path: "hook1", OnFailure: config.HookOnFailureAbort},
+				{Path: "hook2", OnFailure: config.HookOnFailureAbort},
+				{Path: "hook3", OnFailure: config.HookOnFailureAbort},
+			},
+			results:        map[string]excResult{"hook2": {exitCode: 1}},
+			expectedOk:     false,
+			expectedCalled: []string{"hook1", "hook2"},
+		},
+		{
+			name:    "happy__pre_ignored_failure",
+			argHook: HookPreFinish,
+			argHooks: config.HookList{
+				{Path: "hook1", OnFailure: config.HookOnFailureIgnore},
+				{Path: "hook2", OnFailure: config.HookOnFailureIgnore},
+				{Path: "hook3", OnFailure: config.HookOnFailureAbort},
+			},
+			results:        map[string]excResult{"hook1": {exitCode: 1}, "hook2": {err: testErr}},
+			expectedOk:     true,
+			expectedCalled: []string{"hook1", "hook2", "hook3"},
+		},
+		{
+			name:    "happy__post_runs_all",
+			argHook: HookPostFinish,
+			argHooks: config.HookList{
+				{Path: "hook1", OnFailure: config.HookOnFailureAbort},
+				{Path: "hook2", OnFailure: config.HookOnFailureAbort},
+				{Path: "hook3", OnFailure: config.HookOnFailureAbort},
+			},
+			results:        map[string]excResult{"hook1": {exitCode: 1}},
+			expectedOk:     false,
+			expectedCalled: []string{"hook1", "hook2", "hook3"},
+		},
+		{
+			name:    "happy__build_short_circuit",
+			argHook: HookBuild,
+			argHooks: config.HookList{
+				{Path: "hook1", OnFailure: config.HookOnFailureAbort},
+				{Path: "hook2", OnFailure: config.HookOnFailureAbort},
+			},
+			results:        map[string]excResult{"hook1": {exitCode: 1}},
+			expectedOk:     false,
+			expectedCalled: []string{"hook1"},
+		},
+		{
+			name:    "error__pre_exec_fail",
+			argHook: HookPreCreate,
+			argHooks: config.HookList{
+				{Path: "hook1", OnFailure: config.HookOnFailureAbort},
+				{Path: "hook2", OnFailure: config.HookOnFailureAbort},
+			},
+			results:        map[string]excResult{"hook1": {err: testErr}},
+			expectedOk:     false,
+			expectedErr:    testErr,
+			expectedCalled: []string{"hook1"},
+		},
+		{
+			name:    "error__post_exec_fail",
+			argHook: HookPostLive,
+			argHooks: config.HookList{
+				{Path: "hook1", OnFailure: config.HookOnFailureAbort},
+				{Path: "hook2", OnFailure: config.HookOnFailureAbort},
+			},
+			results:        map[string]excResult{"hook1": {err: testErr}},
+			expectedOk:     false,
+			expectedErr:    testErr,
+			expectedCalled: []string{"hook1", "hook2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger = zaptest.NewLogger(t)
+			var called []string
+			exc = func(_ context.Context, cmd Command) (Result, error) {
+				called = append(called, cmd.Path)
+				r := tc.results[cmd.Path]
+				return Result{ExitCode: r.exitCode}, r.err
+			}
+
+			var hooksConfig config.HooksConfig
+			switch tc.argHook {
+			case HookPreCreate:
+				hooksConfig.PreCreate = tc.argHooks
+			case HookPreFinish:
+				hooksConfig.PreFinish = tc.argHooks
+			case HookBuild:
+				hooksConfig.Build = tc.argHooks
+			case HookPostLive:
+				hooksConfig.PostLive = tc.argHooks
+			case HookPostFinish:
+				hooksConfig.PostFinish = tc.argHooks
+			}
+
+			retResult, retErr := RunHook(context.Background(), hooksConfig, tc.argHook, HookVars{})
+
+			assert.Equal(t, tc.expectedCalled, called)
+			assert.Equal(t, tc.expectedOk, retResult.Ok)
+			assert.Len(t, retResult.Results, len(tc.expectedCalled))
+			for i, r := range retResult.Results {
+				assert.Equal(t, i, r.Index)
+				assert.Equal(t, tc.expectedCalled[i], r.Path)
+				assert.Equal(t, !r.Ok && tc.argHooks[i].OnFailure == config.HookOnFailureIgnore, r.Ignored)
+			}
+			if tc.expectedOk {
+				assert.Nil(t, retResult.Failed())
+			} else {
+				assert.NotNil(t, retResult.Failed())
+			}
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, retErr, tc.expectedErr)
+			} else {
+				assert.NoError(t, retErr)
+			}
+		})
+	}
+}
+
+func TestRunHookDefinition(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+
+	var received Command
+	var deadlineSet bool
+	exc = func(ctx context.Context, cmd Command) (Result, error) {
+		received = cmd
+		_, deadlineSet = ctx.Deadline()
+		return Result{}, nil
+	}
+
+	hooksConfig := config.HooksConfig{
+		PostFinish: config.HookList{{
+			Path:      "test_path",
+			Timeout:   time.Minute,
+			WorkDir:   "/tmp/work",
+			OnFailure: config.HookOnFailureAbort,
+			Env: map[string]string{
+				"B":            "2",
+				"A":            "1",
+				"WEBPLOY_SITE": "overridden",
+			},
+			ClearEnv:     true,
+			EnvWhitelist: []string{"PATH"},
+			Limits:       config.HookLimits{CPUTime: time.Minute, MemoryMB: 512, OpenFiles: 64},
+		}},
+		Script: config.ScriptConfig{MaxOutputKB: 2},
+	}
+
+	result, err := RunHook(context.Background(), hooksConfig, HookPostFinish, HookVars{SiteName: "test"})
+	assert.True(t, result.Ok)
+	assert.NoError(t, err)
+
+	assert.True(t, deadlineSet)
+	assert.Equal(t, "test_path", received.Path)
+	assert.JSONEq(t, `{"version": 1, "hook": "post_finish", "user": "", "site": "test", "site_path": "", "site_current_live": "", "deployment_id": "", "deployment_creator": "", "deployment_meta": "", "deployment_path": "", "request_id": "", "previous_live_id": "", "deployment_content_path": "", "deployment_info": null, "files": null, "uploaded_files": null}`, string(received.Stdin))
+	assert.Equal(t, "/tmp/work", received.WorkDir)
+	assert.Equal(t, []string{"A=1", "B=2", "WEBPLOY_SITE=overridden"}, received.ExtraEnv[:3])
+	assert.Equal(t, "WEBPLOY_SITE=test", lastEnvValue(received.ExtraEnv, "WEBPLOY_SITE"))
+	assert.True(t, received.ClearEnv)
+	assert.Equal(t, []string{"PATH"}, received.EnvWhitelist)
+	assert.Nil(t, received.Credential)
+	assert.Equal(t, Limits{CPUTime: time.Minute, Memory: 512 * 1024 * 1024, OpenFiles: 64}, received.Limits)
+	assert.Equal(t, 2048, received.MaxOutput)
+
+	// the limit of the hook overrides the script config
+	hooksConfig.PostFinish[0].Limits.MaxOutputKB = 4
+	_, err = RunHook(context.Background(), hooksConfig, HookPostFinish, HookVars{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4096, received.MaxOutput)
+}
+
+func TestRunHookUnknownUser(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+
+	excCalled := false
+	exc = func(context.Context, Command) (Result, error) {
+		excCalled = true
+		return Result{}, nil
+	}
+
+	hooksConfig := config.HooksConfig{
+		PreFinish: config.HookList{{Path: "test_path", User: "webploy-no-such-user", OnFailure: config.HookOnFailureAbort}},
+	}
+
+	result, err := RunHook(context.Background(), hooksConfig, HookPreFinish, HookVars{})
+	assert.Error(t, err)
+	assert.False(t, result.Ok)
+	assert.False(t, excCalled) // it is not run as webploy instead
+}
+
+func TestRunHookBuildWorkDir(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+
+	var workDirs []string
+	exc = func(_ context.Context, cmd Command) (Result, error) {
+		workDirs = append(workDirs, cmd.WorkDir)
+		return Result{}, nil
+	}
+
+	hookList := config.HookList{
+		{Path: "hook1", OnFailure: config.HookOnFailureAbort},
+		{Path: "hook2", WorkDir: "/tmp/work", OnFailure: config.HookOnFailureAbort},
+	}
+	vars := HookVars{DeploymentContentPath: "/var/www/test/dep/_content"}
+
+	result, err := RunHook(context.Background(), config.HooksConfig{Build: hookList, PreFinish: hookList}, HookBuild, vars)
+	assert.NoError(t, err)
+	assert.True(t, result.Ok)
+
+	result, err = RunHook(context.Background(), config.HooksConfig{Build: hookList, PreFinish: hookList}, HookPreFinish, vars)
+	assert.NoError(t, err)
+	assert.True(t, result.Ok)
+
+	// only build hooks default to the content dir
+	assert.Equal(t, []string{"/var/www/test/dep/_content", "/tmp/work", "", "/tmp/work"}, workDirs)
+}
+
+// lastEnvValue returns the last occurrence of the key in the env list, this is the one that takes effect
+func lastEnvValue(env []string, key string) string {
+	var last string
+	for _, e := range env {
+		if strings.HasPrefix(e, key+"=") {
+			last = e
+		}
+	}
+	return last
+}
+
+func TestRunHookTimeout(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+
+	testCases := []struct {
+		name string
+
+		hookTimeout   time.Duration
+		scriptTimeout time.Duration
+		timedOut      bool
+
+		expectedDeadline time.Duration // 0 for no deadline
+		expectedOk       bool
+	}{
+		{
+			name:             "happy__hook_timeout",
+			hookTimeout:      time.Minute,
+			scriptTimeout:    time.Hour,
+			expectedDeadline: time.Minute,
+			expectedOk:       true,
+		},
+		{
+			name:             "happy__script_timeout",
+			scriptTimeout:    time.Hour,
+			expectedDeadline: time.Hour,
+			expectedOk:       true,
+		},
+		{
+			name:       "happy__no_timeout",
+			expectedOk: true,
+		},
+		{
+			name:             "happy__timed_out",
+			scriptTimeout:    time.Hour,
+			timedOut:         true,
+			expectedDeadline: time.Hour,
+			expectedOk:       false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received Command
+			var deadline time.Time
+			var deadlineSet bool
+			exc = func(ctx context.Context, cmd Command) (Result, error) {
+				received = cmd
+				deadline, deadlineSet = ctx.Deadline()
+				return Result{ExitCode: -1, TimedOut: tc.timedOut}, nil
+			}
+			if !tc.timedOut {
+				exc = func(ctx context.Context, cmd Command) (Result, error) {
+					received = cmd
+					deadline, deadlineSet = ctx.Deadline()
+					return Result{}, nil
+				}
+			}
+
+			hooksConfig := config.HooksConfig{
+				PostLive: config.HookList{{Path: "test_path", Timeout: tc.hookTimeout, OnFailure: config.HookOnFailureAbort}},
+				Script:   config.ScriptConfig{Timeout: tc.scriptTimeout, GracePeriod: 3 * time.Second},
+			}
+
+			result, err := RunHook(context.Background(), hooksConfig, HookPostLive, HookVars{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedOk, result.Ok)
+			assert.Equal(t, tc.timedOut, result.Results[0].TimedOut)
+			assert.Equal(t, 3*time.Second, received.GracePeriod)
+
+			if tc.expectedDeadline == 0 {
+				assert.False(t, deadlineSet)
+			} else {
+				assert.True(t, deadlineSet)
+				assert.WithinDuration(t, time.Now().Add(tc.expectedDeadline), deadline, time.Minute/2)
+			}
+		})
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	assert.Equal(t, "", TruncateOutput(""))
+	assert.Equal(t, "hello", TruncateOutput("hello"))
+
+	long := strings.Repeat("a", MaxResultOutput) + "the end"
+	truncated := TruncateOutput(long)
+	assert.Len(t, truncated, MaxResultOutput)
+	assert.True(t, strings.HasPrefix(truncated, truncatedMarker))
+	assert.True(t, strings.HasSuffix(truncated, "the end"))
+}
+
+func TestWriteBuildLog(t *testing.T) {
+	testErr := fmt.Errorf("test error")
+
+	testCases := []struct {
+		name     string
+		result   RunResult
+		expected string
+	}{
+		{
+			name:     "happy__nothing_run",
+			result:   RunResult{Hook: HookBuild, Ok: true},
+			expected: "=== no build hooks were run\n",
+		},
+		{
+			name: "happy__multiple",
+			result: RunResult{
+				Hook: HookBuild,
+				Results: []HookResult{
+					{Index: 0, Path: "/minify.sh", Ok: true, Stdout: "minified 3 files", Duration: time.Second},
+					{Index: 1, Path: "/sitemap.sh", Ok: false, Ignored: true, ExitCode: 1, Stderr: "no index\n", Duration: 2 * time.Second},
+					{Index: 2, Path: "/compress.sh", Ok: false, ExitCode: -1, TimedOut: true, Duration: time.Minute},
+					{Index: 3, Path: "/missing.sh", Ok: false, Err: testErr},
+				},
+			},
+			expected: "=== build #0: /minify.sh (exit code: 0, duration: 1s)\n" +
+				"--- stdout\nminified 3 files\n" +
+				"=== build #1: /sitemap.sh (exit code: 1, ignored, duration: 2s)\n" +
+				"--- stderr\nno index\n" +
+				"=== build #2: /compress.sh (exit code: -1, timed out, duration: 1m0s)\n" +
+				"=== build #3: /missing.sh (error: test error, duration: 0s)\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sb strings.Builder
+			assert.NoError(t, WriteBuildLog(&sb, tc.result))
+			assert.Equal(t, tc.expected, sb.String())
+		})
+	}
+}
@@ -1,29 +1,90 @@
 package hooks
 
-import "github.com/marcsello/webploy-server/config"
+import (
+	"github.com/marcsello/webploy-server/config"
+	"strings"
+)
 
 type HookID string
 
 const (
-	HookPreCreate  HookID = "pre_create"
-	HookPreFinish  HookID = "pre_finish"
-	HookPostFinish HookID = "post_finish"
-	HookPreLive    HookID = "pre_live"
-	HookPostLive   HookID = "post_live"
+	HookPreCreate      HookID = "pre_create"
+	HookPostCreate     HookID = "post_create"
+	HookPreUpload      HookID = "pre_upload"
+	HookPostUpload     HookID = "post_upload"
+	HookPreFinish      HookID = "pre_finish"
+	HookBuild          HookID = "build"
+	HookPostFinish     HookID = "post_finish"
+	HookPreLive        HookID = "pre_live"
+	HookPostLive       HookID = "post_live"
+	HookPreDelete      HookID = "pre_delete"
+	HookPostDelete     HookID = "post_delete"
+	HookOnStaleCleanup HookID = "on_stale_cleanup"
 )
 
-func getHookPathFromConfig(hook HookID, config config.HooksConfig) string {
+// AllHooks lists every hook, in the order they are run during the lifecycle of a deployment
+var AllHooks = []HookID{
+	HookPreCreate, HookPostCreate,
+	HookPreUpload, HookPostUpload,
+	HookPreFinish, HookBuild, HookPostFinish,
+	HookPreLive, HookPostLive,
+	HookPreDelete, HookPostDelete,
+	HookOnStaleCleanup,
+}
+
+// ConfiguredHooks returns the hooks of the events that have at least one hook configured
+func ConfiguredHooks(hooksConfig config.HooksConfig) map[HookID]config.HookList {
+	hooks := make(map[HookID]config.HookList)
+	for _, hook := range AllHooks {
+		hookList := getHooksFromConfig(hook, hooksConfig)
+		if len(hookList) > 0 {
+			hooks[hook] = hookList
+		}
+	}
+	return hooks
+}
+
+// HasHooks tells if there is at least one hook configured for the event, so the vars do not have to be collected otherwise
+func HasHooks(hooksConfig config.HooksConfig, hook HookID) bool {
+	return len(getHooksFromConfig(hook, hooksConfig)) > 0
+}
+
+// IsPreHook tells if the hook runs before an action, and may prevent it
+func IsPreHook(hook HookID) bool {
+	return strings.HasPrefix(string(hook), "pre_")
+}
+
+// stopsOnFailure tells if the remaining hooks of the event should be skipped when one fails
+func stopsOnFailure(hook HookID) bool {
+	return IsPreHook(hook) || hook == HookBuild // a failed build step would only be built upon
+}
+
+func getHooksFromConfig(hook HookID, config config.HooksConfig) config.HookList {
 	switch hook {
 	case HookPreCreate:
 		return config.PreCreate
+	case HookPostCreate:
+		return config.PostCreate
+	case HookPreUpload:
+		return config.PreUpload
+	case HookPostUpload:
+		return config.PostUpload
 	case HookPreFinish:
 		return config.PreFinish
+	case HookBuild:
+		return config.Build
 	case HookPostFinish:
 		return config.PostFinish
 	case HookPreLive:
 		return config.PreLive
 	case HookPostLive:
 		return config.PostLive
+	case HookPreDelete:
+		return config.PreDelete
+	case HookPostDelete:
+		return config.PostDelete
+	case HookOnStaleCleanup:
+		return config.OnStaleCleanup
 	}
 	panic("invalid hook")
 }
@@ -6,51 +6,100 @@ import (
 	"testing"
 )
 
-func TestGetHookPathFromConfig(t *testing.T) {
+func TestGetHooksFromConfig(t *testing.T) {
 	testConfig := config.HooksConfig{
-		PreCreate:  "test1",
-		PreFinish:  "test2",
-		PostFinish: "test3",
-		PreLive:    "test4",
-		PostLive:   "test5",
+		PreCreate:      config.HookList{{Path: "test1"}},
+		PreFinish:      config.HookList{{Path: "test2"}},
+		PostFinish:     config.HookList{{Path: "test3"}, {Path: "test3b"}},
+		PreLive:        config.HookList{{Path: "test4"}},
+		PostLive:       config.HookList{{Path: "test5"}},
+		PostCreate:     config.HookList{{Path: "test6"}},
+		PreUpload:      config.HookList{{Path: "test7"}},
+		PostUpload:     config.HookList{{Path: "test8"}},
+		PreDelete:      config.HookList{{Path: "test9"}},
+		PostDelete:     config.HookList{{Path: "test10"}},
+		OnStaleCleanup: config.HookList{{Path: "test11"}},
+		Build:          config.HookList{{Path: "test12"}},
 	}
 
 	testCases := []struct {
-		name         string
-		argHook      HookID
-		argConfig    config.HooksConfig
-		expectedPath string
-		expectPanic  bool
+		name          string
+		argHook       HookID
+		argConfig     config.HooksConfig
+		expectedHooks config.HookList
+		expectPanic   bool
 	}{
 		{
-			name:         "happy__pre_create",
-			argHook:      HookPreCreate,
-			argConfig:    testConfig,
-			expectedPath: testConfig.PreCreate,
+			name:          "happy__pre_create",
+			argHook:       HookPreCreate,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.PreCreate,
 		},
 		{
-			name:         "happy__pre_finish",
-			argHook:      HookPreFinish,
-			argConfig:    testConfig,
-			expectedPath: testConfig.PreFinish,
+			name:          "happy__pre_finish",
+			argHook:       HookPreFinish,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.PreFinish,
 		},
 		{
-			name:         "happy__post_finish",
-			argHook:      HookPostFinish,
-			argConfig:    testConfig,
-			expectedPath: testConfig.PostFinish,
+			name:          "happy__post_finish",
+			argHook:       HookPostFinish,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.PostFinish,
 		},
 		{
-			name:         "happy__pre_live",
-			argHook:      HookPreLive,
-			argConfig:    testConfig,
-			expectedPath: testConfig.PreLive,
+			name:          "happy__pre_live",
+			argHook:       HookPreLive,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.PreLive,
 		},
 		{
-			name:         "happy__post_live",
-			argHook:      HookPostLive,
-			argConfig:    testConfig,
-			expectedPath: testConfig.PostLive,
+			name:          "happy__post_live",
+			argHook:       HookPostLive,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.PostLive,
+		},
+		{
+			name:          "happy__post_create",
+			argHook:       HookPostCreate,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.PostCreate,
+		},
+		{
+			name:          "happy__pre_upload",
+			argHook:       HookPreUpload,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.PreUpload,
+		},
+		{
+			name:          "happy__post_upload",
+			argHook:       HookPostUpload,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.PostUpload,
+		},
+		{
+			name:          "happy__pre_delete",
+			argHook:       HookPreDelete,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.PreDelete,
+		},
+		{
+			name:          "happy__post_delete",
+			argHook:       HookPostDelete,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.PostDelete,
+		},
+		{
+			name:          "happy__build",
+			argHook:       HookBuild,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.Build,
+		},
+		{
+			name:          "happy__on_stale_cleanup",
+			argHook:       HookOnStaleCleanup,
+			argConfig:     testConfig,
+			expectedHooks: testConfig.OnStaleCleanup,
 		},
 		{
 			name:        "error__invalid",
@@ -65,13 +114,60 @@ func TestGetHookPathFromConfig(t *testing.T) {
 
 			if tc.expectPanic {
 				assert.Panics(t, func() {
-					getHookPathFromConfig(tc.argHook, tc.argConfig)
+					getHooksFromConfig(tc.argHook, tc.argConfig)
 				})
 			} else {
-				res := getHookPathFromConfig(tc.argHook, tc.argConfig)
-				assert.Equal(t, tc.expectedPath, res)
+				res := getHooksFromConfig(tc.argHook, tc.argConfig)
+				assert.Equal(t, tc.expectedHooks, res)
 			}
 
 		})
 	}
 }
+
+func TestConfiguredHooks(t *testing.T) {
+	hooksConfig := config.HooksConfig{
+		PreCreate: config.HookList{{Path: "test1"}},
+		PostLive:  config.HookList{{Path: "test2"}, {Path: "test3"}},
+		PreLive:   config.HookList{},
+	}
+
+	assert.Equal(t, map[HookID]config.HookList{
+		HookPreCreate: hooksConfig.PreCreate,
+		HookPostLive:  hooksConfig.PostLive,
+	}, ConfiguredHooks(hooksConfig))
+}
+
+func TestHasHooks(t *testing.T) {
+	hooksConfig := config.HooksConfig{
+		PreUpload: config.HookList{{Path: "test1"}},
+		PreLive:   config.HookList{},
+	}
+
+	assert.True(t, HasHooks(hooksConfig, HookPreUpload))
+	assert.False(t, HasHooks(hooksConfig, HookPreLive))
+	assert.False(t, HasHooks(hooksConfig, HookPostUpload))
+}
+
+func TestIsPreHook(t *testing.T) {
+	assert.True(t, IsPreHook(HookPreCreate))
+	assert.True(t, IsPreHook(HookPreUpload))
+	assert.True(t, IsPreHook(HookPreFinish))
+	assert.True(t, IsPreHook(HookPreLive))
+	assert.True(t, IsPreHook(HookPreDelete))
+	assert.False(t, IsPreHook(HookPostCreate))
+	assert.False(t, IsPreHook(HookPostUpload))
+	assert.False(t, IsPreHook(HookPostFinish))
+	assert.False(t, IsPreHook(HookPostLive))
+	assert.False(t, IsPreHook(HookPostDelete))
+	assert.False(t, IsPreHook(HookOnStaleCleanup))
+	assert.False(t, IsPreHook(HookBuild))
+}
+
+func TestAllHooks(t *testing.T) {
+	for _, hook := range AllHooks {
+		assert.NotPanics(t, func() {
+			getHooksFromConfig(hook, config.HooksConfig{})
+		}, hook)
+	}
+}
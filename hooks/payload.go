@@ -0,0 +1,20 @@
+package hooks
+
+// PayloadVersion is increased when a field of the Payload is changed or removed, adding new fields does not change it
+const PayloadVersion = 1
+
+// Payload is the JSON document written to the stdin of script hooks, and posted to webhooks
+type Payload struct {
+	Version int    `json:"version"`
+	Hook    HookID `json:"hook"`
+	HookVars
+}
+
+// NewPayload creates the payload of the hook from its vars
+func NewPayload(hook HookID, vars HookVars) Payload {
+	return Payload{
+		Version:  PayloadVersion,
+		Hook:     hook,
+		HookVars: vars,
+	}
+}
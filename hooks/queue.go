@@ -0,0 +1,486 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/site"
+	"github.com/natefinch/atomic"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultQueueDirName is the directory of the queue in the root of the sites, if not configured otherwise
+	DefaultQueueDirName = ".hook_queue" // site names can not start with a dot, so this never collides with a site
+
+	queuePendingDirName = "pending"
+	queueDeadDirName    = "dead"
+)
+
+var (
+	ErrQueueNotInitialized = errors.New("hook queue is not initialized")
+	ErrQueuedEventNotFound = errors.New("queued event not found")
+)
+
+// queue is used by EnqueueHook, set by InitHookQueue
+var queue *HookQueue
+
+// QueuedEvent is an event waiting in the HookQueue for its hooks to be run, or a dead letter if it failed too many times
+type QueuedEvent struct {
+	ID          string       `json:"id"`
+	Hook        HookID       `json:"hook"`
+	Vars        HookVars     `json:"vars"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Attempts    uint         `json:"attempts"`     // number of failed attempts so far
+	NextAttempt time.Time    `json:"next_attempt"` // the event is not run before this
+	LastError   string       `json:"last_error,omitempty"`
+	FailedHooks []FailedHook `json:"failed_hooks,omitempty"` // only these are run on retry, all hooks of the event are run if empty
+}
+
+// FailedHook identifies a hook of an event, the path is checked as well, in case the hooks of the site were changed since
+type FailedHook struct {
+	Index int    `json:"index"`
+	Path  string `json:"path"`
+}
+
+// HookQueue runs the hooks of the queued events in the background, failed hooks are retried with exponential backoff.
+// The queue is persisted on the disk, so events are not lost on restart. Events that failed too many times are moved to the dead letters.
+type HookQueue struct {
+	cfg    config.HookQueueConfig
+	dir    string
+	sites  site.Provider
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	pending map[string]QueuedEvent
+	running map[string]bool
+	wakeUp  chan struct{} // closed (and replaced) when the workers should look for new events
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// InitHookQueue creates the queue and loads the events left there by the previous run, EnqueueHook uses the returned queue.
+// The workers are started by Start, but events can be queued before that.
+func InitHookQueue(cfg config.HookQueueConfig, sitesRoot string, sites site.Provider, lgr *zap.Logger) (*HookQueue, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		dir = DefaultQueueDirName
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(sitesRoot, dir)
+	}
+
+	q, err := newHookQueue(cfg, dir, sites, lgr)
+	if err != nil {
+		return nil, err
+	}
+	queue = q
+	return q, nil
+}
+
+func newHookQueue(cfg config.HookQueueConfig, dir string, sites site.Provider, lgr *zap.Logger) (*HookQueue, error) {
+	for _, d := range []string{queuePendingDirName, queueDeadDirName} {
+		err := os.MkdirAll(filepath.Join(dir, d), 0o750)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &HookQueue{
+		cfg:     cfg,
+		dir:     dir,
+		sites:   sites,
+		logger:  lgr,
+		pending: make(map[string]QueuedEvent),
+		running: make(map[string]bool),
+		wakeUp:  make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	events, err := readEventFiles(filepath.Join(dir, queuePendingDirName), lgr)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for _, ev := range events {
+		q.pending[ev.ID] = ev
+	}
+	if len(events) > 0 {
+		lgr.Info("Loaded queued hook events", zap.Int("cnt", len(events)))
+	}
+
+	return q, nil
+}
+
+// EnqueueHook queues the hooks of the event for the site, if it has any configured
+func EnqueueHook(s site.Site, hook HookID, vars HookVars) error {
+	if queue == nil {
+		return ErrQueueNotInitialized
+	}
+	if !HasHooks(s.GetConfig().Hooks, hook) {
+		return nil
+	}
+	vars.SiteName = s.GetName() // the site is looked up by this when the hooks are run
+	return queue.Enqueue(hook, vars)
+}
+
+// Enqueue persists the event, and then queues it to be run as soon as possible
+func (q *HookQueue) Enqueue(hook HookID, vars HookVars) error {
+	now := time.Now()
+	ev := QueuedEvent{
+		ID:          uuid.NewString(),
+		Hook:        hook,
+		Vars:        vars.Copy(),
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+
+	err := writeEventFile(q.pendingPath(ev.ID), ev)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.pending[ev.ID] = ev
+	q.notify()
+	q.mu.Unlock()
+
+	q.logger.Debug("Hook event queued", zap.String("eventID", ev.ID), zap.String("hook", string(hook)), zap.String("site", vars.SiteName))
+	return nil
+}
+
+// Pending returns the events waiting to be run (including the ones currently running), oldest first
+func (q *HookQueue) Pending() []QueuedEvent {
+	q.mu.Lock()
+	events := make([]QueuedEvent, 0, len(q.pending))
+	for _, ev := range q.pending {
+		events = append(events, ev)
+	}
+	q.mu.Unlock()
+
+	sortEvents(events)
+	return events
+}
+
+// DeadLetters returns the events that failed too many times, oldest first
+func (q *HookQueue) DeadLetters() ([]QueuedEvent, error) {
+	return readEventFiles(filepath.Join(q.dir, queueDeadDirName), q.logger)
+}
+
+// RetryDeadLetter moves the dead letter back to the queue, its failed hooks are run again as soon as possible with a fresh attempt count
+func (q *HookQueue) RetryDeadLetter(id string) error {
+	deadPath, err := q.deadPath(id)
+	if err != nil {
+		return err
+	}
+	var ev QueuedEvent
+	ev, err = readEventFile(deadPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrQueuedEventNotFound
+		}
+		return err
+	}
+
+	ev.Attempts = 0
+	ev.NextAttempt = time.Now()
+	err = writeEventFile(q.pendingPath(ev.ID), ev)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(deadPath)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.pending[ev.ID] = ev
+	q.notify()
+	q.mu.Unlock()
+
+	q.logger.Info("Dead letter re-queued", zap.String("eventID", ev.ID), zap.String("hook", string(ev.Hook)), zap.String("site", ev.Vars.SiteName))
+	return nil
+}
+
+// DeleteDeadLetter removes the dead letter for good
+func (q *HookQueue) DeleteDeadLetter(id string) error {
+	deadPath, err := q.deadPath(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(deadPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrQueuedEventNotFound
+	}
+	return err
+}
+
+// Start starts the workers
+func (q *HookQueue) Start() error {
+	workers := max(q.cfg.Workers, 1)
+	q.logger.Info("Starting hook queue workers", zap.Uint("workers", workers), zap.String("dir", q.dir))
+	for i := uint(0); i < workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	return nil
+}
+
+// Destroy stops the workers, the hooks still running are cancelled, and run again on the next start
+func (q *HookQueue) Destroy() error {
+	q.cancel()
+	q.wg.Wait()
+	return nil
+}
+
+func (q *HookQueue) ErrChan() <-chan error {
+	return nil // failures are logged and retried, there is nothing to report
+}
+
+func (q *HookQueue) worker() {
+	defer q.wg.Done()
+	for q.ctx.Err() == nil {
+		ev, wait, wakeUp := q.next(time.Now())
+		if ev != nil {
+			q.process(*ev)
+			continue
+		}
+
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timerC = timer.C
+		}
+		select {
+		case <-q.ctx.Done():
+		case <-wakeUp:
+		case <-timerC:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// next returns the event that is due the earliest and marks it as running. If there is none, it returns how long to wait for one
+// (0 if there is nothing to wait for), and the channel that is closed when a new event is queued.
+func (q *HookQueue) next(now time.Time) (*QueuedEvent, time.Duration, <-chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var earliest *QueuedEvent
+	for _, ev := range q.pending {
+		if q.running[ev.ID] {
+			continue
+		}
+		if earliest == nil || ev.NextAttempt.Before(earliest.NextAttempt) {
+			e := ev
+			earliest = &e
+		}
+	}
+
+	if earliest == nil {
+		return nil, 0, q.wakeUp
+	}
+	if earliest.NextAttempt.After(now) {
+		return nil, earliest.NextAttempt.Sub(now), q.wakeUp
+	}
+	q.running[earliest.ID] = true
+	return earliest, 0, q.wakeUp
+}
+
+// notify wakes up the waiting workers, q.mu must be held
+func (q *HookQueue) notify() {
+	close(q.wakeUp)
+	q.wakeUp = make(chan struct{})
+}
+
+// process runs the hooks of the event, and removes it from the queue, schedules a retry or moves it to the dead letters
+func (q *HookQueue) process(ev QueuedEvent) {
+	l := q.logger.With(zap.String("eventID", ev.ID), zap.String("hook", string(ev.Hook)), zap.String("site", ev.Vars.SiteName), zap.String("deploymentID", ev.Vars.DeploymentID), zap.Uint("attempt", ev.Attempts+1))
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, ev.ID)
+		q.mu.Unlock()
+	}()
+
+	s, ok := q.sites.GetSite(ev.Vars.SiteName)
+	if !ok {
+		l.Error("The site of the queued event does not exist anymore, moving it to the dead letters")
+		ev.LastError = "site does not exist"
+		q.bury(l, ev)
+		return
+	}
+
+	var selected func(int, config.HookDefinition) bool
+	if len(ev.FailedHooks) > 0 {
+		selected = func(index int, hd config.HookDefinition) bool {
+			for _, fh := range ev.FailedHooks {
+				if fh.Index == index && fh.Path == hd.Path {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	result, err := runHooks(q.ctx, s.GetConfig().Hooks, ev.Hook, ev.Vars, selected)
+	if q.ctx.Err() != nil {
+		l.Info("Queue stopped while running the hooks, they will be run again on the next start")
+		return
+	}
+
+	if result.Ok {
+		l.Debug("Queued hooks completed")
+		q.remove(l, ev)
+		return
+	}
+
+	ev.Attempts++
+	ev.FailedHooks = nil
+	for _, r := range result.Results {
+		if !r.Ok && !r.Ignored {
+			ev.FailedHooks = append(ev.FailedHooks, FailedHook{Index: r.Index, Path: r.Path})
+		}
+	}
+	ev.LastError = describeFailure(result, err)
+
+	if ev.Attempts >= q.cfg.MaxAttempts {
+		l.Error("Queued hooks failed too many times, moving the event to the dead letters", zap.String("lastError", ev.LastError))
+		q.bury(l, ev)
+		return
+	}
+
+	backoff := q.backoff(ev.Attempts)
+	ev.NextAttempt = time.Now().Add(backoff)
+	l.Warn("Queued hooks failed, retrying later", zap.String("lastError", ev.LastError), zap.Duration("backoff", backoff))
+	err = writeEventFile(q.pendingPath(ev.ID), ev)
+	if err != nil {
+		l.Error("Failed to update the queued event on the disk", zap.Error(err)) // it will be retried anyway
+	}
+	q.mu.Lock()
+	q.pending[ev.ID] = ev
+	q.mu.Unlock()
+}
+
+// backoff returns the delay before the next attempt, after the given number of failed attempts
+func (q *HookQueue) backoff(attempts uint) time.Duration {
+	backoff := q.cfg.InitialBackoff
+	for i := uint(1); i < attempts && backoff < q.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, q.cfg.MaxBackoff)
+}
+
+// remove deletes the event from the queue
+func (q *HookQueue) remove(l *zap.Logger, ev QueuedEvent) {
+	err := os.Remove(q.pendingPath(ev.ID))
+	if err != nil {
+		l.Error("Failed to remove the completed event from the disk", zap.Error(err))
+	}
+	q.mu.Lock()
+	delete(q.pending, ev.ID)
+	q.mu.Unlock()
+}
+
+// bury moves the event to the dead letters
+func (q *HookQueue) bury(l *zap.Logger, ev QueuedEvent) {
+	deadPath, _ := q.deadPath(ev.ID) // the ID was generated by us
+	err := writeEventFile(deadPath, ev)
+	if err != nil {
+		l.Error("Failed to write the dead letter to the disk", zap.Error(err))
+	}
+	q.remove(l, ev)
+}
+
+func (q *HookQueue) pendingPath(id string) string {
+	return filepath.Join(q.dir, queuePendingDirName, id+".json")
+}
+
+// deadPath validates the ID as well, since it may come from the API
+func (q *HookQueue) deadPath(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", ErrQueuedEventNotFound
+	}
+	return filepath.Join(q.dir, queueDeadDirName, id+".json"), nil
+}
+
+// describeFailure returns a short description of why the result is not Ok
+func describeFailure(result RunResult, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	failed := result.Failed()
+	if failed == nil {
+		return "unknown failure"
+	}
+	if failed.TimedOut {
+		return fmt.Sprintf("hook #%d (%s) timed out", failed.Index, failed.Path)
+	}
+	return fmt.Sprintf("hook #%d (%s) failed with exit code %d", failed.Index, failed.Path, failed.ExitCode)
+}
+
+func sortEvents(events []QueuedEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+}
+
+// writeEventFile writes the event atomically, so that a crash never leaves a half-written file behind
+func writeEventFile(path string, ev QueuedEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return atomic.WriteFile(path, bytes.NewReader(data))
+}
+
+func readEventFile(path string) (QueuedEvent, error) {
+	var ev QueuedEvent
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ev, err
+	}
+	err = json.Unmarshal(data, &ev)
+	return ev, err
+}
+
+// readEventFiles reads all events from the directory, oldest first. Unreadable files are skipped.
+func readEventFiles(dir string, l *zap.Logger) ([]QueuedEvent, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]QueuedEvent, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" { // the temporary files of atomic.WriteFile are skipped as well
+			continue
+		}
+		p := filepath.Join(dir, entry.Name())
+		var ev QueuedEvent
+		ev, err = readEventFile(p)
+		if err != nil {
+			l.Error("Failed to read queued event, skipping", zap.String("path", p), zap.Error(err))
+			continue
+		}
+		events = append(events, ev)
+	}
+
+	sortEvents(events)
+	return events, nil
+}
@@ -0,0 +1,180 @@
+package hooks
+
+import (
+	"context"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/site"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// callRecorder is a thread-safe Executor that fails the hooks in failing
+type callRecorder struct {
+	mu      sync.Mutex
+	called  []string
+	failing map[string]bool
+}
+
+func (cr *callRecorder) exec(_ context.Context, cmd Command) (Result, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.called = append(cr.called, cmd.Path)
+	if cr.failing[cmd.Path] {
+		return Result{ExitCode: 1}, nil
+	}
+	return Result{}, nil
+}
+
+func (cr *callRecorder) calls() []string {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return append([]string{}, cr.called...)
+}
+
+func (cr *callRecorder) setFailing(failing map[string]bool) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.failing = failing
+}
+
+func newTestQueueSites(hooksConfig config.HooksConfig) *site.MockProvider {
+	s := new(site.MockSite)
+	s.On("GetConfig").Return(config.SiteConfig{Name: "test_site", Hooks: hooksConfig})
+	s.On("GetName").Return("test_site")
+
+	sites := new(site.MockProvider)
+	sites.On("GetSite", "test_site").Return(s, true)
+	sites.On("GetSite", "missing_site").Return(&site.MockSite{}, false)
+	return sites
+}
+
+var testQueueConfig = config.HookQueueConfig{
+	Workers:        2,
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+}
+
+func TestHookQueue_Backoff(t *testing.T) {
+	q := &HookQueue{cfg: config.HookQueueConfig{InitialBackoff: 10 * time.Second, MaxBackoff: time.Minute}}
+
+	assert.Equal(t, 10*time.Second, q.backoff(1))
+	assert.Equal(t, 20*time.Second, q.backoff(2))
+	assert.Equal(t, 40*time.Second, q.backoff(3))
+	assert.Equal(t, time.Minute, q.backoff(4))
+	assert.Equal(t, time.Minute, q.backoff(1000))
+}
+
+func TestHookQueue_RetryAndDeadLetter(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	cr := &callRecorder{failing: map[string]bool{"hook2": true}}
+	exc = cr.exec
+
+	sites := newTestQueueSites(config.HooksConfig{
+		PostLive: config.HookList{
+			{Path: "hook1", OnFailure: config.HookOnFailureAbort},
+			{Path: "hook2", OnFailure: config.HookOnFailureAbort},
+			{Path: "hook3", OnFailure: config.HookOnFailureIgnore},
+		},
+	})
+
+	q, err := newHookQueue(testQueueConfig, t.TempDir(), sites, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+	defer func() { assert.NoError(t, q.Destroy()) }()
+
+	assert.NoError(t, q.Enqueue(HookPostLive, HookVars{SiteName: "test_site", DeploymentID: "test_deployment"}))
+
+	var dead []QueuedEvent
+	assert.Eventually(t, func() bool {
+		dead, err = q.DeadLetters()
+		return err == nil && len(dead) == 1 && len(q.Pending()) == 0 // the dead letter is written before removing the event from the queue
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// only the failed hook is retried
+	assert.Equal(t, []string{"hook1", "hook2", "hook3", "hook2", "hook2"}, cr.calls())
+	assert.Equal(t, uint(3), dead[0].Attempts)
+	assert.Equal(t, []FailedHook{{Index: 1, Path: "hook2"}}, dead[0].FailedHooks)
+	assert.Equal(t, "test_deployment", dead[0].Vars.DeploymentID)
+	assert.NotEmpty(t, dead[0].LastError)
+
+	cr.setFailing(nil)
+	assert.NoError(t, q.RetryDeadLetter(dead[0].ID))
+	assert.Eventually(t, func() bool {
+		return len(q.Pending()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	dead, err = q.DeadLetters()
+	assert.NoError(t, err)
+	assert.Empty(t, dead)
+	assert.Equal(t, []string{"hook1", "hook2", "hook3", "hook2", "hook2", "hook2"}, cr.calls())
+}
+
+func TestHookQueue_Persistence(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	cr := &callRecorder{}
+	exc = cr.exec
+
+	sites := newTestQueueSites(config.HooksConfig{
+		PostFinish: config.HookList{{Path: "hook1", OnFailure: config.HookOnFailureAbort}},
+	})
+	dir := t.TempDir()
+
+	q, err := newHookQueue(testQueueConfig, dir, sites, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+	assert.NoError(t, q.Enqueue(HookPostFinish, HookVars{SiteName: "test_site", Files: []string{"index.html"}}))
+	assert.NoError(t, q.Destroy()) // never started, like a crash before running the hooks
+
+	q, err = newHookQueue(testQueueConfig, dir, sites, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+	pending := q.Pending()
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, HookPostFinish, pending[0].Hook)
+		assert.Equal(t, []string{"index.html"}, pending[0].Vars.Files)
+	}
+
+	assert.NoError(t, q.Start())
+	defer func() { assert.NoError(t, q.Destroy()) }()
+	assert.Eventually(t, func() bool {
+		return len(q.Pending()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"hook1"}, cr.calls())
+
+	q, err = newHookQueue(testQueueConfig, dir, sites, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+	assert.Empty(t, q.Pending())
+}
+
+func TestHookQueue_MissingSite(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	cr := &callRecorder{}
+	exc = cr.exec
+
+	q, err := newHookQueue(testQueueConfig, t.TempDir(), newTestQueueSites(config.HooksConfig{}), zaptest.NewLogger(t))
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+	defer func() { assert.NoError(t, q.Destroy()) }()
+
+	assert.NoError(t, q.Enqueue(HookPostDelete, HookVars{SiteName: "missing_site"}))
+
+	var dead []QueuedEvent
+	assert.Eventually(t, func() bool {
+		dead, err = q.DeadLetters()
+		return err == nil && len(dead) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "missing_site", dead[0].Vars.SiteName)
+	assert.Empty(t, cr.calls())
+
+	deadID := dead[0].ID
+	assert.NoError(t, q.DeleteDeadLetter(deadID))
+	dead, err = q.DeadLetters()
+	assert.NoError(t, err)
+	assert.Empty(t, dead)
+
+	assert.ErrorIs(t, q.DeleteDeadLetter(deadID), ErrQueuedEventNotFound)
+	assert.ErrorIs(t, q.DeleteDeadLetter("../pending/something"), ErrQueuedEventNotFound)
+	assert.ErrorIs(t, q.RetryDeadLetter("../pending/something"), ErrQueuedEventNotFound)
+}
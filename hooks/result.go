@@ -0,0 +1,51 @@
+package hooks
+
+import (
+	"time"
+)
+
+// MaxResultOutput is the maximum length of the output returned by TruncateOutput
+const MaxResultOutput = 4096
+
+// truncatedMarker is put in front of the output if it was truncated
+const truncatedMarker = "[truncated]..."
+
+// HookResult is the outcome of a single hook of an event
+type HookResult struct {
+	Index    int // index of the hook in the list of the event
+	Path     string
+	Webhook  bool
+	Ok       bool
+	Ignored  bool          // the hook failed, but its on_failure is ignore
+	Err      error         // the hook could not be run at all
+	ExitCode int           // the status code of the response for webhooks
+	TimedOut bool          // the hook was killed (or the webhook was given up on) because of its timeout
+	Stdout   string        // the response body for webhooks
+	Stderr   string        // always empty for webhooks
+	Duration time.Duration // how long it took to run the hook
+}
+
+// RunResult is the outcome of all hooks of an event
+type RunResult struct {
+	Hook    HookID
+	Ok      bool         // false if a hook with on_failure: abort failed
+	Results []HookResult // of the hooks that were actually run
+}
+
+// Failed returns the first hook that caused the result to be not Ok, or nil if there is none
+func (r RunResult) Failed() *HookResult {
+	for i := range r.Results {
+		if !r.Results[i].Ok && !r.Results[i].Ignored {
+			return &r.Results[i]
+		}
+	}
+	return nil
+}
+
+// TruncateOutput shortens the output of a hook to MaxResultOutput, the end of the output is kept, since that is where the errors usually are
+func TruncateOutput(output string) string {
+	if len(output) <= MaxResultOutput {
+		return output
+	}
+	return truncatedMarker + output[len(output)-MaxResultOutput+len(truncatedMarker):]
+}
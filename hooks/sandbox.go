@@ -0,0 +1,192 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"github.com/marcsello/webploy-server/config"
+	"os"
+	"os/exec"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrCannotSwitchUser = errors.New("webploy must run as root to run hooks as another user or group")
+
+// Limits are the rlimits of a script, zero means no limit
+type Limits struct {
+	CPUTime   time.Duration // rounded up to seconds
+	Memory    uint64        // size of the address space in bytes
+	OpenFiles uint64
+}
+
+// ResolveCredential looks up the user and group (names or ids) a script should be run as.
+// It returns nil if both are empty, or if they are the same as the user of webploy. It fails if webploy can not switch to them.
+func ResolveCredential(userName, groupName string) (*syscall.Credential, error) {
+	if userName == "" && groupName == "" {
+		return nil, nil
+	}
+
+	uid, gid := os.Geteuid(), os.Getegid()
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			var unknownUserErr user.UnknownUserError
+			if !errors.As(err, &unknownUserErr) {
+				return nil, err
+			}
+			u, err = user.LookupId(userName)
+			if err != nil {
+				return nil, fmt.Errorf("unknown user: %s", userName)
+			}
+		}
+		uid, _ = strconv.Atoi(u.Uid) // these are always numbers on linux
+		gid, _ = strconv.Atoi(u.Gid)
+	}
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			var unknownGroupErr user.UnknownGroupError
+			if !errors.As(err, &unknownGroupErr) {
+				return nil, err
+			}
+			g, err = user.LookupGroupId(groupName)
+			if err != nil {
+				return nil, fmt.Errorf("unknown group: %s", groupName)
+			}
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	if uid == os.Geteuid() && gid == os.Getegid() && os.Geteuid() != 0 {
+		return nil, nil // nothing to switch, and setgroups would fail without root anyway
+	}
+	if os.Geteuid() != 0 {
+		return nil, ErrCannotSwitchUser
+	}
+	// the supplementary groups of webploy are dropped
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
+// inheritedEnv returns the env-vars of webploy to be passed to the script, the result is never nil, so that exec does not fall back to the env of webploy.
+// The config overrides are never passed, even if whitelisted, as they may contain secrets.
+func inheritedEnv(environ []string, clearEnv bool, whitelist []string) []string {
+	filterByWhitelist := clearEnv || len(whitelist) > 0
+
+	env := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		key, _, _ := strings.Cut(kv, "=")
+		if config.IsEnvOverride(key) {
+			continue
+		}
+		if filterByWhitelist && !slices.Contains(whitelist, key) {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// LimitHelperCommand is the hidden subcommand of webploy, that sets the limits of a script before executing it, see RunLimitHelper
+const LimitHelperCommand = "__hook-limits"
+
+// limitHelperExe is the executable of webploy, even if it was replaced since starting
+const limitHelperExe = "/proc/self/exe"
+
+// limitHelperErrFd is where the helper reports that the limits could not be set, it is closed when the script is executed
+const limitHelperErrFd = 3
+
+// limitedCommand returns the path and the args to run the script through the limit helper, so the limits are set before the script is executed,
+// and nothing started by it can escape them. The script is run directly if it has no limits.
+func limitedCommand(path string, args []string, limits Limits) (string, []string) {
+	if limits == (Limits{}) {
+		return path, args
+	}
+	cpuSeconds := uint64((limits.CPUTime + time.Second - 1) / time.Second)
+	helperArgs := []string{LimitHelperCommand, strconv.FormatUint(cpuSeconds, 10), strconv.FormatUint(limits.Memory, 10), strconv.FormatUint(limits.OpenFiles, 10), path}
+	return limitHelperExe, append(helperArgs, args...)
+}
+
+// RunLimitHelper sets the limits given in the args and executes the script in place of webploy, it only returns if that fails.
+// The args are the cpu time in seconds, the memory and the open files (0 for no limit), then the path and the args of the script.
+func RunLimitHelper(args []string) int {
+	err := execWithLimits(args)
+
+	errPipe := os.NewFile(limitHelperErrFd, "errPipe")
+	_, _ = errPipe.WriteString(err.Error())
+	return 127
+}
+
+func execWithLimits(args []string) error {
+	if len(args) < 4 {
+		return fmt.Errorf("expected the limits and the path of the script, got %d arguments", len(args))
+	}
+	var values [3]uint64
+	for i := range values {
+		v, err := strconv.ParseUint(args[i], 10, 64)
+		if err != nil {
+			return err
+		}
+		values[i] = v
+	}
+
+	// the path is relative to the work dir of the script, like with os/exec
+	path, err := exec.LookPath(args[3])
+	if err != nil {
+		return err
+	}
+
+	// the memory is limited last, so the helper itself does not run out of it
+	for _, limit := range []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{"cpu time", syscall.RLIMIT_CPU, values[0]},
+		{"open files", syscall.RLIMIT_NOFILE, values[2]},
+		{"memory", syscall.RLIMIT_AS, values[1]},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		// syscall.Setrlimit is used, as syscall.Exec would restore the original open files limit otherwise
+		err = syscall.Setrlimit(limit.resource, &syscall.Rlimit{Cur: limit.value, Max: limit.value})
+		if err != nil {
+			return fmt.Errorf("%s: %w", limit.name, err)
+		}
+	}
+
+	syscall.CloseOnExec(limitHelperErrFd)
+	return syscall.Exec(path, args[3:], os.Environ())
+}
+
+// tailBuffer keeps the last limit bytes written to it, or everything if limit is 0
+type tailBuffer struct {
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if b.limit > 0 && len(b.buf) > 2*b.limit { // trimmed only occasionally, so the data is not moved on every write
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.limit:]...)
+		b.truncated = true
+	}
+	return len(p), nil // the rest of the output is discarded, but the script must not notice that
+}
+
+// Bytes returns the kept output, prefixed with a marker if something was discarded
+func (b *tailBuffer) Bytes() []byte {
+	if b.limit > 0 && len(b.buf) > b.limit {
+		b.buf = b.buf[len(b.buf)-b.limit:]
+		b.truncated = true
+	}
+	if b.truncated {
+		return append([]byte(truncatedMarker), b.buf...)
+	}
+	return b.buf
+}
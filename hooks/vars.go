@@ -6,17 +6,29 @@ import (
 	"github.com/marcsello/webploy-server/deployment"
 	"github.com/marcsello/webploy-server/deployment/info"
 	"github.com/marcsello/webploy-server/site"
+	"path"
+	"slices"
 )
 
+// HookVars are passed to script hooks as env-vars and in the Payload on their stdin, and to webhooks in the Payload
 type HookVars struct {
-	User              string
-	SiteName          string
-	SitePath          string
-	SiteCurrentLive   string
-	DeploymentID      string
-	DeploymentCreator string
-	DeploymentMeta    string
-	DeploymentPath    string
+	User              string `json:"user"`
+	SiteName          string `json:"site"`
+	SitePath          string `json:"site_path"`
+	SiteCurrentLive   string `json:"site_current_live"`
+	DeploymentID      string `json:"deployment_id"`
+	DeploymentCreator string `json:"deployment_creator"`
+	DeploymentMeta    string `json:"deployment_meta"`
+	DeploymentPath    string `json:"deployment_path"`
+
+	// New fields should be added below, these are only passed in the Payload, not as env-vars
+
+	RequestID             string               `json:"request_id"`
+	PreviousLiveID        string               `json:"previous_live_id"` // the live deployment before this one, only for post_live
+	DeploymentInfo        *info.DeploymentInfo `json:"deployment_info"`
+	DeploymentContentPath string               `json:"deployment_content_path"` // the directory of the uploaded files, inside the deployment path
+	Files                 []string             `json:"files"`                   // the files uploaded to the deployment
+	UploadedFiles         []string             `json:"uploaded_files"`          // the files of the current upload, only for pre_upload and post_upload
 }
 
 // ReadFromSite fills the SiteName, SitePath and SiteCurrentLive vars directly from site.Site
@@ -27,21 +39,28 @@ func (v *HookVars) ReadFromSite(s site.Site) (err error) {
 	return
 }
 
-// ReadFromDeployment fills the DeploymentPath, DeploymentCreator and DeploymentMeta fields from deployment.Deployment
+// ReadFromDeployment fills the DeploymentPath, Files and the fields filled by ReadFromDeploymentInfo from deployment.Deployment
 func (v *HookVars) ReadFromDeployment(d deployment.Deployment) error {
 	i, err := d.GetFullInfo()
 	if err != nil {
 		return err
 	}
+	v.Files, err = d.ListFiles()
+	if err != nil {
+		return err
+	}
 	v.DeploymentPath = d.GetPath()
+	v.DeploymentContentPath = path.Join(v.DeploymentPath, deployment.ContentSubDirName)
 	v.ReadFromDeploymentInfo(i)
 	return nil
 }
 
-// ReadFromDeploymentInfo fills the DeploymentCreator and DeploymentMeta fields from info.DeploymentInfo
+// ReadFromDeploymentInfo fills the DeploymentCreator, DeploymentMeta and DeploymentInfo fields from info.DeploymentInfo
 func (v *HookVars) ReadFromDeploymentInfo(i info.DeploymentInfo) {
 	v.DeploymentCreator = i.Creator
 	v.DeploymentMeta = i.Meta
+	cpy := i.Copy()
+	v.DeploymentInfo = &cpy
 }
 
 func (v *HookVars) ReadFromSiteAndDeployment(s site.Site, d deployment.Deployment) error {
@@ -65,14 +84,24 @@ func (v *HookVars) compileEnvvars(hook HookID) []string {
 }
 
 func (v *HookVars) Copy() HookVars {
-	return HookVars{
-		User:              v.User,
-		SiteName:          v.SiteName,
-		SitePath:          v.SitePath,
-		SiteCurrentLive:   v.SiteCurrentLive,
-		DeploymentID:      v.DeploymentID,
-		DeploymentCreator: v.DeploymentCreator,
-		DeploymentMeta:    v.DeploymentMeta,
-		DeploymentPath:    v.DeploymentPath,
+	cpy := HookVars{
+		User:                  v.User,
+		SiteName:              v.SiteName,
+		SitePath:              v.SitePath,
+		SiteCurrentLive:       v.SiteCurrentLive,
+		DeploymentID:          v.DeploymentID,
+		DeploymentCreator:     v.DeploymentCreator,
+		DeploymentMeta:        v.DeploymentMeta,
+		DeploymentPath:        v.DeploymentPath,
+		RequestID:             v.RequestID,
+		PreviousLiveID:        v.PreviousLiveID,
+		DeploymentContentPath: v.DeploymentContentPath,
+		Files:                 slices.Clone(v.Files),
+		UploadedFiles:         slices.Clone(v.UploadedFiles),
+	}
+	if v.DeploymentInfo != nil {
+		i := v.DeploymentInfo.Copy()
+		cpy.DeploymentInfo = &i
 	}
+	return cpy
 }
@@ -11,17 +11,29 @@ import (
 
 func TestHookVars_Copy(t *testing.T) {
 	v1 := HookVars{
-		User:              "test1",
-		SiteName:          "test2",
-		SitePath:          "test3",
-		SiteCurrentLive:   "test4",
-		DeploymentID:      "test5",
-		DeploymentCreator: "test6",
-		DeploymentMeta:    "test7",
-		DeploymentPath:    "test8",
+		User:                  "test1",
+		SiteName:              "test2",
+		SitePath:              "test3",
+		SiteCurrentLive:       "test4",
+		DeploymentID:          "test5",
+		DeploymentCreator:     "test6",
+		DeploymentMeta:        "test7",
+		DeploymentPath:        "test8",
+		RequestID:             "test9",
+		PreviousLiveID:        "test10",
+		DeploymentContentPath: "test8/_content",
+		DeploymentInfo:        &info.DeploymentInfo{Creator: "test6", Meta: "test7"},
+		Files:                 []string{"index.html"},
+		UploadedFiles:         []string{"index.html"},
 	}
 	v2 := v1.Copy()
 	assert.Equal(t, v1, v2)
+
+	// the copy should not share anything with the original
+	v2.DeploymentInfo.Creator = "changed"
+	v2.Files[0] = "changed"
+	assert.Equal(t, "test6", v1.DeploymentInfo.Creator)
+	assert.Equal(t, "index.html", v1.Files[0])
 }
 
 func TestHookVars_ReadFromDeployment(t *testing.T) {
@@ -32,6 +44,7 @@ func TestHookVars_ReadFromDeployment(t *testing.T) {
 		Meta:    "test2",
 	}, nil)
 	d.On("GetPath").Return("test3")
+	d.On("ListFiles").Return([]string{"test4"}, nil)
 
 	v := HookVars{}
 	e := v.ReadFromDeployment(d)
@@ -40,6 +53,9 @@ func TestHookVars_ReadFromDeployment(t *testing.T) {
 	assert.Equal(t, v.DeploymentCreator, "test1")
 	assert.Equal(t, v.DeploymentMeta, "test2")
 	assert.Equal(t, v.DeploymentPath, "test3")
+	assert.Equal(t, v.DeploymentContentPath, "test3/_content")
+	assert.Equal(t, v.Files, []string{"test4"})
+	assert.Equal(t, v.DeploymentInfo, &info.DeploymentInfo{Creator: "test1", Meta: "test2"})
 
 	// error
 	testErr := fmt.Errorf("test error")
@@ -51,6 +67,16 @@ func TestHookVars_ReadFromDeployment(t *testing.T) {
 	e = v2.ReadFromDeployment(d2)
 	assert.Error(t, e)
 	assert.Equal(t, testErr, e)
+
+	d3 := new(deployment.MockDeployment)
+	d3.On("GetFullInfo").Return(info.DeploymentInfo{}, nil)
+	d3.On("GetPath").Return("test1")
+	d3.On("ListFiles").Return([]string(nil), testErr)
+
+	v3 := HookVars{}
+	e = v3.ReadFromDeployment(d3)
+	assert.Error(t, e)
+	assert.Equal(t, testErr, e)
 }
 
 func TestHookVars_ReadFromSite(t *testing.T) {
@@ -90,6 +116,7 @@ func TestHookVars_ReadFromDeploymentInfo(t *testing.T) {
 	v.ReadFromDeploymentInfo(i)
 	assert.Equal(t, i.Creator, v.DeploymentCreator)
 	assert.Equal(t, i.Meta, v.DeploymentMeta)
+	assert.Equal(t, &i, v.DeploymentInfo)
 }
 
 func TestHookVars_ReadFromSiteAndDeployment(t *testing.T) {
@@ -100,6 +127,7 @@ func TestHookVars_ReadFromSiteAndDeployment(t *testing.T) {
 		Meta:    "test2",
 	}, nil)
 	dGood.On("GetPath").Return("test3")
+	dGood.On("ListFiles").Return([]string{"test4"}, nil)
 	dBad := new(deployment.MockDeployment)
 	dBad.On("GetFullInfo").Return(info.DeploymentInfo{}, testErr)
 	dBad.On("GetPath").Return("")
@@ -0,0 +1,96 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/marcsello/webploy-server/config"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// WebhookSignatureHeader contains the HMAC-SHA256 of the body, in the format of sha256=<hex>, only set if a secret is configured
+	WebhookSignatureHeader = "X-Webploy-Signature"
+
+	// WebhookHookHeader contains the ID of the hook
+	WebhookHookHeader = "X-Webploy-Hook"
+
+	// webhookMaxResponseSize is the maximum size of the response body kept for logging
+	webhookMaxResponseSize = 64 * 1024
+)
+
+// IsWebhook tells if the configured hook is a webhook (a http or https URL) instead of a script
+func IsWebhook(hookPath string) bool {
+	return strings.HasPrefix(hookPath, "http://") || strings.HasPrefix(hookPath, "https://")
+}
+
+// SignWebhookBody returns the value of the signature header for the body
+func SignWebhookBody(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookSecret returns the secret used to sign the body, nil if signing is not configured
+func webhookSecret(cfg config.WebhookConfig) ([]byte, error) {
+	return config.ReadSecret(cfg.Secret, cfg.SecretFile)
+}
+
+// runWebhook posts the vars to the url, returns the status code and the (truncated) response body.
+// Errors are only returned if the request could not be made, or no response was received.
+func runWebhook(ctx context.Context, client *http.Client, cfg config.WebhookConfig, url string, hook HookID, vars HookVars) (int, []byte, error) {
+	body, err := json.Marshal(NewPayload(hook, vars))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var secret []byte
+	secret, err = webhookSecret(cfg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not read webhook secret: %w", err)
+	}
+
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookHookHeader, string(hook))
+	if secret != nil {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookBody(secret, body))
+	}
+
+	var resp *http.Response
+	resp, err = client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body) // so that the connection can be reused
+		_ = resp.Body.Close()
+	}()
+
+	var respBody []byte
+	respBody, err = io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseSize))
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	return resp.StatusCode, respBody, nil
+}
@@ -0,0 +1,157 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestIsWebhook(t *testing.T) {
+	assert.True(t, IsWebhook("http://example.com/hook"))
+	assert.True(t, IsWebhook("https://example.com/hook"))
+	assert.False(t, IsWebhook("/usr/local/bin/hook.sh"))
+	assert.False(t, IsWebhook("ftp://example.com/hook"))
+}
+
+func TestRunHook_Webhook(t *testing.T) {
+	secretFile := path.Join(t.TempDir(), "secret")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("file-secret\n"), 0o600))
+
+	vars := HookVars{
+		User:              "test1",
+		SiteName:          "test2",
+		SitePath:          "test3",
+		SiteCurrentLive:   "test4",
+		DeploymentID:      "test5",
+		DeploymentCreator: "test6",
+		DeploymentMeta:    "test7",
+		DeploymentPath:    "test8",
+	}
+
+	testCases := []struct {
+		name          string
+		webhookConfig config.WebhookConfig
+		handler       http.HandlerFunc
+		expectedOk    bool
+		expectErr     bool
+		check         func(t *testing.T, req *http.Request, body []byte)
+	}{
+		{
+			name:          "happy__success",
+			webhookConfig: config.WebhookConfig{Timeout: time.Second, Headers: map[string]string{"Authorization": "Bearer test"}},
+			handler:       func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) },
+			expectedOk:    true,
+			check: func(t *testing.T, req *http.Request, body []byte) {
+				assert.Equal(t, http.MethodPost, req.Method)
+				assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+				assert.Equal(t, "Bearer test", req.Header.Get("Authorization"))
+				assert.Equal(t, string(HookPreCreate), req.Header.Get(WebhookHookHeader))
+				assert.Empty(t, req.Header.Get(WebhookSignatureHeader))
+
+				var payload Payload
+				assert.NoError(t, json.Unmarshal(body, &payload))
+				assert.Equal(t, Payload{Version: PayloadVersion, Hook: HookPreCreate, HookVars: vars}, payload)
+			},
+		},
+		{
+			name:          "happy__signed",
+			webhookConfig: config.WebhookConfig{Timeout: time.Second, Secret: "very-secret"},
+			handler:       func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+			expectedOk:    true,
+			check: func(t *testing.T, req *http.Request, body []byte) {
+				assert.Equal(t, SignWebhookBody([]byte("very-secret"), body), req.Header.Get(WebhookSignatureHeader))
+			},
+		},
+		{
+			name:          "happy__signed_secret_file",
+			webhookConfig: config.WebhookConfig{Timeout: time.Second, SecretFile: secretFile},
+			handler:       func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+			expectedOk:    true,
+			check: func(t *testing.T, req *http.Request, body []byte) {
+				assert.Equal(t, SignWebhookBody([]byte("file-secret"), body), req.Header.Get(WebhookSignatureHeader))
+			},
+		},
+		{
+			name:          "happy__rejected",
+			webhookConfig: config.WebhookConfig{Timeout: time.Second},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte("not now"))
+			},
+			expectedOk: false,
+		},
+		{
+			name:          "happy__redirect_is_rejected",
+			webhookConfig: config.WebhookConfig{Timeout: time.Second},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "/elsewhere", http.StatusFound)
+			},
+			expectedOk: false,
+		},
+		{
+			name:          "error__timeout",
+			webhookConfig: config.WebhookConfig{Timeout: 50 * time.Millisecond},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+			},
+			expectedOk: false,
+			expectErr:  true,
+		},
+		{
+			name:          "error__missing_secret_file",
+			webhookConfig: config.WebhookConfig{Timeout: time.Second, SecretFile: path.Join(t.TempDir(), "missing")},
+			handler:       func(w http.ResponseWriter, r *http.Request) { t.Error("should not be called") },
+			expectedOk:    false,
+			expectErr:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var receivedReq *http.Request
+			var receivedBody []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/hook" {
+					receivedReq = r
+					receivedBody, _ = io.ReadAll(r.Body)
+				}
+				tc.handler(w, r)
+			}))
+			defer srv.Close()
+
+			InitHooks(zaptest.NewLogger(t))
+			exc = func(context.Context, Command) (Result, error) {
+				t.Error("the executor should not be called for webhooks")
+				return Result{}, nil
+			}
+
+			hooksConfig := config.HooksConfig{PreCreate: config.HookList{{Path: srv.URL + "/hook", OnFailure: config.HookOnFailureAbort}}, Webhook: tc.webhookConfig}
+			result, err := RunHook(context.Background(), hooksConfig, HookPreCreate, vars)
+
+			assert.Equal(t, tc.expectedOk, result.Ok)
+			assert.Len(t, result.Results, 1)
+			assert.True(t, result.Results[0].Webhook)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.check != nil {
+				assert.NotNil(t, receivedReq)
+				tc.check(t, receivedReq, receivedBody)
+			}
+		})
+	}
+}
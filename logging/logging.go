@@ -0,0 +1,193 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"github.com/marcsello/webploy-server/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	SubsystemAPI   = "api"
+	SubsystemHooks = "hooks"
+	SubsystemJobs  = "jobs"
+	SubsystemSite  = "site"
+)
+
+// Subsystems are the parts of webploy that have their own log level
+var Subsystems = []string{SubsystemAPI, SubsystemHooks, SubsystemJobs, SubsystemSite}
+
+var ErrUnknownSubsystem = errors.New("unknown subsystem")
+var ErrUnknownFormat = errors.New("unknown log format")
+
+// Logging builds the loggers of the subsystems, each of them having its own level that can be changed at runtime
+type Logging struct {
+	root       *zap.Logger
+	rootLevel  zap.AtomicLevel
+	levels     map[string]zap.AtomicLevel
+	loggers    map[string]*zap.Logger
+	closeFuncs []func() error
+}
+
+// Validate checks the config without opening any of the outputs
+func Validate(cfg config.LoggingConfig) error {
+	_, err := zapcore.ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	for subsystem, level := range cfg.Subsystems {
+		if !slices.Contains(Subsystems, subsystem) {
+			return fmt.Errorf("%w: %s", ErrUnknownSubsystem, subsystem)
+		}
+		_, err = zapcore.ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("%s: %w", subsystem, err)
+		}
+	}
+	if cfg.Format != "json" && cfg.Format != "console" {
+		return fmt.Errorf("%w: %s", ErrUnknownFormat, cfg.Format)
+	}
+	for _, o := range cfg.Outputs {
+		if o.Path == "" {
+			return fmt.Errorf("the path of a log output can not be empty")
+		}
+	}
+	return nil
+}
+
+// New builds the loggers from the config. In debug mode, the config is ignored, and everything is logged in the console format.
+func New(cfg config.LoggingConfig, debug bool) (*Logging, error) {
+	if debug {
+		cfg = config.LoggingConfig{Level: "debug", Format: "console"}
+	}
+
+	err := Validate(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Logging{
+		levels:  make(map[string]zap.AtomicLevel, len(Subsystems)),
+		loggers: make(map[string]*zap.Logger, len(Subsystems)),
+	}
+
+	var encoder zapcore.Encoder
+	if cfg.Format == "console" {
+		encoderCfg := zap.NewDevelopmentEncoderConfig()
+		encoder = zapcore.NewConsoleEncoder(encoderCfg)
+	} else {
+		encoderCfg := zap.NewProductionEncoderConfig()
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	}
+
+	var sink zapcore.WriteSyncer
+	sink, err = l.openOutputs(cfg.Outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	newCore := func(level zap.AtomicLevel) zapcore.Core {
+		core := zapcore.NewCore(encoder, sink, level)
+		if cfg.Sampling.Initial > 0 {
+			core = zapcore.NewSamplerWithOptions(core, time.Second, cfg.Sampling.Initial, cfg.Sampling.Thereafter)
+		}
+		return core
+	}
+
+	var options []zap.Option
+	if debug {
+		options = append(options, zap.Development(), zap.AddStacktrace(zap.WarnLevel))
+	} else {
+		options = append(options, zap.AddStacktrace(zap.ErrorLevel))
+	}
+	options = append(options, zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr)))
+
+	l.rootLevel = zap.NewAtomicLevelAt(zap.InfoLevel)
+	_ = l.rootLevel.UnmarshalText([]byte(cfg.Level)) // validated above
+	l.root = zap.New(newCore(l.rootLevel), options...)
+
+	for _, subsystem := range Subsystems {
+		level := zap.NewAtomicLevelAt(l.rootLevel.Level())
+		if subsystemLevel, ok := cfg.Subsystems[subsystem]; ok {
+			_ = level.UnmarshalText([]byte(subsystemLevel)) // validated above
+		}
+		l.levels[subsystem] = level
+		l.loggers[subsystem] = zap.New(newCore(level), options...).Named(subsystem)
+	}
+
+	return l, nil
+}
+
+func (l *Logging) openOutputs(outputs []config.LogOutputConfig) (zapcore.WriteSyncer, error) {
+	if len(outputs) == 0 {
+		return zapcore.Lock(os.Stderr), nil
+	}
+
+	syncers := make([]zapcore.WriteSyncer, 0, len(outputs))
+	for _, o := range outputs {
+		switch o.Path {
+		case "stdout":
+			syncers = append(syncers, zapcore.Lock(os.Stdout))
+		case "stderr":
+			syncers = append(syncers, zapcore.Lock(os.Stderr))
+		default:
+			f, err := newRotatingFile(o.Path, int64(o.MaxSizeMB)*1024*1024, o.MaxBackups) // #nosec G115
+			if err != nil {
+				_ = l.Close()
+				return nil, err
+			}
+			l.closeFuncs = append(l.closeFuncs, f.Close)
+			syncers = append(syncers, f) // rotatingFile does its own locking
+		}
+	}
+	return zapcore.NewMultiWriteSyncer(syncers...), nil
+}
+
+// Root returns the logger used for everything that is not part of a subsystem
+func (l *Logging) Root() *zap.Logger {
+	return l.root
+}
+
+// Logger returns the logger of the subsystem
+func (l *Logging) Logger(subsystem string) *zap.Logger {
+	lgr, ok := l.loggers[subsystem]
+	if !ok {
+		// this is a programming error
+		panic(fmt.Sprintf("unknown logging subsystem: %s", subsystem))
+	}
+	return lgr
+}
+
+// Level returns the level of the subsystem, or the level of the root logger if subsystem is empty.
+// The AtomicLevel can be changed at runtime, and it can also serve HTTP requests to do so.
+func (l *Logging) Level(subsystem string) (zap.AtomicLevel, error) {
+	if subsystem == "" {
+		return l.rootLevel, nil
+	}
+	level, ok := l.levels[subsystem]
+	if !ok {
+		return zap.AtomicLevel{}, ErrUnknownSubsystem
+	}
+	return level, nil
+}
+
+// Sync flushes all loggers
+func (l *Logging) Sync() {
+	_ = l.root.Sync()
+	for _, lgr := range l.loggers {
+		_ = lgr.Sync()
+	}
+}
+
+// Close closes the log files
+func (l *Logging) Close() error {
+	var err error
+	for _, f := range l.closeFuncs {
+		err = errors.Join(err, f())
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"encoding/json"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func readLogLines(t *testing.T, logFile string) []map[string]any {
+	content, err := os.ReadFile(logFile)
+	assert.NoError(t, err)
+
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		cfg         config.LoggingConfig
+		expectErr   bool
+		expectedErr error
+	}{
+		{name: "happy", cfg: config.LoggingConfig{Level: "warn", Format: "console", Subsystems: map[string]string{SubsystemHooks: "debug"}}},
+		{name: "error__level", cfg: config.LoggingConfig{Level: "loud", Format: "json"}, expectErr: true},
+		{name: "error__format", cfg: config.LoggingConfig{Level: "info", Format: "xml"}, expectErr: true, expectedErr: ErrUnknownFormat},
+		{name: "error__subsystem", cfg: config.LoggingConfig{Level: "info", Format: "json", Subsystems: map[string]string{"database": "debug"}}, expectErr: true, expectedErr: ErrUnknownSubsystem},
+		{name: "error__subsystem_level", cfg: config.LoggingConfig{Level: "info", Format: "json", Subsystems: map[string]string{SubsystemAPI: "loud"}}, expectErr: true},
+		{name: "error__empty_output", cfg: config.LoggingConfig{Level: "info", Format: "json", Outputs: []config.LogOutputConfig{{}}}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(tc.cfg)
+			if tc.expectErr {
+				assert.Error(t, err)
+				if tc.expectedErr != nil {
+					assert.ErrorIs(t, err, tc.expectedErr)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNew_Levels(t *testing.T) {
+	logFile := path.Join(t.TempDir(), "webploy.log")
+	logs, err := New(config.LoggingConfig{
+		Level:      "warn",
+		Format:     "json",
+		Outputs:    []config.LogOutputConfig{{Path: logFile}},
+		Subsystems: map[string]string{SubsystemHooks: "debug"},
+	}, false)
+	assert.NoError(t, err)
+
+	logs.Root().Info("root info")
+	logs.Root().Warn("root warn")
+	logs.Logger(SubsystemHooks).Debug("hooks debug")
+	logs.Logger(SubsystemAPI).Info("api info")
+	logs.Logger(SubsystemAPI).Error("api error")
+
+	// change at runtime
+	level, err := logs.Level(SubsystemAPI)
+	assert.NoError(t, err)
+	level.SetLevel(zapcore.DebugLevel)
+	logs.Logger(SubsystemAPI).Debug("api debug")
+
+	_, err = logs.Level("database")
+	assert.ErrorIs(t, err, ErrUnknownSubsystem)
+
+	logs.Sync()
+	assert.NoError(t, logs.Close())
+
+	lines := readLogLines(t, logFile)
+	var messages []string
+	for _, l := range lines {
+		messages = append(messages, l["msg"].(string))
+	}
+	assert.Equal(t, []string{"root warn", "hooks debug", "api error", "api debug"}, messages)
+	assert.Equal(t, "hooks", lines[1]["logger"])
+}
+
+func TestNew_LevelHandler(t *testing.T) {
+	logs, err := New(config.LoggingConfig{Level: "info", Format: "json", Outputs: []config.LogOutputConfig{{Path: path.Join(t.TempDir(), "webploy.log")}}}, false)
+	assert.NoError(t, err)
+	defer func() { _ = logs.Close() }()
+
+	level, err := logs.Level(SubsystemJobs)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	level.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"error"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, zapcore.ErrorLevel, level.Level())
+
+	// the others are not affected
+	rootLevel, _ := logs.Level("")
+	assert.Equal(t, zapcore.InfoLevel, rootLevel.Level())
+}
+
+func TestNew_Debug(t *testing.T) {
+	// the config is ignored in debug mode, so an invalid one does not matter
+	logs, err := New(config.LoggingConfig{Level: "loud"}, true)
+	assert.NoError(t, err)
+	level, _ := logs.Level(SubsystemSite)
+	assert.Equal(t, zapcore.DebugLevel, level.Level())
+
+	_, err = New(config.LoggingConfig{Level: "loud"}, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is a log file, that is rotated after reaching maxSize. The rotated files are named path.1, path.2 ... the oldest is deleted when there are more than maxBackups.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64 // 0 disables rotation
+	maxBackups uint
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups uint) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	err := rf.open()
+	if err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open opens (or creates) the file for appending, must be called with the mutex held
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640) // #nosec G304
+	if err != nil {
+		return err
+	}
+	var info os.FileInfo
+	info, err = f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	return nil
+}
+
+func (rf *rotatingFile) backupName(n uint) string {
+	return fmt.Sprintf("%s.%d", rf.path, n)
+}
+
+// rotate moves the current file to path.1 (shifting the existing backups), and opens a new one, must be called with the mutex held
+func (rf *rotatingFile) rotate() error {
+	closeErr := rf.file.Close()
+
+	// even if moving the old file fails, the logs should still go somewhere
+	var moveErr error
+	if rf.maxBackups == 0 {
+		moveErr = os.Remove(rf.path)
+	} else {
+		for i := rf.maxBackups; i > 1 && moveErr == nil; i-- {
+			moveErr = os.Rename(rf.backupName(i-1), rf.backupName(i))
+			if os.IsNotExist(moveErr) {
+				moveErr = nil
+			}
+		}
+		if moveErr == nil {
+			moveErr = os.Rename(rf.path, rf.backupName(1))
+		}
+	}
+	if os.IsNotExist(moveErr) {
+		moveErr = nil
+	}
+
+	return errors.Join(closeErr, moveErr, rf.open())
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		err := rf.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) Sync() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Sync()
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
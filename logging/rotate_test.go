@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	testCases := []struct {
+		name            string
+		maxSize         int64
+		maxBackups      uint
+		writes          []string
+		expectedContent map[string]string // by file name, files not listed must not exist
+	}{
+		{
+			name:            "no_rotation",
+			maxSize:         0,
+			maxBackups:      2,
+			writes:          []string{"aaaa", "bbbb", "cccc"},
+			expectedContent: map[string]string{"test.log": "aaaabbbbcccc"},
+		},
+		{
+			name:       "rotate_with_backups",
+			maxSize:    8,
+			maxBackups: 2,
+			writes:     []string{"aaaa", "bbbb", "cccc", "dddd", "eeee", "ffff", "gg"},
+			expectedContent: map[string]string{
+				"test.log":   "gg",
+				"test.log.1": "eeeeffff",
+				"test.log.2": "ccccdddd",
+			},
+		},
+		{
+			name:            "rotate_without_backups",
+			maxSize:         4,
+			maxBackups:      0,
+			writes:          []string{"aaaa", "bbbb"},
+			expectedContent: map[string]string{"test.log": "bbbb"},
+		},
+		{
+			name:            "oversized_write",
+			maxSize:         4,
+			maxBackups:      1,
+			writes:          []string{"aaaaaaaa", "bb"},
+			expectedContent: map[string]string{"test.log": "bb", "test.log.1": "aaaaaaaa"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			rf, err := newRotatingFile(path.Join(dir, "test.log"), tc.maxSize, tc.maxBackups)
+			assert.NoError(t, err)
+
+			for _, w := range tc.writes {
+				n, err := rf.Write([]byte(w))
+				assert.NoError(t, err)
+				assert.Equal(t, len(w), n)
+			}
+			assert.NoError(t, rf.Sync())
+			assert.NoError(t, rf.Close())
+
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Len(t, entries, len(tc.expectedContent))
+			for name, expected := range tc.expectedContent {
+				content, err := os.ReadFile(path.Join(dir, name))
+				assert.NoError(t, err)
+				assert.Equal(t, expected, string(content))
+			}
+		})
+	}
+}
+
+func TestRotatingFile_Append(t *testing.T) {
+	logFile := path.Join(t.TempDir(), "test.log")
+	assert.NoError(t, os.WriteFile(logFile, []byte("existing"), 0o640))
+
+	rf, err := newRotatingFile(logFile, 10, 1)
+	assert.NoError(t, err)
+	_, err = rf.Write([]byte("abc")) // the size of the existing content is counted
+	assert.NoError(t, err)
+	assert.NoError(t, rf.Close())
+
+	content, err := os.ReadFile(logFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(content))
+	content, err = os.ReadFile(logFile + ".1")
+	assert.NoError(t, err)
+	assert.Equal(t, "existing", string(content))
+}
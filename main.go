@@ -9,6 +9,8 @@ import (
 	"github.com/marcsello/webploy-server/default_deployment"
 	"github.com/marcsello/webploy-server/hooks"
 	"github.com/marcsello/webploy-server/jobs"
+	"github.com/marcsello/webploy-server/logging"
+	"github.com/marcsello/webploy-server/notify"
 	"github.com/marcsello/webploy-server/site"
 	"github.com/marcsello/webploy-server/utils"
 	"gitlab.com/MikeTTh/env"
@@ -26,19 +28,22 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	debug := env.Bool("WEBPLOY_DEBUG", false)
 
+	// this logger is only used until the config is loaded
 	var lgr *zap.Logger
 	if debug {
 		lgr = zap.Must(zap.NewDevelopment())
 		gin.SetMode(gin.DebugMode)
 		lgr.Warn("RUNNING IN DEBUG MODE!")
 	} else {
-		// TODO: read more logger options from config file???
 		lgr = zap.Must(zap.NewProduction())
 		gin.SetMode(gin.ReleaseMode)
 	}
-	defer lgr.Sync()
 
 	lgr.Info("Starting webploy server...", zap.String("version", version), zap.String("commitHash", commitHash), zap.String("buildTimestamp", buildTimestamp))
 
@@ -47,9 +52,21 @@ func main() {
 		lgr.Panic("Failed to load config", zap.Error(err))
 	}
 
+	var logs *logging.Logging
+	logs, err = logging.New(cfg.Logging, debug)
+	if err != nil {
+		lgr.Panic("Failed to initialize logging", zap.Error(err))
+	}
+	_ = lgr.Sync()
+	lgr = logs.Root()
+	defer func() {
+		logs.Sync()
+		_ = logs.Close()
+	}()
+
 	lgr.Info("Initializing sites provider...")
 	var sitesProvider site.Provider
-	sitesProvider, err = site.InitSites(cfg.Sites, lgr)
+	sitesProvider, err = site.InitSites(cfg.Sites, logs.Logger(logging.SubsystemSite))
 	if err != nil {
 		lgr.Panic("Failed to initialize sites provider", zap.Error(err))
 	}
@@ -62,11 +79,22 @@ func main() {
 	}()
 
 	lgr.Info("Initializing hooks...")
-	hooks.InitHooks(lgr)
+	hooks.InitHooks(logs.Logger(logging.SubsystemHooks))
+	var hookQueueDaemon *hooks.HookQueue
+	hookQueueDaemon, err = hooks.InitHookQueue(cfg.HookQueue, cfg.Sites.Root, sitesProvider, logs.Logger(logging.SubsystemHooks).With(zap.String("src", "hookQueue")))
+	if err != nil {
+		lgr.Panic("Failed to initialize hook queue", zap.Error(err))
+	}
+	notifierDaemon := notify.InitNotifier(logs.Logger(logging.SubsystemHooks).With(zap.String("src", "notifier")))
 
 	lgr.Info("Initializing authentication provider...")
+	var presigner *authentication.Presigner
+	presigner, err = authentication.InitPresigner(cfg.Authentication.Presigned)
+	if err != nil {
+		lgr.Panic("Failed to initialize presigner", zap.Error(err))
+	}
 	var authNProvider authentication.Provider
-	authNProvider, err = authentication.InitAuthenticator(cfg.Authentication)
+	authNProvider, err = authentication.InitAuthenticator(cfg.Authentication, presigner, lgr.With(zap.String("src", "authN")))
 	if err != nil {
 		lgr.Panic("Failed to initialize authentication provider", zap.Error(err))
 	}
@@ -78,16 +106,28 @@ func main() {
 		lgr.Panic("Failed to initialize authorization provider", zap.Error(err))
 	}
 
+	lgr.Info("Initializing file watchers...")
+	var authNWatcherDaemon utils.Daemon
+	authNWatcherDaemon, err = utils.NewFileWatcher(lgr.With(zap.String("src", "authNWatcher")), func() { _ = authNProvider.Reload() }, cfg.Authentication.BasicAuth.HTPasswdFile) // errors are logged by the provider
+	if err != nil {
+		lgr.Panic("Failed to initialize authentication file watcher", zap.Error(err))
+	}
+	var authZWatcherDaemon utils.Daemon
+	authZWatcherDaemon, err = utils.NewFileWatcher(lgr.With(zap.String("src", "authZWatcher")), func() { _ = authZProvider.Reload() }, cfg.Authorization.PolicyFile)
+	if err != nil {
+		lgr.Panic("Failed to initialize authorization file watcher", zap.Error(err))
+	}
+
 	lgr.Info("Initializing API...")
 	var apiDaemon utils.Daemon
-	apiDaemon, err = api.InitApi(cfg.Listen, authNProvider, authZProvider, sitesProvider, lgr)
+	apiDaemon, err = api.InitApi(cfg.Listen, authNProvider, authZProvider, sitesProvider, presigner, logs, hookQueueDaemon, logs.Logger(logging.SubsystemAPI))
 	if err != nil {
 		lgr.Panic("Failed to initialize API", zap.Error(err))
 	}
 
 	lgr.Info("Initializing Job runner...")
 	var jobRunnerDaemon utils.Daemon
-	jobRunnerDaemon, err = jobs.InitJobRunner(lgr, sitesProvider)
+	jobRunnerDaemon, err = jobs.InitJobRunner(logs.Logger(logging.SubsystemJobs), sitesProvider)
 	if err != nil {
 		lgr.Panic("Failed to initialize job runner", zap.Error(err))
 	}
@@ -96,6 +136,9 @@ func main() {
 	signal.Notify(stopSignal, syscall.SIGINT)
 	signal.Notify(stopSignal, syscall.SIGTERM)
 
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
+
 	// all initialization done, start stuff
 	lgr.Debug("Starting API...")
 	err = apiDaemon.Start()
@@ -103,6 +146,28 @@ func main() {
 		lgr.Panic("Failed to start API", zap.Error(err))
 	}
 
+	lgr.Debug("Starting file watchers...")
+	err = authNWatcherDaemon.Start()
+	if err != nil {
+		lgr.Panic("Failed to start authentication file watcher", zap.Error(err))
+	}
+	err = authZWatcherDaemon.Start()
+	if err != nil {
+		lgr.Panic("Failed to start authorization file watcher", zap.Error(err))
+	}
+
+	lgr.Debug("Starting hook queue...")
+	err = hookQueueDaemon.Start()
+	if err != nil {
+		lgr.Panic("Failed to start hook queue", zap.Error(err))
+	}
+
+	lgr.Debug("Starting notifier...")
+	err = notifierDaemon.Start()
+	if err != nil {
+		lgr.Panic("Failed to start notifier", zap.Error(err))
+	}
+
 	lgr.Debug("Starting job runner...")
 	err = jobRunnerDaemon.Start()
 	if err != nil {
@@ -110,13 +175,23 @@ func main() {
 	}
 
 	lgr.Info("Ready!")
-	select {
-	case sig := <-stopSignal: // wait for stop signal, and stop gracefully
-		lgr.Info("Stop signal recieved, stopping server...", zap.String("signal", sig.String()))
-	case err = <-jobRunnerDaemon.ErrChan():
-		lgr.Panic("Job runner daemon ran into a problem", zap.Error(err))
-	case err = <-apiDaemon.ErrChan():
-		lgr.Panic("API daemon ran into a problem", zap.Error(err))
+	running := true
+	for running {
+		select {
+		case sig := <-stopSignal: // wait for stop signal, and stop gracefully
+			lgr.Info("Stop signal recieved, stopping server...", zap.String("signal", sig.String()))
+			running = false
+		case <-reloadSignal:
+			cfg = reloadConfig(lgr, cfg, sitesProvider)
+		case err = <-jobRunnerDaemon.ErrChan():
+			lgr.Panic("Job runner daemon ran into a problem", zap.Error(err))
+		case err = <-apiDaemon.ErrChan():
+			lgr.Panic("API daemon ran into a problem", zap.Error(err))
+		case err = <-hookQueueDaemon.ErrChan():
+			lgr.Panic("Hook queue ran into a problem", zap.Error(err))
+		case err = <-notifierDaemon.ErrChan():
+			lgr.Panic("Notifier ran into a problem", zap.Error(err))
+		}
 	}
 
 	lgr.Info("Stopping job runner...")
@@ -125,11 +200,33 @@ func main() {
 		lgr.Panic("Failed to destroy job runner", zap.Error(err))
 	}
 
+	lgr.Info("Stopping file watchers...")
+	err = authNWatcherDaemon.Destroy()
+	if err != nil {
+		lgr.Panic("Failed to destroy authentication file watcher", zap.Error(err))
+	}
+	err = authZWatcherDaemon.Destroy()
+	if err != nil {
+		lgr.Panic("Failed to destroy authorization file watcher", zap.Error(err))
+	}
+
 	lgr.Info("Stopping API...")
 	err = apiDaemon.Destroy()
 	if err != nil {
 		lgr.Panic("Failed to destroy API", zap.Error(err))
 	}
 
+	lgr.Info("Stopping hook queue...") // after the API, so no new events are queued, the unfinished ones are run on the next start
+	err = hookQueueDaemon.Destroy()
+	if err != nil {
+		lgr.Panic("Failed to destroy hook queue", zap.Error(err))
+	}
+
+	lgr.Info("Stopping notifier...") // after the API and the jobs, so the pending notifications can be sent
+	err = notifierDaemon.Destroy()
+	if err != nil {
+		lgr.Panic("Failed to destroy notifier", zap.Error(err))
+	}
+
 	lgr.Debug("Bye!")
 }
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/hooks"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Event is the kind of change the notification is about
+type Event string
+
+const (
+	EventCreated     Event = "created"      // a new deployment was created
+	EventUploaded    Event = "uploaded"     // files were uploaded to a deployment, aggregated over a short time
+	EventFinished    Event = "finished"     // a deployment was finished
+	EventLiveChanged Event = "live_changed" // a deployment was set live
+	EventDeleted     Event = "deleted"      // a deployment was deleted or aborted through the API
+	EventStaleReaped Event = "stale_reaped" // an unfinished deployment was deleted by the cleanup job
+)
+
+// AllEvents are the events that can be configured, in lifecycle order
+var AllEvents = []Event{EventCreated, EventUploaded, EventFinished, EventLiveChanged, EventDeleted, EventStaleReaped}
+
+const (
+	// CloudEventsSpecVersion is the version of the CloudEvents spec the notifications follow
+	CloudEventsSpecVersion = "1.0"
+
+	// CloudEventsContentType is the content type of the notifications (structured mode)
+	CloudEventsContentType = "application/cloudevents+json; charset=utf-8"
+
+	// EventTypePrefix is prepended to the Event to get the type of the CloudEvent
+	EventTypePrefix = "io.webploy.deployment."
+)
+
+// EventData is the data of the CloudEvent, the fields that do not apply to the event are left out
+type EventData struct {
+	Site           string   `json:"site"`
+	DeploymentID   string   `json:"deployment_id"`
+	User           string   `json:"user,omitempty"` // the user whose action caused the event, empty for stale_reaped
+	RequestID      string   `json:"request_id,omitempty"`
+	Creator        string   `json:"creator,omitempty"`          // of the deployment
+	Meta           string   `json:"meta,omitempty"`             // of the deployment
+	PreviousLiveID string   `json:"previous_live_id,omitempty"` // only for live_changed
+	Files          []string `json:"files,omitempty"`            // only for uploaded, the files uploaded since the previous uploaded event
+}
+
+// CloudEvent is the JSON document posted to the endpoints, see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/spec.md
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject"` // the deployment ID
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            EventData `json:"data"`
+}
+
+// NewCloudEvent creates the CloudEvent of the event, the source is the path of the site in the API
+func NewCloudEvent(event Event, data EventData) CloudEvent {
+	return CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              uuid.NewString(),
+		Source:          "/sites/" + data.Site,
+		Type:            EventTypePrefix + string(event),
+		Subject:         data.DeploymentID,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+}
+
+// IsValidEvent tells if the name can be used in the events of a notification config
+func IsValidEvent(name string) bool {
+	return slices.Contains(config.NotificationEvents, name)
+}
+
+// wantsEvent tells if the endpoint is interested in the event
+func wantsEvent(cfg config.NotificationConfig, event Event) bool {
+	return len(cfg.Events) == 0 || slices.Contains(cfg.Events, string(event))
+}
+
+// notificationSecret returns the secret used to sign the body, nil if signing is not configured
+func notificationSecret(cfg config.NotificationConfig) ([]byte, error) {
+	return config.ReadSecret(cfg.Secret, cfg.SecretFile)
+}
+
+// deliver posts the CloudEvent to the endpoint, anything but a 2xx response is an error
+func deliver(ctx context.Context, client *http.Client, cfg config.NotificationConfig, ce CloudEvent) error {
+	body, err := json.Marshal(ce)
+	if err != nil {
+		return err
+	}
+
+	var secret []byte
+	secret, err = notificationSecret(cfg)
+	if err != nil {
+		return fmt.Errorf("could not read notification secret: %w", err)
+	}
+
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", CloudEventsContentType)
+	if secret != nil {
+		req.Header.Set(hooks.WebhookSignatureHeader, hooks.SignWebhookBody(secret, body)) // same as for the webhooks, so the receivers can share the verification
+	}
+
+	var resp *http.Response
+	resp, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body) // so that the connection can be reused
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package notify
+
+import (
+	"context"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/site"
+	"go.uber.org/zap"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// queueSize is the number of deliveries waiting to be sent, further notifications are dropped
+	queueSize = 256
+
+	// workers is the number of deliveries sent in parallel
+	workers = 2
+
+	// shutdownTimeout is how long the deliveries still in the queue are sent on shutdown, the rest are dropped
+	shutdownTimeout = 5 * time.Second
+)
+
+// uploadDebounce is the time without uploads to a deployment, after which the uploaded event is sent, it is a var for the tests
+var uploadDebounce = 5 * time.Second
+
+// notifier is used by Send and SendUpload, set by InitNotifier
+var notifier *Notifier
+
+// delivery is a CloudEvent to be posted to a single endpoint
+type delivery struct {
+	cfg config.NotificationConfig
+	ce  CloudEvent
+}
+
+// pendingUpload collects the uploaded files of a deployment until the uploaded event is sent
+type pendingUpload struct {
+	notifications []config.NotificationConfig
+	data          EventData
+	files         map[string]bool // to skip duplicates, the order is kept in data.Files
+	timer         *time.Timer
+}
+
+// Notifier sends the notifications of the sites in the background. Notifications are fire-and-forget: failed deliveries are only logged,
+// and nothing is persisted, so the notifications still waiting are lost on a crash.
+type Notifier struct {
+	logger *zap.Logger
+	client *http.Client
+	queue  chan delivery
+
+	mu       sync.Mutex
+	uploads  map[string]*pendingUpload // by site and deployment ID
+	stopped  bool
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+}
+
+// InitNotifier creates the notifier used by Send and SendUpload, they do nothing until this is called.
+// Notifications are queued until Start is called.
+func InitNotifier(lgr *zap.Logger) *Notifier {
+	notifier = newNotifier(lgr)
+	return notifier
+}
+
+func newNotifier(lgr *zap.Logger) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{
+		logger: lgr,
+		client: &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse // same as for webhooks
+			},
+		},
+		queue:   make(chan delivery, queueSize),
+		uploads: make(map[string]*pendingUpload),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Send notifies the endpoints of the site about the event, in the background. The site name is filled in the data.
+// Pending uploaded events of the deployment are queued before it, to keep the events in order.
+func Send(s site.Site, event Event, data EventData) {
+	if notifier == nil {
+		return
+	}
+	notifier.Send(s.GetConfig().Notifications, event, withSite(s, data))
+}
+
+// SendUpload collects the uploaded files of the deployment, the uploaded event is sent when there were no uploads for a while (or the deployment changes)
+func SendUpload(s site.Site, data EventData) {
+	if notifier == nil {
+		return
+	}
+	notifier.SendUpload(s.GetConfig().Notifications, withSite(s, data))
+}
+
+func withSite(s site.Site, data EventData) EventData {
+	data.Site = s.GetName()
+	return data
+}
+
+// Send queues the event for the endpoints interested in it
+func (n *Notifier) Send(notifications []config.NotificationConfig, event Event, data EventData) {
+	n.flushUpload(uploadKey(data))
+	n.send(notifications, event, data)
+}
+
+// SendUpload adds the files to the pending uploaded event of the deployment, and (re)starts its timer
+func (n *Notifier) SendUpload(notifications []config.NotificationConfig, data EventData) {
+	if !anyWantsEvent(notifications, EventUploaded) {
+		return
+	}
+	key := uploadKey(data)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped {
+		return
+	}
+
+	pu, ok := n.uploads[key]
+	if !ok {
+		pu = &pendingUpload{
+			data:  data,
+			files: make(map[string]bool),
+		}
+		pu.data.Files = nil
+		pu.timer = time.AfterFunc(uploadDebounce, func() { n.flushUpload(key) })
+		n.uploads[key] = pu
+	} else {
+		pu.timer.Reset(uploadDebounce)
+		pu.data.User = data.User // the latest upload is reported
+		pu.data.RequestID = data.RequestID
+	}
+	pu.notifications = notifications // the config may have been changed since
+	for _, f := range data.Files {
+		if !pu.files[f] {
+			pu.files[f] = true
+			pu.data.Files = append(pu.data.Files, f)
+		}
+	}
+}
+
+// flushUpload sends the pending uploaded event of the deployment right away, if there is any
+func (n *Notifier) flushUpload(key string) {
+	n.mu.Lock()
+	pu, ok := n.uploads[key]
+	if ok {
+		pu.timer.Stop()
+		delete(n.uploads, key)
+	}
+	n.mu.Unlock()
+
+	if ok {
+		n.send(pu.notifications, EventUploaded, pu.data)
+	}
+}
+
+func (n *Notifier) send(notifications []config.NotificationConfig, event Event, data EventData) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped {
+		return // the queue is closed
+	}
+
+	for _, cfg := range notifications {
+		if !wantsEvent(cfg, event) {
+			continue
+		}
+		select {
+		case n.queue <- delivery{cfg: cfg, ce: NewCloudEvent(event, data)}:
+		default:
+			n.logger.Warn("Notification queue is full, dropping notification", zap.String("event", string(event)), zap.String("site", data.Site), zap.String("url", cfg.URL))
+		}
+	}
+}
+
+// Start starts the workers
+func (n *Notifier) Start() error {
+	for i := 0; i < workers; i++ {
+		n.wg.Add(1)
+		go n.worker()
+	}
+	return nil
+}
+
+// Destroy sends the pending uploaded events, and waits for the queued notifications to be sent for a while
+func (n *Notifier) Destroy() error {
+	n.stopOnce.Do(func() {
+		n.mu.Lock()
+		keys := make([]string, 0, len(n.uploads))
+		for key := range n.uploads {
+			keys = append(keys, key)
+		}
+		n.mu.Unlock()
+		for _, key := range keys {
+			n.flushUpload(key)
+		}
+
+		n.mu.Lock()
+		n.stopped = true // nothing is sent to the queue after closing it
+		close(n.queue)
+		n.mu.Unlock()
+
+		timer := time.AfterFunc(shutdownTimeout, n.cancel)
+		n.wg.Wait()
+		timer.Stop()
+		n.cancel()
+	})
+	return nil
+}
+
+func (n *Notifier) ErrChan() <-chan error {
+	return nil // failed deliveries are only logged
+}
+
+func (n *Notifier) worker() {
+	defer n.wg.Done()
+	for d := range n.queue {
+		l := n.logger.With(zap.String("event", d.ce.Type), zap.String("eventID", d.ce.ID), zap.String("site", d.ce.Data.Site), zap.String("deploymentID", d.ce.Data.DeploymentID), zap.String("url", d.cfg.URL))
+		err := deliver(n.ctx, n.client, d.cfg, d.ce)
+		if err != nil {
+			l.Warn("Failed to deliver notification", zap.Error(err))
+			continue
+		}
+		l.Debug("Notification delivered")
+	}
+}
+
+func uploadKey(data EventData) string {
+	return data.Site + "/" + data.DeploymentID
+}
+
+func anyWantsEvent(notifications []config.NotificationConfig, event Event) bool {
+	for _, cfg := range notifications {
+		if wantsEvent(cfg, event) {
+			return true
+		}
+	}
+	return false
+}
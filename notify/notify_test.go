@@ -0,0 +1,216 @@
+package notify
+
+import (
+	"encoding/json"
+	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/hooks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+type receivedEvent struct {
+	header http.Header
+	body   []byte
+	ce     CloudEvent
+}
+
+// eventRecorder is a thread-safe test endpoint, that responds with the given status code
+type eventRecorder struct {
+	mu       sync.Mutex
+	received []receivedEvent
+	status   int
+}
+
+func (er *eventRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var ce CloudEvent
+	_ = json.Unmarshal(body, &ce)
+
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	er.received = append(er.received, receivedEvent{header: r.Header.Clone(), body: body, ce: ce})
+	w.WriteHeader(er.status)
+}
+
+func (er *eventRecorder) events() []receivedEvent {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	return append([]receivedEvent{}, er.received...)
+}
+
+func (er *eventRecorder) types() []string {
+	var types []string
+	for _, re := range er.events() {
+		types = append(types, re.ce.Type)
+	}
+	return types
+}
+
+func newTestEndpoint(t *testing.T, status int) (*eventRecorder, string) {
+	er := &eventRecorder{status: status}
+	srv := httptest.NewServer(er)
+	t.Cleanup(srv.Close)
+	return er, srv.URL
+}
+
+func TestIsValidEvent(t *testing.T) {
+	for _, event := range AllEvents {
+		assert.True(t, IsValidEvent(string(event)))
+	}
+	assert.False(t, IsValidEvent("exploded"))
+	assert.False(t, IsValidEvent(""))
+
+	// the config accepts the same events
+	var names []string
+	for _, event := range AllEvents {
+		names = append(names, string(event))
+	}
+	assert.Equal(t, config.NotificationEvents, names)
+}
+
+func TestNotifier_Send(t *testing.T) {
+	secretFile := path.Join(t.TempDir(), "secret")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("file secret\n"), 0o600))
+
+	testCases := []struct {
+		name           string
+		cfg            config.NotificationConfig
+		event          Event
+		expectSent     bool
+		expectedSecret string
+	}{
+		{name: "happy__unsigned", cfg: config.NotificationConfig{}, event: EventFinished, expectSent: true},
+		{name: "happy__secret", cfg: config.NotificationConfig{Secret: "secret"}, event: EventFinished, expectSent: true, expectedSecret: "secret"},
+		{name: "happy__secret_file", cfg: config.NotificationConfig{SecretFile: secretFile}, event: EventFinished, expectSent: true, expectedSecret: "file secret"},
+		{name: "happy__selected_event", cfg: config.NotificationConfig{Events: []string{"live_changed", "finished"}}, event: EventFinished, expectSent: true},
+		{name: "happy__filtered_event", cfg: config.NotificationConfig{Events: []string{"live_changed"}}, event: EventFinished, expectSent: false},
+		{name: "error__missing_secret_file", cfg: config.NotificationConfig{SecretFile: path.Join(t.TempDir(), "missing")}, event: EventFinished, expectSent: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			er, url := newTestEndpoint(t, http.StatusNoContent)
+			tc.cfg.URL = url
+			tc.cfg.Headers = map[string]string{"X-Test": "test"}
+
+			n := newNotifier(zaptest.NewLogger(t))
+			assert.NoError(t, n.Start())
+
+			data := EventData{Site: "test_site", DeploymentID: "test_deployment", User: "test_user", Creator: "test_creator", Meta: "test meta"}
+			n.Send([]config.NotificationConfig{tc.cfg}, tc.event, data)
+			assert.NoError(t, n.Destroy()) // waits for the delivery
+
+			received := er.events()
+			if !tc.expectSent {
+				assert.Empty(t, received)
+				return
+			}
+			if !assert.Len(t, received, 1) {
+				return
+			}
+
+			re := received[0]
+			assert.Equal(t, CloudEventsContentType, re.header.Get("Content-Type"))
+			assert.Equal(t, "test", re.header.Get("X-Test"))
+			if tc.expectedSecret != "" {
+				assert.Equal(t, hooks.SignWebhookBody([]byte(tc.expectedSecret), re.body), re.header.Get(hooks.WebhookSignatureHeader))
+			} else {
+				assert.Empty(t, re.header.Get(hooks.WebhookSignatureHeader))
+			}
+
+			assert.Equal(t, CloudEventsSpecVersion, re.ce.SpecVersion)
+			assert.NotEmpty(t, re.ce.ID)
+			assert.Equal(t, "/sites/test_site", re.ce.Source)
+			assert.Equal(t, "io.webploy.deployment.finished", re.ce.Type)
+			assert.Equal(t, "test_deployment", re.ce.Subject)
+			assert.WithinDuration(t, time.Now(), re.ce.Time, time.Minute)
+			assert.Equal(t, "application/json", re.ce.DataContentType)
+			assert.Equal(t, data, re.ce.Data)
+		})
+	}
+}
+
+func TestNotifier_SendMultipleEndpoints(t *testing.T) {
+	er1, url1 := newTestEndpoint(t, http.StatusInternalServerError) // failures are only logged
+	er2, url2 := newTestEndpoint(t, http.StatusOK)
+
+	n := newNotifier(zaptest.NewLogger(t))
+	assert.NoError(t, n.Start())
+
+	notifications := []config.NotificationConfig{{URL: url1}, {URL: url2, Events: []string{"deleted"}}}
+	n.Send(notifications, EventCreated, EventData{Site: "test_site", DeploymentID: "test_deployment"})
+	n.Send(notifications, EventDeleted, EventData{Site: "test_site", DeploymentID: "test_deployment"})
+	assert.NoError(t, n.Destroy())
+
+	assert.ElementsMatch(t, []string{"io.webploy.deployment.created", "io.webploy.deployment.deleted"}, er1.types())
+	assert.Equal(t, []string{"io.webploy.deployment.deleted"}, er2.types())
+}
+
+func TestNotifier_SendUpload(t *testing.T) {
+	uploadDebounce = 50 * time.Millisecond
+	defer func() { uploadDebounce = 5 * time.Second }()
+
+	er, url := newTestEndpoint(t, http.StatusOK)
+	notifications := []config.NotificationConfig{{URL: url}}
+
+	n := newNotifier(zaptest.NewLogger(t))
+	assert.NoError(t, n.Start())
+	defer func() { assert.NoError(t, n.Destroy()) }()
+
+	// aggregated after the uploads settle
+	n.SendUpload(notifications, EventData{Site: "test_site", DeploymentID: "d1", User: "user1", Files: []string{"index.html"}})
+	n.SendUpload(notifications, EventData{Site: "test_site", DeploymentID: "d1", User: "user2", Files: []string{"style.css", "index.html"}})
+	n.SendUpload(notifications, EventData{Site: "test_site", DeploymentID: "d2", User: "user1", Files: []string{"other.html"}})
+
+	assert.Eventually(t, func() bool {
+		return len(er.events()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	byDeployment := map[string]EventData{}
+	for _, re := range er.events() {
+		assert.Equal(t, "io.webploy.deployment.uploaded", re.ce.Type)
+		byDeployment[re.ce.Data.DeploymentID] = re.ce.Data
+	}
+	assert.Equal(t, []string{"index.html", "style.css"}, byDeployment["d1"].Files)
+	assert.Equal(t, "user2", byDeployment["d1"].User)
+	assert.Equal(t, []string{"other.html"}, byDeployment["d2"].Files)
+
+	// flushed by the next event of the deployment
+	uploadDebounce = time.Hour
+	n.SendUpload(notifications, EventData{Site: "test_site", DeploymentID: "d1", Files: []string{"late.html"}})
+	n.Send(notifications, EventFinished, EventData{Site: "test_site", DeploymentID: "d1"})
+
+	assert.Eventually(t, func() bool {
+		return len(er.events()) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, er.types()[2:], "io.webploy.deployment.uploaded")
+	assert.Contains(t, er.types()[2:], "io.webploy.deployment.finished")
+}
+
+func TestNotifier_DestroyFlushesUploads(t *testing.T) {
+	uploadDebounce = time.Hour
+	defer func() { uploadDebounce = 5 * time.Second }()
+
+	er, url := newTestEndpoint(t, http.StatusOK)
+
+	n := newNotifier(zaptest.NewLogger(t))
+	assert.NoError(t, n.Start())
+	n.SendUpload([]config.NotificationConfig{{URL: url}}, EventData{Site: "test_site", DeploymentID: "d1", Files: []string{"index.html"}})
+	assert.NoError(t, n.Destroy())
+
+	assert.Equal(t, []string{"io.webploy.deployment.uploaded"}, er.types())
+
+	// ignored after stopping
+	n.SendUpload([]config.NotificationConfig{{URL: url}}, EventData{Site: "test_site", DeploymentID: "d1", Files: []string{"index.html"}})
+	n.Send([]config.NotificationConfig{{URL: url}}, EventDeleted, EventData{Site: "test_site", DeploymentID: "d1"})
+	assert.NoError(t, n.Destroy())
+	assert.Len(t, er.events(), 1)
+}
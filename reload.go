@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/default_deployment"
+	"github.com/marcsello/webploy-server/site"
+	"go.uber.org/zap"
+)
+
+// reloadConfig re-reads the config file and applies the site changes. Changes that can not be applied at runtime are only reported.
+// Returns the config that is in effect after the reload.
+func reloadConfig(lgr *zap.Logger, runningCfg config.WebployConfig, sitesProvider site.Provider) config.WebployConfig {
+	lgr.Info("Reloading config...")
+
+	newCfg, err := config.LoadConfig(lgr)
+	if err != nil {
+		lgr.Error("Failed to load config, keeping the running config", zap.Error(err))
+		return runningCfg
+	}
+
+	restartRequired := config.RestartRequiredChanges(runningCfg, newCfg)
+	if len(restartRequired) > 0 {
+		lgr.Warn("Some changes can not be applied without restarting webploy, these are ignored", zap.Strings("sections", restartRequired))
+	}
+
+	var newSites []site.Site
+	newSites, err = sitesProvider.SyncStaticSites(newCfg.Sites)
+	if err != nil {
+		lgr.Error("Some site changes could not be applied", zap.Error(err)) // the rest is applied
+	}
+
+	for _, s := range newSites {
+		err = default_deployment.CreateDefaultDeployment(s, lgr.With(zap.String("siteName", s.GetName())))
+		if err != nil {
+			lgr.Error("Failed to create the default deployment for new site", zap.String("siteName", s.GetName()), zap.Error(err))
+		}
+	}
+
+	// only the sites are updated, so the sections requiring a restart keep being reported until it happens
+	runningCfg.Sites.Sites = newCfg.Sites.Sites
+	runningCfg.Sites.Defaults = newCfg.Sites.Defaults
+	runningCfg.Sites.Templates = newCfg.Sites.Templates
+
+	lgr.Info("Config reloaded", zap.Int("newSitesCount", len(newSites)), zap.Bool("restartRequired", len(restartRequired) > 0))
+	return runningCfg
+}
@@ -8,3 +8,13 @@ var ErrDeploymentExists = errors.New("deployment exists")
 var ErrInvalidID = errors.New("invalid id")
 var ErrDeploymentLive = errors.New("deployment is live")
 var ErrDeploymentNotFinished = errors.New("deployment not finished")
+var ErrSiteExists = errors.New("site already exists")
+var ErrSiteNotExists = errors.New("site not exists")
+var ErrSiteNotManaged = errors.New("site is defined in the config file, it can not be changed at runtime")
+var ErrManagedSitesDisabled = errors.New("managed sites are not enabled")
+var ErrSiteNameImmutable = errors.New("the name of a site can not be changed")
+var ErrLinkNameImmutable = errors.New("the link name of a site can not be changed")
+var ErrPathImmutable = errors.New("the path and the link dir of a site can not be changed")
+var ErrPathConflict = errors.New("the path or the live link of the site is already used by another site")
+var ErrLinkDirFilesystem = errors.New("the link dir must be on the same filesystem as the deployments")
+var ErrRestrictedSiteField = errors.New("hooks, notifications, path and link_dir can only be set in the config file")
@@ -1,9 +1,31 @@
 package site
 
+import "github.com/marcsello/webploy-server/config"
+
 // Provider is an interface for sites provider, it's main purpose is to look up sites by their names
-// The number of sites will never change while the software is running, so the provider does not implement any complex transactional access to sites
+// Sites loaded from the managed file can be added, updated and removed while the software is running, sites defined in the config file are fixed
 type Provider interface {
 	GetSite(name string) (Site, bool)
 	GetAllSiteNames() []string
 	GetNewSiteNamesSinceInit() []string
+
+	// IsManaged tells if the site is loaded from the managed file, only those can be changed at runtime
+	IsManaged(name string) bool
+
+	// AddSite creates a new managed site, returns true if the directory of the site was just created
+	AddSite(siteCfg config.SiteConfig) (Site, bool, error)
+
+	// UpdateSite replaces the config of a managed site
+	UpdateSite(siteCfg config.SiteConfig) error
+
+	// RemoveSite removes a managed site, the files of the site are kept
+	RemoveSite(name string) error
+
+	// ResolveSite applies the site defaults and the template referenced by the layer, the same way as for the sites in the config file
+	ResolveSite(layer *config.SiteConfigLayer) (config.SiteConfig, error)
+
+	// SyncStaticSites makes the sites defined in the config file match sitesCfg, managed sites are not affected.
+	// The defaults and templates of sitesCfg are used for resolving sites from then on.
+	// Returns the sites whose directory was just created.
+	SyncStaticSites(sitesCfg config.SitesConfig) ([]Site, error)
 }
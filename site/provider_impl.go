@@ -1,103 +1,439 @@
 package site
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/marcsello/webploy-server/config"
 	"github.com/marcsello/webploy-server/deployment"
+	"github.com/natefinch/atomic"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
 	"path"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
 )
 
 type ProviderImpl struct {
+	root         string
+	managedFile  string // empty if managing sites at runtime is disabled
+	mutex        sync.RWMutex
 	siteNames    []string
-	sites        map[string]*SiteImpl // will be read only, no need for locking
+	sites        map[string]*SiteImpl
+	managed      map[string]bool // names of the sites loaded from the managed file, only these can be changed at runtime
 	newSiteNames []string
+	layers       config.SitesConfig // only the defaults and the templates are set, used to resolve the managed sites
+	logger       *zap.Logger
 }
 
 func InitSites(cfg config.SitesConfig, lgr *zap.Logger) (Provider, error) {
 
-	var firstTimers []string // names of sites that are just created
-	var siteNames []string   // names of sites that are just created
-
-	sites := make(map[string]*SiteImpl, len(cfg.Sites))
-	for _, siteCfg := range cfg.Sites {
-		lgr.Info("Loading site", zap.String("Name", siteCfg.Name))
+	p := &ProviderImpl{
+		root:        cfg.Root,
+		managedFile: cfg.ManagedFile,
+		sites:       make(map[string]*SiteImpl, len(cfg.Sites)),
+		managed:     make(map[string]bool),
+		layers:      config.SitesConfig{Defaults: cfg.Defaults, Templates: cfg.Templates},
+		logger:      lgr,
+	}
 
-		// validate the name
-		err := ValidateSiteName(siteCfg.Name)
+	var managedSites []config.SiteConfig
+	if cfg.ManagedFile != "" {
+		var err error
+		managedSites, err = LoadManagedSites(cfg.ManagedFile)
 		if err != nil {
-			lgr.Error("The site has an invalid name", zap.String("Name", siteCfg.Name), zap.Error(err))
-			return nil, ErrSiteNameInvalid
+			lgr.Error("Failed to load managed sites", zap.String("managedFile", cfg.ManagedFile), zap.Error(err))
+			return nil, err
 		}
+	}
+
+	for i, siteCfg := range append(slices.Clone(cfg.Sites), managedSites...) {
+		lgr.Info("Loading site", zap.String("Name", siteCfg.Name))
 
 		// check for duplicate
-		_, duplicate := sites[siteCfg.Name]
+		_, duplicate := p.sites[siteCfg.Name]
 		if duplicate {
 			return nil, fmt.Errorf("duplicate site config: %s", siteCfg.Name)
 		}
 
-		// figure out the path for site's files
-		// typically /var/www/some_site
-		fullPath := path.Join(cfg.Root, siteCfg.Name)
-		lgr.Debug("Full path for site", zap.String("siteName", siteCfg.Name), zap.String("fullPath", fullPath))
-
-		siteLogger := lgr.With(zap.String("siteName", siteCfg.Name))
-
-		// initialize deployment provider for the site
-		var dp deployment.Provider
-		dp, err = deployment.InitDeploymentProvider(fullPath, siteCfg, siteLogger)
-		if err != nil {
-			lgr.Error("Failed to initialize deployment provider for site", zap.String("siteName", siteCfg.Name), zap.Error(err))
-			return nil, err
-		}
-		lgr.Debug("Deployment provider successfully initialized", zap.String("siteName", siteCfg.Name))
-
-		// create site object
-		site := &SiteImpl{
-			fullPath:           fullPath,
-			deploymentsMutex:   sync.RWMutex{},
-			cfg:                siteCfg,
-			deploymentProvider: dp,
-			logger:             siteLogger,
-		}
-
-		// run init stuff (create dir if needed)
-		var first bool
-		first, err = site.Init()
+		site, first, err := p.newSite(siteCfg)
 		if err != nil {
 			return nil, err
 		}
 		if first {
 			lgr.Debug("site is created as new", zap.String("siteName", siteCfg.Name))
-			firstTimers = append(firstTimers, siteCfg.Name)
+			p.newSiteNames = append(p.newSiteNames, siteCfg.Name)
 		}
 
 		// store it
-		sites[siteCfg.Name] = site
-		siteNames = append(siteNames, siteCfg.Name)
+		p.sites[siteCfg.Name] = site
+		p.siteNames = append(p.siteNames, siteCfg.Name)
+		if i >= len(cfg.Sites) {
+			p.managed[siteCfg.Name] = true
+		}
 	}
 
-	if len(sites) == 0 {
+	if len(p.sites) == 0 {
 		lgr.Warn("No sites configured")
 	}
 
-	return &ProviderImpl{
-		siteNames:    siteNames,
-		sites:        sites,
-		newSiteNames: firstTimers,
-	}, nil
+	return p, nil
+}
+
+// loadManagedSites reads the site configs from the managed file, a missing file is treated as empty
+func LoadManagedSites(managedFile string) ([]config.SiteConfig, error) {
+	data, err := os.ReadFile(managedFile) // #nosec G304
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var sites []config.SiteConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&sites)
+	if err != nil && !errors.Is(err, io.EOF) { // empty file
+		return nil, err
+	}
+	return sites, nil
+}
+
+// saveManagedSites writes the config of all managed sites to the managed file, must be called with the mutex held
+func (p *ProviderImpl) saveManagedSites() error {
+	sites := make([]config.SiteConfig, 0, len(p.managed))
+	for _, name := range p.siteNames {
+		if p.managed[name] {
+			sites = append(sites, p.sites[name].GetConfig())
+		}
+	}
+
+	data, err := yaml.Marshal(sites)
+	if err != nil {
+		return err
+	}
+
+	return atomic.WriteFile(p.managedFile, bytes.NewReader(data))
+}
+
+// sitePaths returns the directory of the deployments and the directory of the live link of the site
+func (p *ProviderImpl) sitePaths(siteCfg config.SiteConfig) (string, string) {
+	fullPath := path.Join(p.root, siteCfg.Name)
+	if siteCfg.Path != "" {
+		fullPath = resolvePath(p.root, siteCfg.Path)
+	}
+	linkDir := fullPath
+	if siteCfg.LinkDir != "" {
+		linkDir = resolvePath(p.root, siteCfg.LinkDir)
+	}
+	return fullPath, linkDir
+}
+
+func resolvePath(root, p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(root, p)
+}
+
+// isWithin tells if p is the same as dir, or it is inside it. Both must be clean.
+func isWithin(p, dir string) bool {
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+// pathsConflict tells if two sites would mess up each other: their directories must not contain each other,
+// and the live link of one must not replace the directory of the other (or a directory containing it)
+func pathsConflict(fullPath, linkPath, otherFullPath, otherLinkPath string) bool {
+	return isWithin(fullPath, otherFullPath) || isWithin(otherFullPath, fullPath) ||
+		linkPath == otherLinkPath ||
+		isWithin(otherFullPath, linkPath) || isWithin(fullPath, otherLinkPath)
+}
+
+// newSite creates the site object and runs its init (create dir if needed), returns true if the site is just created
+func (p *ProviderImpl) newSite(siteCfg config.SiteConfig) (*SiteImpl, bool, error) {
+	// validate the name
+	err := ValidateSiteName(siteCfg.Name)
+	if err != nil {
+		p.logger.Error("The site has an invalid name", zap.String("Name", siteCfg.Name), zap.Error(err))
+		return nil, false, ErrSiteNameInvalid
+	}
+
+	// figure out the path for site's files
+	// typically /var/www/some_site
+	fullPath, linkDir := p.sitePaths(siteCfg)
+	p.logger.Debug("Full path for site", zap.String("siteName", siteCfg.Name), zap.String("fullPath", fullPath), zap.String("linkDir", linkDir))
+
+	linkPath := path.Join(linkDir, siteCfg.LiveLinkName)
+	for _, other := range p.sites {
+		otherLinkPath := path.Join(other.linkDir, other.GetConfig().LiveLinkName)
+		if pathsConflict(fullPath, linkPath, other.fullPath, otherLinkPath) {
+			p.logger.Error("The site conflicts with another site", zap.String("siteName", siteCfg.Name), zap.String("otherSiteName", other.GetName()))
+			return nil, false, ErrPathConflict
+		}
+	}
+
+	siteLogger := p.logger.With(zap.String("siteName", siteCfg.Name))
+
+	// initialize deployment provider for the site
+	var dp deployment.Provider
+	dp, err = deployment.InitDeploymentProvider(fullPath, siteCfg, siteLogger)
+	if err != nil {
+		p.logger.Error("Failed to initialize deployment provider for site", zap.String("siteName", siteCfg.Name), zap.Error(err))
+		return nil, false, err
+	}
+	p.logger.Debug("Deployment provider successfully initialized", zap.String("siteName", siteCfg.Name))
+
+	// create site object
+	site := &SiteImpl{
+		fullPath:           fullPath,
+		linkDir:            linkDir,
+		deploymentsMutex:   sync.RWMutex{},
+		cfg:                siteCfg,
+		deploymentProvider: dp,
+		logger:             siteLogger,
+	}
+
+	// run init stuff (create dir if needed)
+	var first bool
+	first, err = site.Init()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return site, first, nil
 }
 
 func (p *ProviderImpl) GetSite(name string) (Site, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
 	site, ok := p.sites[name]
 	return site, ok
 }
 
 func (p *ProviderImpl) GetAllSiteNames() []string {
-	return p.siteNames
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return slices.Clone(p.siteNames)
 }
 
 func (p *ProviderImpl) GetNewSiteNamesSinceInit() []string {
 	return p.newSiteNames
 }
+
+func (p *ProviderImpl) IsManaged(name string) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.managed[name]
+}
+
+func (p *ProviderImpl) ResolveSite(layer *config.SiteConfigLayer) (config.SiteConfig, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.layers.ResolveSite(layer)
+}
+
+func (p *ProviderImpl) AddSite(siteCfg config.SiteConfig) (Site, bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.managedFile == "" {
+		return nil, false, ErrManagedSitesDisabled
+	}
+
+	err := validateManagedSiteConfig(siteCfg)
+	if err != nil {
+		return nil, false, err
+	}
+
+	_, exists := p.sites[siteCfg.Name]
+	if exists {
+		return nil, false, ErrSiteExists
+	}
+
+	var site *SiteImpl
+	var first bool
+	site, first, err = p.newSite(siteCfg)
+	if err != nil {
+		return nil, false, err
+	}
+
+	p.sites[siteCfg.Name] = site
+	p.siteNames = append(p.siteNames, siteCfg.Name)
+	p.managed[siteCfg.Name] = true
+
+	err = p.saveManagedSites()
+	if err != nil {
+		// revert, the directory of the site is left there, it does not hurt
+		delete(p.sites, siteCfg.Name)
+		delete(p.managed, siteCfg.Name)
+		p.siteNames = p.siteNames[:len(p.siteNames)-1]
+		p.logger.Error("Failed to save managed sites, site is not added", zap.String("siteName", siteCfg.Name), zap.Error(err))
+		return nil, false, err
+	}
+
+	p.logger.Info("Site added", zap.String("siteName", siteCfg.Name), zap.Bool("first", first))
+	return site, first, nil
+}
+
+func (p *ProviderImpl) UpdateSite(siteCfg config.SiteConfig) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	site, err := p.getManagedSite(siteCfg.Name)
+	if err != nil {
+		return err
+	}
+
+	err = validateManagedSiteConfig(siteCfg)
+	if err != nil {
+		return err
+	}
+
+	oldCfg := site.GetConfig()
+	err = site.UpdateConfig(siteCfg)
+	if err != nil {
+		return err
+	}
+
+	err = p.saveManagedSites()
+	if err != nil {
+		_ = site.UpdateConfig(oldCfg) // revert, this can not fail, as the name and the link name is not changed
+		p.logger.Error("Failed to save managed sites, site is not updated", zap.String("siteName", siteCfg.Name), zap.Error(err))
+		return err
+	}
+
+	p.logger.Info("Site updated", zap.String("siteName", siteCfg.Name))
+	return nil
+}
+
+func (p *ProviderImpl) RemoveSite(name string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	site, err := p.getManagedSite(name)
+	if err != nil {
+		return err
+	}
+
+	oldSiteNames := slices.Clone(p.siteNames)
+	delete(p.sites, name)
+	delete(p.managed, name)
+	p.siteNames = slices.DeleteFunc(p.siteNames, func(s string) bool { return s == name })
+
+	err = p.saveManagedSites()
+	if err != nil {
+		// revert
+		p.sites[name] = site
+		p.managed[name] = true
+		p.siteNames = oldSiteNames
+		p.logger.Error("Failed to save managed sites, site is not removed", zap.String("siteName", name), zap.Error(err))
+		return err
+	}
+
+	p.logger.Info("Site removed, files are kept", zap.String("siteName", name), zap.String("path", site.GetPath()))
+	return nil
+}
+
+// validateManagedSiteConfig rejects the settings of managed sites that would give more power than managing sites:
+// hooks and notifications run scripts and call URLs as webploy, and the paths could point anywhere on the host.
+// Without path and link_dir, the site is always in its own directory under the root.
+func validateManagedSiteConfig(siteCfg config.SiteConfig) error {
+	if siteCfg.Hooks.HasHooks() || len(siteCfg.Notifications) > 0 || siteCfg.Path != "" || siteCfg.LinkDir != "" {
+		return ErrRestrictedSiteField
+	}
+	return nil
+}
+
+// getManagedSite returns the site if it exists and can be changed, must be called with the mutex held
+func (p *ProviderImpl) getManagedSite(name string) (*SiteImpl, error) {
+	if p.managedFile == "" {
+		return nil, ErrManagedSitesDisabled
+	}
+
+	site, exists := p.sites[name]
+	if !exists {
+		return nil, ErrSiteNotExists
+	}
+	if !p.managed[name] {
+		return nil, ErrSiteNotManaged
+	}
+	return site, nil
+}
+
+// SyncStaticSites applies the changes of the sites defined in the config file: the config of existing sites is updated, new sites are added, and missing ones are removed (their files are kept).
+// Changes are applied site-by-site, a site that can not be changed does not prevent the others from being changed.
+func (p *ProviderImpl) SyncStaticSites(sitesCfg config.SitesConfig) ([]Site, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	siteCfgs := sitesCfg.Sites
+	newCfgs := make(map[string]config.SiteConfig, len(siteCfgs))
+	for _, siteCfg := range siteCfgs {
+		if _, duplicate := newCfgs[siteCfg.Name]; duplicate {
+			return nil, fmt.Errorf("duplicate site config: %s", siteCfg.Name)
+		}
+		newCfgs[siteCfg.Name] = siteCfg
+	}
+
+	p.layers = config.SitesConfig{Defaults: sitesCfg.Defaults, Templates: sitesCfg.Templates}
+
+	var errs []error
+
+	// remove the sites that are no longer defined
+	for _, name := range slices.Clone(p.siteNames) {
+		if _, keep := newCfgs[name]; keep || p.managed[name] {
+			continue
+		}
+		delete(p.sites, name)
+		p.siteNames = slices.DeleteFunc(p.siteNames, func(s string) bool { return s == name })
+		p.logger.Info("Site removed, files are kept", zap.String("siteName", name))
+	}
+
+	var firstTimers []Site
+	for _, siteCfg := range siteCfgs {
+		l := p.logger.With(zap.String("siteName", siteCfg.Name))
+
+		if p.managed[siteCfg.Name] {
+			errs = append(errs, fmt.Errorf("%s: %w", siteCfg.Name, ErrSiteExists))
+			l.Error("Site defined in the config file already exists as a managed site, ignoring")
+			continue
+		}
+
+		site, exists := p.sites[siteCfg.Name]
+		if exists {
+			if reflect.DeepEqual(site.GetConfig(), siteCfg) {
+				continue // nothing changed
+			}
+			err := site.UpdateConfig(siteCfg)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", siteCfg.Name, err))
+				l.Error("Failed to update site config", zap.Error(err))
+				continue
+			}
+			l.Info("Site config updated")
+			continue
+		}
+
+		var first bool
+		var err error
+		site, first, err = p.newSite(siteCfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", siteCfg.Name, err))
+			l.Error("Failed to add site", zap.Error(err))
+			continue
+		}
+		p.sites[siteCfg.Name] = site
+		p.siteNames = append(p.siteNames, siteCfg.Name)
+		if first {
+			firstTimers = append(firstTimers, site)
+		}
+		l.Info("Site added", zap.Bool("first", first))
+	}
+
+	return firstTimers, errors.Join(errs...)
+}
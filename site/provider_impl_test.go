@@ -0,0 +1,350 @@
+package site
+
+import (
+	"github.com/marcsello/webploy-server/config"
+	"github.com/marcsello/webploy-server/utils"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func testSiteConfig(name string) config.SiteConfig {
+	return config.SiteConfig{
+		Name:                 name,
+		MaxHistory:           2,
+		MaxOpen:              2,
+		MaxConcurrentUploads: 10,
+		LiveLinkName:         "live",
+		GoLiveOnFinish:       true,
+		StaleCleanupTimeout:  30 * time.Minute,
+		Hooks:                config.HooksConfig{Script: config.ScriptConfig{Timeout: 10 * time.Minute, GracePeriod: 5 * time.Second, MaxOutputKB: 1024}, Webhook: config.WebhookConfig{Timeout: 10 * time.Second}},
+	}
+}
+
+func TestProviderImpl_ManagedSites(t *testing.T) {
+	root := t.TempDir()
+	managedFile := path.Join(t.TempDir(), "sites.yaml")
+	cfg := config.SitesConfig{
+		Root:        root,
+		Sites:       []config.SiteConfig{testSiteConfig("static")},
+		ManagedFile: managedFile,
+	}
+
+	p, err := InitSites(cfg, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"static"}, p.GetAllSiteNames())
+	assert.False(t, p.IsManaged("static"))
+
+	// add
+	s, first, err := p.AddSite(testSiteConfig("dynamic"))
+	assert.NoError(t, err)
+	assert.True(t, first)
+	assert.Equal(t, "dynamic", s.GetName())
+	assert.DirExists(t, path.Join(root, "dynamic"))
+	assert.True(t, p.IsManaged("dynamic"))
+	assert.Equal(t, []string{"static", "dynamic"}, p.GetAllSiteNames())
+
+	_, _, err = p.AddSite(testSiteConfig("dynamic"))
+	assert.ErrorIs(t, err, ErrSiteExists)
+	_, _, err = p.AddSite(testSiteConfig("static"))
+	assert.ErrorIs(t, err, ErrSiteExists)
+	_, _, err = p.AddSite(testSiteConfig(".invalid"))
+	assert.ErrorIs(t, err, ErrSiteNameInvalid)
+
+	// only the config file can set what runs or is written outside the site's directory
+	withHook := testSiteConfig("with_hook")
+	withHook.Hooks.PostLive = config.HookList{{Path: "/bin/sh", OnFailure: config.HookOnFailureAbort, User: "root"}}
+	withNotification := testSiteConfig("with_notification")
+	withNotification.Notifications = []config.NotificationConfig{{URL: "https://example.com/events"}}
+	withPath := testSiteConfig("with_path")
+	withPath.Path = "/etc/with_path"
+	withLinkDir := testSiteConfig("with_link_dir")
+	withLinkDir.LinkDir = "/etc"
+	for _, restricted := range []config.SiteConfig{withHook, withNotification, withPath, withLinkDir} {
+		_, _, err = p.AddSite(restricted)
+		assert.ErrorIs(t, err, ErrRestrictedSiteField, restricted.Name)
+		_, ok := p.GetSite(restricted.Name)
+		assert.False(t, ok)
+	}
+	assert.NoDirExists(t, "/etc/with_path")
+
+	// update
+	updated := testSiteConfig("dynamic")
+	updated.MaxHistory = 5
+	updated.StaleCleanupTimeout = time.Hour
+	assert.NoError(t, p.UpdateSite(updated))
+	s, _ = p.GetSite("dynamic")
+	assert.Equal(t, updated, s.GetConfig())
+
+	updatedWithHook := updated
+	updatedWithHook.Hooks.PreCreate = config.HookList{{Path: "/bin/sh", OnFailure: config.HookOnFailureAbort}}
+	assert.ErrorIs(t, p.UpdateSite(updatedWithHook), ErrRestrictedSiteField)
+
+	renamedLink := testSiteConfig("dynamic")
+	renamedLink.LiveLinkName = "current"
+	assert.ErrorIs(t, p.UpdateSite(renamedLink), ErrLinkNameImmutable)
+	assert.ErrorIs(t, p.UpdateSite(testSiteConfig("static")), ErrSiteNotManaged)
+	assert.ErrorIs(t, p.UpdateSite(testSiteConfig("missing")), ErrSiteNotExists)
+
+	// persisted, and loaded back
+	p2, err := InitSites(cfg, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"static", "dynamic"}, p2.GetAllSiteNames())
+	assert.Empty(t, p2.GetNewSiteNamesSinceInit())
+	s, _ = p2.GetSite("dynamic")
+	assert.Equal(t, updated, s.GetConfig())
+
+	// remove
+	assert.ErrorIs(t, p.RemoveSite("static"), ErrSiteNotManaged)
+	assert.ErrorIs(t, p.RemoveSite("missing"), ErrSiteNotExists)
+	assert.NoError(t, p.RemoveSite("dynamic"))
+	_, ok := p.GetSite("dynamic")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"static"}, p.GetAllSiteNames())
+	assert.DirExists(t, path.Join(root, "dynamic")) // files are kept
+
+	p3, err := InitSites(cfg, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"static"}, p3.GetAllSiteNames())
+}
+
+func TestProviderImpl_ManagedSitesDisabled(t *testing.T) {
+	p, err := InitSites(config.SitesConfig{
+		Root:  t.TempDir(),
+		Sites: []config.SiteConfig{testSiteConfig("static")},
+	}, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+
+	_, _, err = p.AddSite(testSiteConfig("dynamic"))
+	assert.ErrorIs(t, err, ErrManagedSitesDisabled)
+	assert.ErrorIs(t, p.UpdateSite(testSiteConfig("static")), ErrManagedSitesDisabled)
+	assert.ErrorIs(t, p.RemoveSite("static"), ErrManagedSitesDisabled)
+}
+
+func TestInitSites_ManagedFile(t *testing.T) {
+	testCases := []struct {
+		name          string
+		content       string
+		expectedSites []string
+		expectedErr   bool
+	}{
+		{name: "happy__empty", content: "", expectedSites: []string{"static"}},
+		{name: "happy__defaults_applied", content: "- name: dynamic\n", expectedSites: []string{"static", "dynamic"}},
+		{name: "error__duplicate_of_static", content: "- name: static\n", expectedErr: true},
+		{name: "error__unknown_field", content: "- name: dynamic\n  foo: bar\n", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			managedFile := path.Join(t.TempDir(), "sites.yaml")
+			assert.NoError(t, os.WriteFile(managedFile, []byte(tc.content), 0o600))
+
+			p, err := InitSites(config.SitesConfig{
+				Root:        t.TempDir(),
+				Sites:       []config.SiteConfig{testSiteConfig("static")},
+				ManagedFile: managedFile,
+			}, zaptest.NewLogger(t))
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedSites, p.GetAllSiteNames())
+			for _, name := range tc.expectedSites {
+				s, ok := p.GetSite(name)
+				assert.True(t, ok)
+				assert.Equal(t, testSiteConfig(name), s.GetConfig())
+			}
+		})
+	}
+}
+
+func TestProviderImpl_SyncStaticSites(t *testing.T) {
+	root := t.TempDir()
+	p, err := InitSites(config.SitesConfig{
+		Root:        root,
+		Sites:       []config.SiteConfig{testSiteConfig("keep"), testSiteConfig("update"), testSiteConfig("remove")},
+		ManagedFile: path.Join(t.TempDir(), "sites.yaml"),
+	}, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+
+	_, _, err = p.AddSite(testSiteConfig("managed"))
+	assert.NoError(t, err)
+
+	keepSite, _ := p.GetSite("keep")
+
+	updated := testSiteConfig("update")
+	updated.GoLiveOnFinish = false
+	updated.Hooks.PreCreate = config.HookList{{Path: "/bin/true", OnFailure: config.HookOnFailureAbort}}
+
+	newSites, err := p.SyncStaticSites(config.SitesConfig{Sites: []config.SiteConfig{testSiteConfig("keep"), updated, testSiteConfig("add")}})
+	assert.NoError(t, err)
+	assert.Len(t, newSites, 1)
+	assert.Equal(t, "add", newSites[0].GetName())
+
+	assert.Equal(t, []string{"keep", "update", "managed", "add"}, p.GetAllSiteNames())
+
+	s, _ := p.GetSite("keep")
+	assert.Same(t, keepSite, s) // unchanged sites are not re-created
+	s, _ = p.GetSite("update")
+	assert.Equal(t, updated, s.GetConfig())
+	_, ok := p.GetSite("remove")
+	assert.False(t, ok)
+	assert.DirExists(t, path.Join(root, "remove")) // files are kept
+	_, ok = p.GetSite("managed")
+	assert.True(t, ok) // managed sites are not affected
+
+	// partial failures
+	renamedLink := testSiteConfig("keep")
+	renamedLink.LiveLinkName = "current"
+	newSites, err = p.SyncStaticSites(config.SitesConfig{Sites: []config.SiteConfig{renamedLink, updated, testSiteConfig("add"), testSiteConfig("managed"), testSiteConfig("add2")}})
+	assert.ErrorIs(t, err, ErrLinkNameImmutable)
+	assert.ErrorIs(t, err, ErrSiteExists)
+	assert.Len(t, newSites, 1)
+	assert.Equal(t, []string{"keep", "update", "managed", "add", "add2"}, p.GetAllSiteNames())
+	assert.False(t, p.IsManaged("add2"))
+
+	// duplicates are rejected as a whole
+	_, err = p.SyncStaticSites(config.SitesConfig{Sites: []config.SiteConfig{testSiteConfig("keep"), testSiteConfig("keep")}})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"keep", "update", "managed", "add", "add2"}, p.GetAllSiteNames())
+}
+
+func TestProviderImpl_SitePaths(t *testing.T) {
+	root := t.TempDir()
+	external := t.TempDir()
+
+	custom := testSiteConfig("custom")
+	custom.Path = path.Join(external, "custom_deployments")
+	custom.LinkDir = "public/custom" // relative to the root
+	assert.NoError(t, os.Mkdir(path.Join(root, "public"), 0o750))
+
+	p, err := InitSites(config.SitesConfig{
+		Root:  root,
+		Sites: []config.SiteConfig{testSiteConfig("default"), custom},
+	}, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+
+	s, _ := p.GetSite("default")
+	assert.Equal(t, path.Join(root, "default"), s.GetPath())
+	s, _ = p.GetSite("custom")
+	assert.Equal(t, custom.Path, s.GetPath())
+	assert.DirExists(t, custom.Path)
+	assert.DirExists(t, path.Join(root, "public", "custom"))
+
+	// going live creates the link in the link dir, pointing to the deployment
+	id, d, err := s.CreateNewDeployment("user", "")
+	assert.NoError(t, err)
+	assert.NoError(t, d.Finish())
+	assert.NoError(t, s.SetLiveDeploymentID(id))
+
+	linkPath := path.Join(root, "public", "custom", "live")
+	target, err := os.Readlink(linkPath)
+	assert.NoError(t, err)
+	assert.False(t, path.IsAbs(target))
+	linkInfo, err := os.Stat(linkPath) // follows the link
+	assert.NoError(t, err)
+	assert.True(t, linkInfo.IsDir())
+	liveID, err := s.GetLiveDeploymentID()
+	assert.NoError(t, err)
+	assert.Equal(t, id, liveID)
+
+	// paths can not be changed at runtime
+	moved := custom
+	moved.Path = path.Join(external, "moved")
+	assert.ErrorIs(t, s.(*SiteImpl).UpdateConfig(moved), ErrPathImmutable)
+}
+
+func TestInitSites_PathConflict(t *testing.T) {
+	root := t.TempDir()
+
+	samePath := testSiteConfig("other")
+	samePath.Path = "site"
+	_, err := InitSites(config.SitesConfig{Root: root, Sites: []config.SiteConfig{testSiteConfig("site"), samePath}}, zaptest.NewLogger(t))
+	assert.ErrorIs(t, err, ErrPathConflict)
+
+	sameLink := testSiteConfig("other")
+	sameLink.LinkDir = "site"
+	_, err = InitSites(config.SitesConfig{Root: root, Sites: []config.SiteConfig{testSiteConfig("site"), sameLink}}, zaptest.NewLogger(t))
+	assert.ErrorIs(t, err, ErrPathConflict)
+
+	nested := testSiteConfig("other")
+	nested.Path = "site/sub"
+	_, err = InitSites(config.SitesConfig{Root: root, Sites: []config.SiteConfig{testSiteConfig("site"), nested}}, zaptest.NewLogger(t))
+	assert.ErrorIs(t, err, ErrPathConflict)
+
+	parent := testSiteConfig("other")
+	parent.Path = "."
+	_, err = InitSites(config.SitesConfig{Root: root, Sites: []config.SiteConfig{testSiteConfig("site"), parent}}, zaptest.NewLogger(t))
+	assert.ErrorIs(t, err, ErrPathConflict)
+
+	linkOnSite := testSiteConfig("other")
+	linkOnSite.LinkDir = "."
+	linkOnSite.LiveLinkName = "site"
+	_, err = InitSites(config.SitesConfig{Root: root, Sites: []config.SiteConfig{testSiteConfig("site"), linkOnSite}}, zaptest.NewLogger(t))
+	assert.ErrorIs(t, err, ErrPathConflict)
+	_, err = InitSites(config.SitesConfig{Root: root, Sites: []config.SiteConfig{linkOnSite, testSiteConfig("site")}}, zaptest.NewLogger(t)) // in the other order as well
+	assert.ErrorIs(t, err, ErrPathConflict)
+
+	similarName := testSiteConfig("other")
+	similarName.Path = "site_other" // not inside root/site
+	_, err = InitSites(config.SitesConfig{Root: root, Sites: []config.SiteConfig{testSiteConfig("site"), similarName}}, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+
+	otherLinkName := testSiteConfig("other")
+	otherLinkName.LinkDir = "site"
+	otherLinkName.LiveLinkName = "other_live"
+	_, err = InitSites(config.SitesConfig{Root: root, Sites: []config.SiteConfig{testSiteConfig("site"), otherLinkName}}, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+}
+
+func TestInitSites_LinkDirFilesystem(t *testing.T) {
+	if _, err := os.Stat("/dev/shm"); err != nil {
+		t.Skip("no tmpfs available")
+	}
+	linkDir, err := os.MkdirTemp("/dev/shm", "webploy-test")
+	if err != nil {
+		t.Skip("/dev/shm is not writable")
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(linkDir) })
+
+	root := t.TempDir()
+	if same, _ := utils.SameFilesystem(root, linkDir); same {
+		t.Skip("the temp dir is on the same filesystem as /dev/shm")
+	}
+
+	s := testSiteConfig("site")
+	s.LinkDir = linkDir
+	_, err = InitSites(config.SitesConfig{Root: root, Sites: []config.SiteConfig{s}}, zaptest.NewLogger(t))
+	assert.ErrorIs(t, err, ErrLinkDirFilesystem)
+}
+
+func TestProviderImpl_ResolveSite(t *testing.T) {
+	var defaults, template, layer config.SiteConfigLayer
+	assert.NoError(t, yaml.Unmarshal([]byte(`max_history: 5`), &defaults))
+	assert.NoError(t, yaml.Unmarshal([]byte(`max_open: 3`), &template))
+	assert.NoError(t, yaml.Unmarshal([]byte("name: new_site\ntemplate: small"), &layer))
+
+	p, err := InitSites(config.SitesConfig{
+		Root:      t.TempDir(),
+		Defaults:  &defaults,
+		Templates: map[string]*config.SiteConfigLayer{"small": &template},
+	}, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+
+	s, err := p.ResolveSite(&layer)
+	assert.NoError(t, err)
+	assert.Equal(t, "new_site", s.Name)
+	assert.Equal(t, uint(5), s.MaxHistory)
+	assert.Equal(t, uint(3), s.MaxOpen)
+
+	// the defaults and the templates are replaced when the config is reloaded
+	_, err = p.SyncStaticSites(config.SitesConfig{Defaults: &defaults})
+	assert.NoError(t, err)
+	_, err = p.ResolveSite(&layer)
+	assert.ErrorContains(t, err, "unknown template: small")
+}
@@ -1,6 +1,7 @@
 package site
 
 import (
+	"github.com/marcsello/webploy-server/config"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -26,3 +27,39 @@ func (m *MockProvider) GetNewSiteNamesSinceInit() []string {
 	args := m.Called()
 	return args.Get(0).([]string)
 }
+
+// IsManaged mocks the IsManaged method of the Provider interface.
+func (m *MockProvider) IsManaged(name string) bool {
+	args := m.Called(name)
+	return args.Bool(0)
+}
+
+// AddSite mocks the AddSite method of the Provider interface.
+func (m *MockProvider) AddSite(siteCfg config.SiteConfig) (Site, bool, error) {
+	args := m.Called(siteCfg)
+	return args.Get(0).(Site), args.Bool(1), args.Error(2)
+}
+
+// UpdateSite mocks the UpdateSite method of the Provider interface.
+func (m *MockProvider) UpdateSite(siteCfg config.SiteConfig) error {
+	args := m.Called(siteCfg)
+	return args.Error(0)
+}
+
+// RemoveSite mocks the RemoveSite method of the Provider interface.
+func (m *MockProvider) RemoveSite(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+// ResolveSite mocks the ResolveSite method of the Provider interface.
+func (m *MockProvider) ResolveSite(layer *config.SiteConfigLayer) (config.SiteConfig, error) {
+	args := m.Called(layer)
+	return args.Get(0).(config.SiteConfig), args.Error(1)
+}
+
+// SyncStaticSites mocks the SyncStaticSites method of the Provider interface.
+func (m *MockProvider) SyncStaticSites(sitesCfg config.SitesConfig) ([]Site, error) {
+	args := m.Called(sitesCfg)
+	return args.Get(0).([]Site), args.Error(1)
+}
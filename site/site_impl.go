@@ -7,12 +7,15 @@ import (
 	"go.uber.org/zap"
 	"os"
 	"path"
+	"path/filepath"
 	"sync"
 )
 
 type SiteImpl struct {
 	fullPath           string // this is a read-only constant... sort of... it never changes
+	linkDir            string // directory of the live symlink, same as fullPath unless configured otherwise
 	deploymentsMutex   sync.RWMutex
+	cfgMutex           sync.RWMutex // the config may be updated while the site is in use
 	cfg                config.SiteConfig
 	deploymentProvider deployment.Provider
 	logger             *zap.Logger
@@ -49,11 +52,35 @@ func (s *SiteImpl) Init() (bool, error) {
 		firstTime = true
 	}
 
+	if s.linkDir != s.fullPath {
+		exists, err = utils.ExistsAndDirectory(s.linkDir)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			err = os.Mkdir(s.linkDir, 0o750)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		// the live link is replaced by renaming, and points to the deployments, keep them together, so nothing can go wrong in between
+		var same bool
+		same, err = utils.SameFilesystem(s.fullPath, s.linkDir)
+		if err != nil {
+			return false, err
+		}
+		if !same {
+			s.logger.Error("Could not init: The link dir is on a different filesystem than the deployments", zap.String("fullPath", s.fullPath), zap.String("linkDir", s.linkDir))
+			return false, ErrLinkDirFilesystem
+		}
+	}
+
 	return firstTime, nil
 }
 
 func (s *SiteImpl) GetName() string {
-	return s.cfg.Name
+	return s.GetConfig().Name
 }
 
 func (s *SiteImpl) GetPath() string {
@@ -61,9 +88,31 @@ func (s *SiteImpl) GetPath() string {
 }
 
 func (s *SiteImpl) GetConfig() config.SiteConfig {
+	s.cfgMutex.RLock()
+	defer s.cfgMutex.RUnlock()
 	return s.cfg
 }
 
+// UpdateConfig replaces the config of the site, the name, the link name and the paths can not be changed
+func (s *SiteImpl) UpdateConfig(cfg config.SiteConfig) error {
+	s.cfgMutex.Lock()
+	defer s.cfgMutex.Unlock()
+
+	if cfg.Name != s.cfg.Name {
+		return ErrSiteNameImmutable
+	}
+	if cfg.LiveLinkName != s.cfg.LiveLinkName {
+		return ErrLinkNameImmutable
+	}
+	if cfg.Path != s.cfg.Path || cfg.LinkDir != s.cfg.LinkDir {
+		return ErrPathImmutable
+	}
+
+	s.cfg = cfg
+	s.deploymentProvider.UpdateSiteConfig(cfg)
+	return nil
+}
+
 func (s *SiteImpl) listDeploymentIDs() ([]string, error) {
 	var ids []string
 
@@ -224,7 +273,7 @@ func (s *SiteImpl) SetLiveDeploymentID(id string) error {
 	if !IsDeploymentIDValid(id) {
 		return ErrInvalidID
 	}
-	symlinkFullPath := path.Join(s.fullPath, s.cfg.LiveLinkName)
+	symlinkFullPath := s.liveLinkPath()
 	tmpSymlinkFullPath := symlinkFullPath + ".new"
 
 	// lock
@@ -258,8 +307,13 @@ func (s *SiteImpl) SetLiveDeploymentID(id string) error {
 		}
 	}
 
-	// create "new" link
-	err = os.Symlink(id, tmpSymlinkFullPath) // make it a relative link
+	// create "new" link, make it a relative link
+	var target string
+	target, err = filepath.Rel(s.linkDir, s.getPathForId(id))
+	if err != nil {
+		return err
+	}
+	err = os.Symlink(target, tmpSymlinkFullPath)
 	if err != nil {
 		return err
 	}
@@ -273,9 +327,12 @@ func (s *SiteImpl) SetLiveDeploymentID(id string) error {
 	return nil // success
 }
 
+func (s *SiteImpl) liveLinkPath() string {
+	return path.Join(s.linkDir, s.GetConfig().LiveLinkName)
+}
+
 func (s *SiteImpl) readLiveDeploymentIDFromSymlink() (string, error) {
-	symlinkFullPath := path.Join(s.fullPath, s.cfg.LiveLinkName)
-	dest, err := os.Readlink(symlinkFullPath)
+	dest, err := os.Readlink(s.liveLinkPath())
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileWatchDebounce is the time to wait for more events before invoking the callback, editors and tools tend to produce multiple events for a single change
+const FileWatchDebounce = 250 * time.Millisecond
+
+type fileWatcherDaemon struct {
+	watcher  *fsnotify.Watcher
+	files    map[string]bool   // absolute paths of the watched files
+	targets  map[string]string // the files the watched ones point to, if they are symlinks
+	onChange func()
+	logger   *zap.Logger
+	wg       sync.WaitGroup
+}
+
+// NewFileWatcher creates a Daemon that calls onChange every time one of the files changes.
+// It watches the containing directories instead of the files themselves, so files replaced by renaming (atomic writes, editors) are followed as well.
+// Symlinks are resolved again on every change in their directory, so swapping a symlink they point through (e.g. ..data of kubernetes secrets) is noticed too.
+func NewFileWatcher(logger *zap.Logger, onChange func(), files ...string) (Daemon, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	watchedFiles := make(map[string]bool, len(files))
+	targets := make(map[string]string, len(files))
+	watchedDirs := make(map[string]bool, len(files))
+	for _, f := range files {
+		var absPath string
+		absPath, err = filepath.Abs(f)
+		if err != nil {
+			_ = watcher.Close()
+			return nil, err
+		}
+		watchedFiles[absPath] = true
+		targets[absPath] = resolveSymlinks(absPath)
+		watchedDirs[filepath.Dir(absPath)] = true
+	}
+
+	for dir := range watchedDirs {
+		err = watcher.Add(dir)
+		if err != nil {
+			_ = watcher.Close()
+			return nil, err
+		}
+	}
+
+	return &fileWatcherDaemon{
+		watcher:  watcher,
+		files:    watchedFiles,
+		targets:  targets,
+		onChange: onChange,
+		logger:   logger,
+	}, nil
+}
+
+func (fw *fileWatcherDaemon) run() {
+	defer fw.wg.Done()
+
+	var debounceTimer *time.Timer
+	defer func() {
+		if debounceTimer != nil {
+			debounceTimer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-fw.watcher.Events:
+			if !ok {
+				return // watcher closed
+			}
+			if event.Op == fsnotify.Chmod || !fw.isChanged(filepath.Clean(event.Name)) {
+				continue // not interested
+			}
+			fw.logger.Debug("Watched file changed", zap.String("file", event.Name), zap.String("op", event.Op.String()))
+
+			if debounceTimer != nil {
+				debounceTimer.Stop()
+			}
+			debounceTimer = time.AfterFunc(FileWatchDebounce, fw.onChange)
+
+		case err, ok := <-fw.watcher.Errors:
+			if !ok {
+				return // watcher closed
+			}
+			// these are mostly event queue overflows, nothing we could do about it
+			fw.logger.Warn("Error while watching files", zap.Error(err))
+		}
+	}
+}
+
+// isChanged tells if the event of the file changed one of the watched files, either directly or by changing where it points to
+func (fw *fileWatcherDaemon) isChanged(name string) bool {
+	changed := fw.files[name]
+	dir := filepath.Dir(name)
+	for f := range fw.files {
+		if filepath.Dir(f) != dir {
+			continue
+		}
+		target := resolveSymlinks(f)
+		if target != fw.targets[f] {
+			fw.targets[f] = target
+			changed = true
+		}
+	}
+	return changed
+}
+
+// resolveSymlinks returns the path the file points to, or an empty string if it can not be resolved (e.g. it does not exist at the moment)
+func resolveSymlinks(path string) string {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+func (fw *fileWatcherDaemon) Start() error {
+	fw.wg.Add(1)
+	go fw.run()
+	return nil
+}
+
+func (fw *fileWatcherDaemon) Destroy() error {
+	err := fw.watcher.Close()
+	fw.wg.Wait()
+	return err
+}
+
+func (fw *fileWatcherDaemon) ErrChan() <-chan error {
+	return nil // errors are only logged, they are not fatal
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileWatcher(t *testing.T) {
+	tmpDir := t.TempDir()
+	watchedFile := path.Join(tmpDir, "watched")
+	otherFile := path.Join(tmpDir, "other")
+	assert.NoError(t, os.WriteFile(watchedFile, []byte("a"), 0o600))
+
+	var calls atomic.Int32
+	fw, err := NewFileWatcher(zaptest.NewLogger(t), func() { calls.Add(1) }, watchedFile)
+	assert.NoError(t, err)
+	assert.NoError(t, fw.Start())
+
+	// changes to other files in the same directory are ignored
+	assert.NoError(t, os.WriteFile(otherFile, []byte("b"), 0o600))
+	time.Sleep(FileWatchDebounce * 2)
+	assert.Equal(t, int32(0), calls.Load())
+
+	// multiple quick writes are debounced into a single call
+	assert.NoError(t, os.WriteFile(watchedFile, []byte("c"), 0o600))
+	assert.NoError(t, os.WriteFile(watchedFile, []byte("d"), 0o600))
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// replacing the file by renaming is followed as well
+	tmpFile := watchedFile + ".tmp"
+	assert.NoError(t, os.WriteFile(tmpFile, []byte("e"), 0o600))
+	assert.NoError(t, os.Rename(tmpFile, watchedFile))
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, fw.Destroy())
+}
+
+func TestFileWatcher_Symlinks(t *testing.T) {
+	// the same layout as a kubernetes secret: the file points through ..data, which is swapped to a new directory on updates
+	tmpDir := t.TempDir()
+	watchedFile := path.Join(tmpDir, "watched")
+	assert.NoError(t, os.Mkdir(path.Join(tmpDir, "..v1"), 0o700))
+	assert.NoError(t, os.WriteFile(path.Join(tmpDir, "..v1", "watched"), []byte("a"), 0o600))
+	assert.NoError(t, os.Symlink("..v1", path.Join(tmpDir, "..data")))
+	assert.NoError(t, os.Symlink(path.Join("..data", "watched"), watchedFile))
+
+	var calls atomic.Int32
+	fw, err := NewFileWatcher(zaptest.NewLogger(t), func() { calls.Add(1) }, watchedFile)
+	assert.NoError(t, err)
+	assert.NoError(t, fw.Start())
+
+	// new files in the directory do not change the target
+	assert.NoError(t, os.Mkdir(path.Join(tmpDir, "..v2"), 0o700))
+	assert.NoError(t, os.WriteFile(path.Join(tmpDir, "..v2", "watched"), []byte("b"), 0o600))
+	time.Sleep(FileWatchDebounce * 2)
+	assert.Equal(t, int32(0), calls.Load())
+
+	// swapping the symlink is noticed, even though the watched file itself is not touched
+	assert.NoError(t, os.Symlink("..v2", path.Join(tmpDir, "..data_tmp")))
+	assert.NoError(t, os.Rename(path.Join(tmpDir, "..data_tmp"), path.Join(tmpDir, "..data")))
+	assert.NoError(t, os.RemoveAll(path.Join(tmpDir, "..v1")))
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, fw.Destroy())
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var ErrNoDeviceInfo = errors.New("could not get the device of the file")
+
+// SameFilesystem returns true if both paths are on the same filesystem (device), renames are only atomic within a single filesystem
+func SameFilesystem(a, b string) (bool, error) {
+	aDev, err := deviceOf(a)
+	if err != nil {
+		return false, err
+	}
+	var bDev uint64
+	bDev, err = deviceOf(b)
+	if err != nil {
+		return false, err
+	}
+	return aDev == bDev, nil
+}
+
+func deviceOf(p string) (uint64, error) {
+	fileInfo, err := os.Stat(p)
+	if err != nil {
+		return 0, err
+	}
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, ErrNoDeviceInfo
+	}
+	return uint64(stat.Dev), nil // #nosec G115 -- the type of Dev differs between platforms
+}
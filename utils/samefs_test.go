@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSameFilesystem(t *testing.T) {
+	tmpDir := t.TempDir()
+	subDir := path.Join(tmpDir, "sub")
+	assert.NoError(t, os.Mkdir(subDir, 0o750))
+
+	same, err := SameFilesystem(tmpDir, subDir)
+	assert.NoError(t, err)
+	assert.True(t, same)
+
+	// /proc is always a separate filesystem on linux
+	if _, err = os.Stat("/proc/self"); err == nil {
+		same, err = SameFilesystem(tmpDir, "/proc/self")
+		assert.NoError(t, err)
+		assert.False(t, same)
+	}
+
+	_, err = SameFilesystem(tmpDir, path.Join(tmpDir, "missing"))
+	assert.Error(t, err)
+}